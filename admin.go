@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const adminUsage = `usage: replay-bigquery-job admin <command> [-dry-run] [-yes] [-target NAME] [arguments]
+
+commands:
+  pause
+  unpause
+  grant-role <ROLE> <ACCOUNT>
+  revoke-role <ROLE> <ACCOUNT>
+  renounce-role <ROLE> <ACCOUNT>
+  transfer-ownership <NEW_OWNER>
+
+ROLE is ADMIN_ROLE, DEFAULT_ADMIN_ROLE or a 0x-prefixed 32-byte role id.`
+
+// adminCommand describes a CLI command: the contract method it calls, the positional arguments it expects
+// and how to invoke the typed binding with the parsed arguments.
+type adminCommand struct {
+	method string
+	params []string
+	call   func(records *Records, opts *bind.TransactOpts, args []interface{}) (*types.Transaction, error)
+}
+
+var adminCommands = map[string]adminCommand{
+	"pause": {
+		method: "pause",
+		call: func(records *Records, opts *bind.TransactOpts, _ []interface{}) (*types.Transaction, error) {
+			return records.Pause(opts)
+		},
+	},
+	"unpause": {
+		method: "unpause",
+		call: func(records *Records, opts *bind.TransactOpts, _ []interface{}) (*types.Transaction, error) {
+			return records.Unpause(opts)
+		},
+	},
+	"grant-role": {
+		method: "grantRole",
+		params: []string{"ROLE", "ACCOUNT"},
+		call: func(records *Records, opts *bind.TransactOpts, args []interface{}) (*types.Transaction, error) {
+			return records.GrantRole(opts, args[0].([32]byte), args[1].(common.Address))
+		},
+	},
+	"revoke-role": {
+		method: "revokeRole",
+		params: []string{"ROLE", "ACCOUNT"},
+		call: func(records *Records, opts *bind.TransactOpts, args []interface{}) (*types.Transaction, error) {
+			return records.RevokeRole(opts, args[0].([32]byte), args[1].(common.Address))
+		},
+	},
+	"renounce-role": {
+		method: "renounceRole",
+		params: []string{"ROLE", "ACCOUNT"},
+		call: func(records *Records, opts *bind.TransactOpts, args []interface{}) (*types.Transaction, error) {
+			return records.RenounceRole(opts, args[0].([32]byte), args[1].(common.Address))
+		},
+	},
+	"transfer-ownership": {
+		method: "transferOwnership",
+		params: []string{"NEW_OWNER"},
+		call: func(records *Records, opts *bind.TransactOpts, args []interface{}) (*types.Transaction, error) {
+			return records.TransferOwnership(opts, args[0].(common.Address))
+		},
+	},
+}
+
+// runAdmin executes a contract administration command with the same RPC, signer and contract configuration
+// used by the anchoring job, against the deployment active today. Every command prints the encoded call and asks for confirmation before sending.
+func runAdmin(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(adminUsage)
+		return errors.New("missing admin command")
+	}
+
+	command, ok := adminCommands[args[0]]
+	if !ok {
+		fmt.Println(adminUsage)
+		return fmt.Errorf("unknown admin command %q", args[0])
+	}
+
+	flags := flag.NewFlagSet("admin "+args[0], flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the encoded call without sending it")
+	assumeYes := flags.Bool("yes", false, "send without asking for confirmation")
+	targetName := flags.String("target", "", "chain target to act on, defaults to the first configured target")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != len(command.params) {
+		fmt.Println(adminUsage)
+		return fmt.Errorf("%s expects %d argument(s): %s", args[0], len(command.params), strings.Join(command.params, " "))
+	}
+
+	targets, err := LoadChainTargets()
+	if err != nil {
+		return err
+	}
+	target, err := FindChainTarget(targets, *targetName)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	client, err := target.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fromAddress := target.SignerAddress()
+
+	deployment, records, err := target.registry.BindActive(ctx, client, time.Now())
+	if err != nil {
+		log.Printf("Error binding records contract: %v", err)
+		return err
+	}
+	contractAddress := deployment.ContractAddress()
+
+	callArgs, err := adminCallArgs(records, command, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	auth, err := newTransactOpts(ctx, client, target.privateKey, target.Fees)
+	if err != nil {
+		return err
+	}
+	// The transaction is signed but held back so the operator reviews exactly what will be broadcast.
+	auth.NoSend = true
+
+	fmt.Printf("Target:    %s\n", target.Name)
+	fmt.Printf("Contract:  %s (%s)\n", contractAddress.Hex(), deployment.Name)
+	fmt.Printf("Signer:    %s\n", fromAddress.Hex())
+	fmt.Printf("Call:      %s(%s)\n", command.method, formatAdminArgs(callArgs))
+
+	tx, err := command.call(records, auth, callArgs)
+	if err != nil {
+		log.Printf("Error preparing transaction, the call would likely revert: %v", err)
+		return err
+	}
+
+	fmt.Printf("Call data: 0x%s\n", hex.EncodeToString(tx.Data()))
+	fmt.Printf("Nonce:     %d\n", tx.Nonce())
+	fmt.Printf("Gas:       %d at up to %s wei\n", tx.Gas(), tx.GasFeeCap())
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing was sent.")
+		return nil
+	}
+
+	if !*assumeYes && !confirm("Send this transaction?") {
+		fmt.Println("Aborted, nothing was sent.")
+		return nil
+	}
+
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		log.Printf("Error sending transaction: %v", err)
+		return err
+	}
+	fmt.Printf("Transaction sent: %s\n", tx.Hash().Hex())
+
+	receipt, err := waitForConfirmation(ctx, client, tx.Hash())
+	if err != nil {
+		log.Printf("Error waiting for transaction confirmation. Hash: %s, Error: %v", tx.Hash().Hex(), err)
+		return err
+	}
+
+	printReceipt(receipt)
+
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("transaction failed with status: %d", receipt.Status)
+	}
+
+	return nil
+}
+
+// adminCallArgs converts the positional CLI arguments into the Go values expected by the contract method.
+func adminCallArgs(records *Records, command adminCommand, args []string) ([]interface{}, error) {
+	callArgs := make([]interface{}, len(args))
+	for i, param := range command.params {
+		switch param {
+		case "ROLE":
+			role, err := resolveRole(records, args[i])
+			if err != nil {
+				return nil, err
+			}
+			callArgs[i] = role
+		default:
+			if !common.IsHexAddress(args[i]) {
+				return nil, fmt.Errorf("invalid %s address %q", param, args[i])
+			}
+			callArgs[i] = common.HexToAddress(args[i])
+		}
+	}
+	return callArgs, nil
+}
+
+// resolveRole turns a role name exposed by the contract, or a raw 0x-prefixed role id, into its bytes32 value.
+func resolveRole(records *Records, role string) ([32]byte, error) {
+	var id [32]byte
+
+	if strings.HasPrefix(role, "0x") {
+		decoded, err := hex.DecodeString(role[2:])
+		if err != nil || len(decoded) != len(id) {
+			return id, fmt.Errorf("invalid role id %q", role)
+		}
+		copy(id[:], decoded)
+		return id, nil
+	}
+
+	opts := &bind.CallOpts{Context: context.Background()}
+	switch role {
+	case "ADMIN_ROLE":
+		return records.ADMINROLE(opts)
+	case "DEFAULT_ADMIN_ROLE":
+		return records.DEFAULTADMINROLE(opts)
+	default:
+		return id, fmt.Errorf("unknown role %q", role)
+	}
+}
+
+func formatAdminArgs(args []interface{}) string {
+	formatted := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case [32]byte:
+			formatted[i] = "0x" + hex.EncodeToString(v[:])
+		case common.Address:
+			formatted[i] = v.Hex()
+		default:
+			formatted[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// confirm asks a yes/no question on stdin and reports whether the operator answered yes.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// printReceipt reports the outcome of a transaction together with the contract events it emitted.
+func printReceipt(receipt *types.Receipt) {
+	parsedABI, err := RecordsMetaData.GetAbi()
+	if err != nil {
+		log.Printf("Error parsing ABI: %v", err)
+		return
+	}
+
+	fmt.Printf("Status:    %d\n", receipt.Status)
+	fmt.Printf("Block:     %s\n", receipt.BlockNumber)
+	fmt.Printf("Gas used:  %d\n", receipt.GasUsed)
+	if receipt.EffectiveGasPrice != nil {
+		fee := new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice)
+		fmt.Printf("Fee:       %s ETH\n", FromWei(fee))
+	}
+
+	for _, vLog := range receipt.Logs {
+		if len(vLog.Topics) == 0 {
+			continue
+		}
+		event, err := parsedABI.EventByID(vLog.Topics[0])
+		if err != nil {
+			fmt.Printf("Event:     unknown (%s)\n", vLog.Topics[0].Hex())
+			continue
+		}
+		fmt.Printf("Event:     %s\n", event.Name)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// sendAlert logs an operational alert and, when ALERT_WEBHOOK_URL is set, posts it to that webhook.
+// The payload uses the {"text": ...} shape understood by Slack-compatible incoming webhooks.
+func sendAlert(subject, message string) {
+	text := fmt.Sprintf("[replay-bigquery-job][%s] %s: %s", config.Environment, subject, message)
+	log.Println("ALERT:", text)
+
+	webhookURL := config.Alerts.WebhookURL
+	if webhookURL == "" {
+		return
+	}
+
+	payload, err := sonic.Marshal(map[string]string{"text": text})
+	if err != nil {
+		log.Println("Failed to encode alert payload: ", err)
+		return
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Println("Failed to deliver alert: ", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("Alert webhook returned status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+// AuditRow links one anchored source row to the log that recorded it on chain, as stored in the AUDIT_TABLE.
+// Wei amounts and the gas price are decimal strings, so the columns can be BIGNUMERIC or STRING. BatchFeeWei is
+// what the whole transaction cost and FeeWei the row's share of it, see splitFee. Rows anchored through a Merkle
+// root have no log of their own: their LogIndex is NULL and LeafIndex, NULL for the other rows, is their position
+// in the records of the day's tree.
+type AuditRow struct {
+	RunID                       string              `bigquery:"runId"`
+	Environment                 string              `bigquery:"environment"`
+	Target                      string              `bigquery:"target"`
+	JobID                       string              `bigquery:"JOB_ID"`
+	ChunkID                     float64             `bigquery:"CHUNK_ID"`
+	UserID                      string              `bigquery:"userId"`
+	AssetID                     bigquery.NullString `bigquery:"assetId"`
+	Day                         civil.Date          `bigquery:"day"`
+	TotalDuration               int64               `bigquery:"totalDuration"`
+	TotalRewardsConsumerWei     string              `bigquery:"totalRewardsConsumerWei"`
+	TotalRewardsContentOwnerWei string              `bigquery:"totalRewardsContentOwnerWei"`
+	TxHash                      string              `bigquery:"txHash"`
+	Nonce                       int64               `bigquery:"nonce"`
+	BlockNumber                 int64               `bigquery:"blockNumber"`
+	LogIndex                    bigquery.NullInt64  `bigquery:"logIndex"`
+	LeafIndex                   bigquery.NullInt64  `bigquery:"leafIndex"`
+	GasUsed                     int64               `bigquery:"gasUsed"`
+	EffectiveGasPrice           string              `bigquery:"effectiveGasPrice"`
+	BatchFeeWei                 string              `bigquery:"batchFeeWei"`
+	FeeWei                      string              `bigquery:"feeWei"`
+	SignerAddress               string              `bigquery:"signerAddress"`
+	ContractAddress             string              `bigquery:"contractAddress"`
+	AnchoredAt                  time.Time           `bigquery:"anchoredAt"`
+}
+
+// auditTrail streams a row into AUDIT_TABLE for every source row anchored on chain. A nil trail records nothing.
+type auditTrail struct {
+	client   func() *bigquery.Client
+	tableRef string
+	runID    string
+}
+
+// openAuditTrail checks AUDIT_TABLE ("dataset.table" or "project.dataset.table"), returning nil when it is
+// not set. The table is resolved against client for every write, so the trail follows the reconnections of a
+// shared client.
+func openAuditTrail(client func() *bigquery.Client, runID string) (*auditTrail, error) {
+	tableRef := config.BigQuery.AuditTable
+	if tableRef == "" {
+		return nil, nil
+	}
+	if _, err := bigQueryTable(client(), tableRef); err != nil {
+		return nil, err
+	}
+	return &auditTrail{client: client, tableRef: tableRef, runID: runID}, nil
+}
+
+// newAuditRows pairs the rows of a verified batch with the TransactionAdded logs of its receipt.
+func newAuditRows(runID string, batch Batch, anchored *anchoredBatch) ([]AuditRow, error) {
+	logIndexes := transactionAddedLogIndexes(anchored.Receipt)
+	if len(logIndexes) != len(batch.Rows) {
+		return nil, fmt.Errorf("chunk %s has %d rows but %d TransactionAdded logs", batch.Label(), len(batch.Rows), len(logIndexes))
+	}
+
+	rows := auditRows(runID, batch, anchored, splitFee(receiptFee(anchored.Receipt), len(batch.Rows)))
+	for i := range rows {
+		rows[i].LogIndex = bigquery.NullInt64{Int64: int64(logIndexes[i]), Valid: true}
+	}
+	return rows, nil
+}
+
+// newMerkleAuditRows links the rows of a batch to the transaction that anchored the root of their day. The
+// batch's rows start at position first among the total records of the tree, which share the transaction fee.
+func newMerkleAuditRows(runID string, batch Batch, anchored *anchoredBatch, first, total int) []AuditRow {
+	batchFee := receiptFee(anchored.Receipt)
+	fees := make([]*big.Int, len(batch.Rows))
+	for i := range fees {
+		fees[i] = feeShare(batchFee, total, first+i)
+	}
+	rows := auditRows(runID, batch, anchored, fees)
+	for i := range rows {
+		rows[i].LeafIndex = bigquery.NullInt64{Int64: int64(first + i), Valid: true}
+	}
+	return rows
+}
+
+// auditRows fills the audit rows of a batch, except for their log or leaf indexes, giving each row its fee.
+func auditRows(runID string, batch Batch, anchored *anchoredBatch, fees []*big.Int) []AuditRow {
+	effectiveGasPrice := ""
+	if anchored.EffectiveGasPrice != nil {
+		effectiveGasPrice = anchored.EffectiveGasPrice.String()
+	}
+	batchFee := receiptFee(anchored.Receipt)
+	transactions := buildTransactions(batch.Rows)
+	anchoredAt := time.Now()
+
+	rows := make([]AuditRow, len(batch.Rows))
+	for i, row := range batch.Rows {
+		rows[i] = AuditRow{
+			RunID:                       runID,
+			Environment:                 config.Environment,
+			Target:                      anchored.Target,
+			JobID:                       row.JobID,
+			ChunkID:                     row.ChunkID,
+			UserID:                      row.UserID,
+			AssetID:                     row.AssetID,
+			Day:                         civil.DateOf(row.CreatedAtDay),
+			TotalDuration:               row.TotalDuration,
+			TotalRewardsConsumerWei:     transactions[i].TotalRewardsConsumer.String(),
+			TotalRewardsContentOwnerWei: transactions[i].TotalRewardsContentOwner.String(),
+			TxHash:                      anchored.TxHash.Hex(),
+			Nonce:                       int64(anchored.Nonce),
+			BlockNumber:                 anchored.BlockNumber.Int64(),
+			GasUsed:                     int64(anchored.GasUsed),
+			EffectiveGasPrice:           effectiveGasPrice,
+			BatchFeeWei:                 batchFee.String(),
+			FeeWei:                      fees[i].String(),
+			SignerAddress:               anchored.Signer.Hex(),
+			ContractAddress:             anchored.Contract.Hex(),
+			AnchoredAt:                  anchoredAt,
+		}
+	}
+	return rows
+}
+
+// record streams the audit rows of an anchored batch. Every row is inserted with auditInsertID, so a retried
+// insert does not duplicate it.
+func (a *auditTrail) record(ctx context.Context, batch Batch, anchored *anchoredBatch) error {
+	if a == nil {
+		return nil
+	}
+
+	rows, err := newAuditRows(a.runID, batch, anchored)
+	if err != nil {
+		return err
+	}
+	return a.insert(ctx, batch, anchored, rows)
+}
+
+// recordMerkle streams the audit rows of a batch anchored through a Merkle root, see newMerkleAuditRows.
+func (a *auditTrail) recordMerkle(ctx context.Context, batch Batch, anchored *anchoredBatch, first, total int) error {
+	if a == nil {
+		return nil
+	}
+	return a.insert(ctx, batch, anchored, newMerkleAuditRows(a.runID, batch, anchored, first, total))
+}
+
+func (a *auditTrail) insert(ctx context.Context, batch Batch, anchored *anchoredBatch, rows []AuditRow) error {
+	savers := make([]*bigquery.StructSaver, len(rows))
+	for i := range rows {
+		savers[i] = &bigquery.StructSaver{
+			Struct:   rows[i],
+			InsertID: auditInsertID(rows[i]),
+		}
+	}
+
+	err := config.retryPolicy().do(ctx, "writing audit rows", func() error {
+		table, err := bigQueryTable(a.client(), a.tableRef)
+		if err != nil {
+			return err
+		}
+		return table.Inserter().Put(ctx, savers)
+	})
+	if err != nil {
+		log.Printf("[%s] Failed to write audit rows for chunk %s: %v", anchored.Target, batch.Label(), err)
+		return err
+	}
+	return nil
+}
+
+// auditInsertID identifies a row by its transaction and its log, or its leaf for rows anchored through a root.
+func auditInsertID(row AuditRow) string {
+	if row.LeafIndex.Valid {
+		return fmt.Sprintf("%s:%s:leaf:%d", row.Target, row.TxHash, row.LeafIndex.Int64)
+	}
+	return fmt.Sprintf("%s:%s:%d", row.Target, row.TxHash, row.LogIndex.Int64)
+}
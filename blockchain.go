@@ -2,167 +2,331 @@ package main
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"log"
 	"math/big"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-type Transaction struct {
-	UserId                   string
-	Day                      *big.Int
-	Month                    *big.Int
-	Year                     *big.Int
-	AssetId                  string
-	TotalDuration            *big.Int
-	TotalRewardsConsumer     *big.Int
-	TotalRewardsContentOwner *big.Int
+// chainClient is the part of an RPC connection the job uses. It is satisfied by *ethclient.Client and lets the
+// tests run the same code against an in-process chain.
+type chainClient interface {
+	bind.ContractBackend
+	ethereum.ChainIDReader
+	ethereum.ChainStateReader
+	ethereum.TransactionReader
+	Close()
 }
 
-func addToBlockchain(jobs []JobDataRow) error {
-	client, err := ethclient.Dial(os.Getenv("RPC_URL"))
+// anchoredBatch is a batch confirmed on chain: the receipt of its transaction and what identifies the write.
+type anchoredBatch struct {
+	*types.Receipt
+	Target   string
+	Nonce    uint64
+	Signer   common.Address
+	Contract common.Address
+}
+
+// addToBlockchain anchors one batch on the target and returns the receipt of the confirmed transaction. A mined
+// transaction is returned together with the error when it failed or its receipt does not match the batch.
+func addToBlockchain(ctx context.Context, target *ChainTarget, batch Batch) (*anchoredBatch, error) {
+	client, err := target.Dial(ctx)
 	if err != nil {
-		log.Printf("Error connecting to Ethereum client: %v", err)
-		return err
+		return nil, err
 	}
+	defer client.Close()
 
-	key := os.Getenv("DEPLOYER_PRIVATE_KEY")
-	if strings.HasPrefix(key, "0x") {
-		key = key[2:]
+	var deployment *Deployment
+	var records *Records
+	err = config.retryPolicy().do(ctx, "binding the records contract", func() (err error) {
+		deployment, records, err = target.registry.BindActive(ctx, client, batch.Rows[0].CreatedAtDay)
+		return err
+	})
+	if err != nil {
+		log.Printf("[%s] Error binding records contract: %v", target.Name, err)
+		return nil, err
 	}
-	privateKey, err := crypto.HexToECDSA(key)
+
+	day := batch.Rows[0].CreatedAtDay.Format("2006-01-02")
+	pending, err := findPendingTx(target.Name, day, batch.Label())
 	if err != nil {
-		log.Printf("Error converting private key: %v", err)
-		return err
+		log.Printf("[%s] Error reading pending transactions: %v", target.Name, err)
+		return nil, err
 	}
 
-	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	anchored := &anchoredBatch{Target: target.Name, Signer: target.SignerAddress(), Contract: deployment.ContractAddress()}
+	if pending != nil {
+		anchored.Receipt, err = resumePendingTx(context.WithoutCancel(ctx), client, pending)
+		if err != nil {
+			log.Printf("[%s] Error waiting for pending transaction %s: %v", target.Name, pending.TxHash.Hex(), err)
+			return nil, err
+		}
+		anchored.Nonce = pending.Nonce
+	}
 
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
-	if err != nil {
-		return err
+	if anchored.Receipt == nil {
+		anchored.Receipt, anchored.Nonce, err = sendBatch(ctx, target, client, records, day, batch)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	gasPrice, err := client.SuggestGasPrice(context.Background())
-	if err != nil {
-		return err
+	receipt := anchored.Receipt
+	if receipt.Status == 1 {
+		log.Printf("[%s] Transaction successfully confirmed! Chunk: %s, Hash: %s, Contract: %s (%s)",
+			target.Name, batch.Label(), receipt.TxHash.Hex(), deployment.ContractAddress().Hex(), deployment.Name)
+	} else {
+		fmt.Printf("[%s] Transaction failed with status: %d, error: %v", target.Name, receipt.Status, err)
+		return anchored, fmt.Errorf("transaction failed with status: %d", receipt.Status)
 	}
 
-	chainID, err := client.NetworkID(context.Background())
-	if err != nil {
-		return err
+	if err := verifyReceiptLogs(records, deployment.ContractAddress(), batch, receipt); err != nil {
+		log.Printf("[%s] Receipt of chunk %s does not match the submitted rows: %v", target.Name, batch.Label(), err)
+		sendAlert("Batch verification failed", fmt.Sprintf("[%s] chunk %s, transaction %s: %v",
+			target.Name, batch.Label(), receipt.TxHash.Hex(), err))
+		return anchored, fmt.Errorf("receipt verification failed: %w", err)
 	}
 
-	contractAddress := common.HexToAddress(os.Getenv("CONTRACT_ADDRESS"))
-	parsedABI, err := abi.JSON(strings.NewReader(ABI))
-	if err != nil {
-		log.Printf("Error parsing ABI: %v", err)
+	return anchored, nil
+}
+
+// sendBatch sends the batchInsertRecords transaction of a batch, see sendSigned.
+func sendBatch(ctx context.Context, target *ChainTarget, client chainClient, records *Records, day string, batch Batch) (*types.Receipt, uint64, error) {
+	transactions := buildTransactions(batch.Rows)
+	return sendSigned(ctx, target, client, day, batch.Label(), func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return records.BatchInsertRecords(auth, transactions)
+	})
+}
+
+// sendSigned signs a transaction with sign, records it as pending under the day and chunk, broadcasts it and
+// waits for its receipt, which it returns with the nonce the transaction was sent with. Once the transaction is
+// broadcast the wait is no longer cut short by ctx: a shutdown lets it finish within its grace period, and the
+// pending record covers the case where it does not.
+//
+// Broadcast failures are handled by their class: transient ones resend the same transaction after a backoff,
+// a stale nonce re-signs with a fresh one, an underpriced transaction is re-signed with bumped fees, and
+// anything else fails the send.
+func sendSigned(ctx context.Context, target *ChainTarget, client chainClient, day, chunk string,
+	sign func(auth *bind.TransactOpts) (*types.Transaction, error)) (*types.Receipt, uint64, error) {
+	policy := config.retryPolicy()
+
+	var auth *bind.TransactOpts
+	err := policy.do(ctx, "preparing a transaction", func() (err error) {
+		auth, err = newTransactOpts(ctx, client, target.privateKey, target.Fees)
 		return err
+	})
+	if err != nil {
+		log.Printf("[%s] Error preparing transaction: %v", target.Name, err)
+		return nil, 0, err
 	}
+	auth.NoSend = true
 
-	contract := bind.NewBoundContract(contractAddress, parsedABI, client, client, client)
+	var tx *types.Transaction
+	for attempt := 1; ; attempt++ {
+		if tx == nil {
+			if tx, err = signPending(ctx, policy, target, auth, day, chunk, sign); err != nil {
+				return nil, 0, err
+			}
+		}
 
-	transactions := make([]Transaction, len(jobs))
-	for i, job := range jobs {
-		assetID := ""
-		if job.AssetID.Valid {
-			assetID = job.AssetID.StringVal
+		err = client.SendTransaction(ctx, tx)
+		if err == nil {
+			break
+		}
+		if isAlreadyKnown(err) {
+			log.Printf("[%s] Node already has transaction %s, waiting for it", target.Name, tx.Hash().Hex())
+			break
 		}
 
-		totalRewardsConsumerWei := ToWei(job.TotalRewardsConsumer)
-		totalRewardsContentOwnerWei := ToWei(job.TotalRewardsContentOwner)
+		class := classifyError(err)
+		log.Printf("[%s] Error sending transaction (%s, attempt %d of %d): %v", target.Name, class, attempt, policy.Attempts, err)
+		if class == classNonce {
+			// An earlier attempt that timed out may have reached the node after all.
+			if _, _, knownErr := client.TransactionByHash(ctx, tx.Hash()); knownErr == nil {
+				log.Printf("[%s] Transaction %s was received by an earlier attempt, waiting for it", target.Name, tx.Hash().Hex())
+				break
+			}
+		}
+		// A transaction that may have reached the node stays pending, so the next run checks on it before
+		// sending the chunk again.
+		if class != classTransient {
+			clearPendingTx(target.Name, tx.Hash())
+		}
+		if class == classFatal || attempt >= policy.Attempts {
+			return nil, 0, err
+		}
+		if sleepErr := policy.sleep(ctx, attempt); sleepErr != nil {
+			return nil, 0, err
+		}
 
-		transactions[i] = Transaction{
-			UserId:                   job.UserID,
-			Day:                      big.NewInt(int64(job.CreatedAtDay.Day())),
-			Month:                    big.NewInt(int64(job.CreatedAtDay.Month())),
-			Year:                     big.NewInt(int64(job.CreatedAtDay.Year())),
-			AssetId:                  assetID,
-			TotalDuration:            big.NewInt(job.TotalDuration),
-			TotalRewardsConsumer:     totalRewardsConsumerWei,
-			TotalRewardsContentOwner: totalRewardsContentOwnerWei,
+		switch class {
+		case classNonce:
+			var nonce uint64
+			err := policy.do(ctx, "fetching the nonce", func() (err error) {
+				nonce, err = client.PendingNonceAt(ctx, auth.From)
+				return err
+			})
+			if err != nil {
+				log.Printf("[%s] Error fetching nonce: %v", target.Name, err)
+				return nil, 0, err
+			}
+			auth.Nonce = new(big.Int).SetUint64(nonce)
+			tx = nil
+		case classFee:
+			auth.GasLimit = tx.Gas()
+			if err := policy.bumpFees(auth, target.Fees); err != nil {
+				log.Printf("[%s] Not raising fees further: %v", target.Name, err)
+				return nil, 0, err
+			}
+			tx = nil
 		}
 	}
 
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+	receipt, err := waitForConfirmation(context.WithoutCancel(ctx), client, tx.Hash())
 	if err != nil {
-		return err
+		log.Printf("[%s] Error waiting for transaction confirmation. Hash: %s, Error: %v", target.Name, tx.Hash().Hex(), err)
+		return nil, 0, err
 	}
-	auth.Nonce = big.NewInt(int64(nonce))
-	auth.Value = big.NewInt(0)
-	auth.GasPrice = gasPrice
 
-	callData, err := parsedABI.Pack("batchInsertRecords", transactions)
-	if err != nil {
-		log.Printf("Error packing transaction data: %v", err)
+	clearPendingTx(target.Name, tx.Hash())
+	return receipt, tx.Nonce(), nil
+}
+
+// signPending signs a transaction without sending it and records it as pending.
+func signPending(ctx context.Context, policy retryPolicy, target *ChainTarget, auth *bind.TransactOpts, day, chunk string,
+	sign func(auth *bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	var tx *types.Transaction
+	err := policy.do(ctx, "signing a transaction", func() (err error) {
+		tx, err = sign(auth)
 		return err
+	})
+	if err != nil {
+		log.Printf("[%s] Error signing transaction: %v", target.Name, err)
+		return nil, err
+	}
+
+	if tx == nil {
+		log.Printf("[%s] Returned transaction is null", target.Name)
+		return nil, fmt.Errorf("returned transaction is null")
 	}
 
-	msg := ethereum.CallMsg{
-		From:     fromAddress,
-		To:       &contractAddress,
-		GasPrice: gasPrice,
-		Value:    big.NewInt(0),
-		Data:     callData,
+	entry := pendingTx{Target: target.Name, Day: day, Chunk: chunk, TxHash: tx.Hash(), Nonce: tx.Nonce(), SentAt: time.Now()}
+	if err := rememberPendingTx(entry); err != nil {
+		log.Printf("[%s] Error recording pending transaction: %v", target.Name, err)
+		return nil, err
 	}
+	return tx, nil
+}
+
+// newTransactOpts prepares signing options with the pending nonce and gas pricing from the fee policy.
+// The gas limit is left at zero so the contract binding estimates it for each call.
+func newTransactOpts(ctx context.Context, client chainClient, privateKey *ecdsa.PrivateKey, fees FeePolicy) (*bind.TransactOpts, error) {
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
 
-	gasLimit, err := client.EstimateGas(context.Background(), msg)
+	nonce, err := client.PendingNonceAt(ctx, fromAddress)
 	if err != nil {
-		log.Printf("Error estimating gas limit: %v", err)
-		return err
+		return nil, err
 	}
 
-	auth.GasLimit = gasLimit
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	tx, err := contract.Transact(auth, "batchInsertRecords", transactions)
+	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
 	if err != nil {
-		log.Printf("Error sending transaction: %v", err)
-		return err
+		return nil, err
 	}
+	auth.Nonce = big.NewInt(int64(nonce))
+	auth.Value = big.NewInt(0)
+	auth.Context = ctx
 
-	if tx == nil {
-		log.Printf("Returned transaction is null")
-		return fmt.Errorf("returned transaction is null")
+	if err := fees.apply(ctx, client, auth); err != nil {
+		return nil, err
 	}
 
-	receipt, err := waitForConfirmation(client, tx.Hash())
+	return auth, nil
+}
+
+// loadPrivateKey parses the hex private key held in the named environment variable, with or without the 0x prefix.
+// When the variable is empty the key is read from the SECRET_NAME secret, see secretFallback.
+func loadPrivateKey(envName string) (*ecdsa.PrivateKey, error) {
+	key, err := secretFallback(envName)
 	if err != nil {
-		log.Printf("Error waiting for transaction confirmation. Hash: %s, Error: %v", tx.Hash().Hex(), err)
-		return err
+		return nil, err
+	}
+	if strings.HasPrefix(key, "0x") {
+		key = key[2:]
+	}
+	privateKey, err := crypto.HexToECDSA(key)
+	if err != nil {
+		log.Printf("Error converting private key from %s: %v", envName, err)
+		return nil, err
 	}
+	return privateKey, nil
+}
 
-	if receipt.Status == 1 {
-		log.Printf("Transaction successfully confirmed! Hash: %s", tx.Hash().Hex())
-	} else {
-		fmt.Printf("Transaction failed with status: %d, error: %v", receipt.Status, err)
-		return fmt.Errorf("transaction failed with status: %d", receipt.Status)
+// buildTransactions converts BigQuery rows into the tuples expected by batchInsertRecords.
+func buildTransactions(jobs []JobDataRow) []ReplayLibraryTransaction {
+	transactions := make([]ReplayLibraryTransaction, len(jobs))
+	for i, job := range jobs {
+		assetID := ""
+		if job.AssetID.Valid {
+			assetID = job.AssetID.StringVal
+		}
+
+		totalRewardsConsumerWei := ToWei(job.TotalRewardsConsumer)
+		totalRewardsContentOwnerWei := ToWei(job.TotalRewardsContentOwner)
+
+		transactions[i] = ReplayLibraryTransaction{
+			UserId:                   job.UserID,
+			Day:                      big.NewInt(int64(job.CreatedAtDay.Day())),
+			Month:                    big.NewInt(int64(job.CreatedAtDay.Month())),
+			Year:                     big.NewInt(int64(job.CreatedAtDay.Year())),
+			TotalDuration:            big.NewInt(job.TotalDuration),
+			TotalRewardsConsumer:     totalRewardsConsumerWei,
+			TotalRewardsContentOwner: totalRewardsContentOwnerWei,
+			AssetId:                  assetID,
+		}
 	}
 
-	return nil
+	return transactions
 }
 
-func waitForConfirmation(client *ethclient.Client, txHash common.Hash) (*types.Receipt, error) {
+// waitForConfirmation polls for the receipt of a transaction until it is mined or ctx is done. Transient errors
+// are tolerated until they fail as many consecutive polls as the retry policy allows attempts.
+func waitForConfirmation(ctx context.Context, client chainClient, txHash common.Hash) (*types.Receipt, error) {
+	policy := config.retryPolicy()
+	failures := 0
 	for {
-		receipt, err := client.TransactionReceipt(context.Background(), txHash)
-		if errors.Is(err, ethereum.NotFound) {
-			time.Sleep(time.Second * 2)
-			continue
-		} else if err != nil {
-			return nil, err
+		receipt, err := client.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			return receipt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			failures++
+			if classifyError(err) != classTransient || failures >= policy.Attempts {
+				return nil, err
+			}
+			log.Printf("Transient error polling for receipt %s (%d in a row): %v", txHash.Hex(), failures, err)
+		} else {
+			failures = 0
 		}
 
-		return receipt, nil
+		select {
+		case <-time.After(time.Second * 2):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 }
 
@@ -172,3 +336,9 @@ func ToWei(ethValue float64) *big.Int {
 	weiValue.Int(weiBigInt)
 	return weiBigInt
 }
+
+// FromWei formats a wei amount as a decimal ETH string.
+func FromWei(weiValue *big.Int) string {
+	ethValue := new(big.Float).Quo(new(big.Float).SetInt(weiValue), big.NewFloat(1e18))
+	return ethValue.Text('f', 6)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// defaultBatchSize is the largest number of rows sent in a single batchInsertRecords transaction unless
+// BATCH_SIZE says otherwise. Upstream chunks are expected to fit; a larger chunk is split into parts that share
+// its JOB_ID and CHUNK_ID.
+const defaultBatchSize = 50
+
+// Batch is the set of rows sent in one batchInsertRecords transaction. All rows belong to the same upstream
+// chunk and createdAtDay, so every on-chain transaction maps to exactly one (JOB_ID, CHUNK_ID) pair of one day.
+type Batch struct {
+	JobID   string
+	ChunkID int64
+	// Part numbers the pieces of a chunk larger than BATCH_SIZE, starting at 1; it is 0 for a whole chunk.
+	Part int
+	Rows []JobDataRow
+}
+
+// Label identifies the chunk a batch covers in logs and status reports.
+func (b Batch) Label() string {
+	if b.Part > 0 {
+		return fmt.Sprintf("%s:%d#%d", b.JobID, b.ChunkID, b.Part)
+	}
+	return fmt.Sprintf("%s:%d", b.JobID, b.ChunkID)
+}
+
+// chunkRange matches CHUNK_IDs from First to Last inclusive, optionally restricted to one JOB_ID.
+type chunkRange struct {
+	JobID string
+	First int64
+	Last  int64
+}
+
+// ChunkSelector is a list of chunk ranges written as comma separated entries of the form CHUNK, FIRST-LAST,
+// JOB_ID:CHUNK or JOB_ID:FIRST-LAST, for example "3,5-7,job-42:10".
+type ChunkSelector []chunkRange
+
+// ParseChunkSelector parses a chunk list; an empty string yields an empty selector.
+func ParseChunkSelector(value string) (ChunkSelector, error) {
+	var selector ChunkSelector
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var r chunkRange
+		chunks := entry
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			r.JobID = entry[:i]
+			chunks = entry[i+1:]
+		}
+
+		first, last, isRange := strings.Cut(chunks, "-")
+		var err error
+		if r.First, err = strconv.ParseInt(first, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid chunk %q", entry)
+		}
+		r.Last = r.First
+		if isRange {
+			if r.Last, err = strconv.ParseInt(last, 10, 64); err != nil || r.Last < r.First {
+				return nil, fmt.Errorf("invalid chunk range %q", entry)
+			}
+		}
+
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// Matches reports whether the chunk is covered by any range of the selector.
+func (s ChunkSelector) Matches(jobID string, chunkID int64) bool {
+	for _, r := range s {
+		if (r.JobID == "" || r.JobID == jobID) && chunkID >= r.First && chunkID <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// sameChunk reports whether two rows belong to the same chunk of the same day.
+func sameChunk(a, b JobDataRow) bool {
+	return a.JobID == b.JobID && a.ChunkID == b.ChunkID && a.CreatedAtDay.Equal(b.CreatedAtDay)
+}
+
+// chunkBatcher groups rows arriving in day, JOB_ID, CHUNK_ID order into one batch per chunk and hands each batch to
+// emit as soon as the chunk is complete, so only one chunk is held in memory. When only is not empty just the
+// chunks it matches are selected, and chunks matched by skip never are, see Selects.
+type chunkBatcher struct {
+	only  ChunkSelector
+	skip  ChunkSelector
+	emit  func(Batch)
+	chunk []JobDataRow
+	// skipping is the first row of the last skipped chunk, so each skipped chunk is logged once.
+	skipping *JobDataRow
+}
+
+// Selects reports whether the row's chunk is selected by only and skip. Rows of other chunks must not be added,
+// nor validated, since the run leaves them alone.
+func (b *chunkBatcher) Selects(row JobDataRow) bool {
+	jobID, chunkID := row.JobID, int64(row.ChunkID)
+	if len(b.only) > 0 && !b.only.Matches(jobID, chunkID) {
+		return false
+	}
+	if b.skip.Matches(jobID, chunkID) {
+		if b.skipping == nil || !sameChunk(*b.skipping, row) {
+			log.Printf("Skipping chunk %s:%d", jobID, chunkID)
+			b.skipping = &row
+		}
+		return false
+	}
+	return true
+}
+
+// Add appends a row, emitting the previous chunk when the row starts a new one.
+func (b *chunkBatcher) Add(row JobDataRow) {
+	if len(b.chunk) > 0 && !sameChunk(b.chunk[0], row) {
+		b.Flush()
+	}
+	b.chunk = append(b.chunk, row)
+}
+
+// Flush emits the chunk being collected, if any.
+func (b *chunkBatcher) Flush() {
+	chunk := b.chunk
+	b.chunk = nil
+	if len(chunk) == 0 {
+		return
+	}
+	jobID, chunkID := chunk[0].JobID, int64(chunk[0].ChunkID)
+
+	batchSize := config.Run.BatchSize
+	if len(chunk) <= batchSize {
+		b.emit(Batch{JobID: jobID, ChunkID: chunkID, Rows: chunk})
+		return
+	}
+
+	log.Printf("Chunk %s:%d has %d rows, splitting it into batches of %d", jobID, chunkID, len(chunk), batchSize)
+	for part, start := 1, 0; start < len(chunk); part, start = part+1, start+batchSize {
+		end := min(start+batchSize, len(chunk))
+		b.emit(Batch{JobID: jobID, ChunkID: chunkID, Part: part, Rows: chunk[start:end]})
+	}
+}
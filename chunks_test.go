@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChunkSelector(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ChunkSelector
+		err   string
+	}{
+		{value: "", want: nil},
+		{value: " , ", want: nil},
+		{value: "3", want: ChunkSelector{{First: 3, Last: 3}}},
+		{value: "3,5-7", want: ChunkSelector{{First: 3, Last: 3}, {First: 5, Last: 7}}},
+		{value: " 4 , 6 ", want: ChunkSelector{{First: 4, Last: 4}, {First: 6, Last: 6}}},
+		{value: "job-42:10", want: ChunkSelector{{JobID: "job-42", First: 10, Last: 10}}},
+		{value: "job-42:1-3,9", want: ChunkSelector{{JobID: "job-42", First: 1, Last: 3}, {First: 9, Last: 9}}},
+		{value: "a:b:5", want: ChunkSelector{{JobID: "a:b", First: 5, Last: 5}}},
+		{value: "5-5", want: ChunkSelector{{First: 5, Last: 5}}},
+		{value: "x", err: `invalid chunk "x"`},
+		{value: "3,x", err: `invalid chunk "x"`},
+		{value: "job-1:", err: `invalid chunk "job-1:"`},
+		{value: "-3", err: `invalid chunk "-3"`},
+		{value: "5-", err: `invalid chunk range "5-"`},
+		{value: "7-5", err: `invalid chunk range "7-5"`},
+		{value: "1-2-3", err: `invalid chunk range "1-2-3"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseChunkSelector(test.value)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("ParseChunkSelector(%q) error = %v, want %s", test.value, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseChunkSelector(%q): %v", test.value, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseChunkSelector(%q) = %+v, want %+v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestChunkSelectorMatches(t *testing.T) {
+	selector, err := ParseChunkSelector("3,5-7,job-42:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		jobID   string
+		chunkID int64
+		want    bool
+	}{
+		{"job-1", 3, true},
+		{"job-1", 4, false},
+		{"job-1", 5, true},
+		{"job-1", 7, true},
+		{"job-1", 8, false},
+		{"job-42", 10, true},
+		{"job-1", 10, false},
+	}
+	for _, test := range tests {
+		if got := selector.Matches(test.jobID, test.chunkID); got != test.want {
+			t.Errorf("Matches(%s, %d) = %v, want %v", test.jobID, test.chunkID, got, test.want)
+		}
+	}
+}
+
+func TestChunkBatcherSelectsAndSplitsChunks(t *testing.T) {
+	t.Setenv("BATCH_SIZE", "2")
+	useEnvSettings(t)
+	only, _ := ParseChunkSelector("1-3")
+	skip, _ := ParseChunkSelector("2")
+
+	var labels []string
+	batcher := &chunkBatcher{only: only, skip: skip, emit: func(batch Batch) {
+		labels = append(labels, batch.Label())
+	}}
+	for _, row := range []JobDataRow{
+		testRow("job-1", 1, "user-a", "asset-1", 1, 1, 1),
+		testRow("job-1", 2, "user-a", "asset-1", 1, 1, 1),
+		testRow("job-1", 3, "user-a", "asset-1", 1, 1, 1),
+		testRow("job-1", 3, "user-b", "asset-1", 1, 1, 1),
+		testRow("job-1", 3, "user-c", "asset-1", 1, 1, 1),
+		testRow("job-1", 4, "user-a", "asset-1", 1, 1, 1),
+	} {
+		if batcher.Selects(row) {
+			batcher.Add(row)
+		}
+	}
+	batcher.Flush()
+
+	if got, want := strings.Join(labels, ","), "job-1:1,job-1:3#1,job-1:3#2"; got != want {
+		t.Errorf("batches %s, want %s", got, want)
+	}
+}
@@ -3,104 +3,184 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
-	"github.com/bytedance/sonic"
 	"google.golang.org/api/option"
 )
 
 // GetBigQueryClient connects with AWS Secrets Manager to retrieve the PEM files for JWT and creates a BigQuery client.
 func GetBigQueryClient(secretName string) (*bigquery.Client, error) {
-	projectID, err := GetSecret(secretName, "bigquery_project_id")
+	client, _, err := newBigQueryClient(secretName, secretCurrent)
+	return client, err
+}
+
+// newBigQueryClient creates a BigQuery client with the credentials of a stage of the secret, returning the
+// version they came from.
+func newBigQueryClient(secretName, stage string) (*bigquery.Client, string, error) {
+	bundle, err := secrets.Bundle(secretName, stage)
 	if err != nil {
+		log.Println("Fatal Error: Unable to retrieve the BigQuery credentials from AWS Secrets Manager")
+		return nil, "", err
+	}
+	projectID, ok := bundle.values["bigquery_project_id"]
+	if !ok {
 		log.Println("Fatal Error: Unable to retrieve 'bigquery_project_id' from AWS Secrets Manager")
-		return nil, err
+		return nil, "", fmt.Errorf("secret key 'bigquery_project_id' not found")
 	}
-
-	bigQueryPemStr, err := GetSecret(secretName, "bigquery_project_secret_pem")
-	if err != nil {
+	bigQueryPemStr, ok := bundle.values["bigquery_project_secret_pem"]
+	if !ok {
 		log.Println("Fatal Error: Unable to retrieve 'bigquery_project_secret_pem' from AWS Secrets Manager")
-		return nil, err
+		return nil, "", fmt.Errorf("secret key 'bigquery_project_secret_pem' not found")
 	}
 
 	ctx := context.Background()
 	client, err := bigquery.NewClient(ctx, projectID, option.WithCredentialsJSON([]byte(bigQueryPemStr)))
 	if err != nil {
 		log.Println("Fatal Error: Unable to initialize BigQuery client")
-		return nil, err
+		return nil, "", err
 	}
 
-	return client, nil
+	return client, bundle.VersionID, nil
 }
 
-// GetSecret retrieves a specific secret value from AWS Secrets Manager.
+// GetSecret retrieves a specific secret value from AWS Secrets Manager, through the cache of secrets.
 func GetSecret(secretName, secretKey string) (string, error) {
-	svc, err := CreateSecretsManagerSession()
-	if err != nil {
-		log.Println("Fatal Error: Unable to create a session for AWS Secrets Manager")
-		return "", err
+	return secrets.Get(secretName, secretKey)
+}
+
+// secretsManagerConfig says where and as whom the secrets are read.
+type secretsManagerConfig struct {
+	// Regions are tried in order: AWS_REGION (us-east-1 by default), then SECRETS_MANAGER_FALLBACK_REGIONS, a
+	// comma separated list of regions the secret is replicated to.
+	Regions []string
+	// Endpoint replaces the AWS endpoint, e.g. http://localhost:4566 for LocalStack (SECRETS_MANAGER_ENDPOINT).
+	Endpoint string
+	// Profile selects a profile of the shared AWS config and credentials files (AWS_PROFILE).
+	Profile string
+	// RoleARN is a role assumed through STS before reading the secrets (SECRETS_ROLE_ARN).
+	RoleARN string
+}
+
+func (s *Settings) secretsManagerConfig() secretsManagerConfig {
+	manager := secretsManagerConfig{
+		Regions:  []string{s.AWS.Region},
+		Endpoint: s.AWS.Endpoint,
+		Profile:  s.AWS.Profile,
+		RoleARN:  s.AWS.RoleARN,
+	}
+	for _, region := range s.AWS.FallbackRegions {
+		if !slices.Contains(manager.Regions, region) {
+			manager.Regions = append(manager.Regions, region)
+		}
 	}
+	return manager
+}
 
+// fetchSecretVersion reads a stage of a secret and its version ID, moving on to the next region while Secrets
+// Manager is unreachable or failing in the previous one. Other errors, such as a missing secret or a denied
+// access, are returned at once: another region would give the same answer.
+func fetchSecretVersion(secretName, stage string) (string, string, error) {
+	manager := config.secretsManagerConfig()
 	input := &secretsmanager.GetSecretValueInput{
 		SecretId:     aws.String(secretName),
-		VersionStage: aws.String("AWSCURRENT"),
+		VersionStage: aws.String(stage),
 	}
 
-	result, err := svc.GetSecretValue(input)
-	if err != nil {
-		log.Println("Fatal Error: Unable to retrieve secret value from AWS Secrets Manager")
-		return "", err
-	}
+	var errs []error
+	for _, region := range manager.Regions {
+		svc, err := CreateSecretsManagerSession(region)
+		if err != nil {
+			log.Println("Fatal Error: Unable to create a session for AWS Secrets Manager")
+			return "", "", err
+		}
 
-	var secretString string
-	var secretData map[string]interface{}
+		result, err := svc.GetSecretValue(input)
+		if err != nil {
+			if !secretsManagerUnavailable(err) {
+				log.Println("Fatal Error: Unable to retrieve secret value from AWS Secrets Manager")
+				return "", "", err
+			}
+			log.Printf("Secrets Manager unavailable in %s: %v", region, err)
+			errs = append(errs, fmt.Errorf("%s: %w", region, err))
+			continue
+		}
 
-	if result.SecretString != nil {
-		secretString = *result.SecretString
-	} else {
+		versionID := aws.StringValue(result.VersionId)
+		if result.SecretString != nil {
+			return *result.SecretString, versionID, nil
+		}
 		decodedBinarySecretBytes := make([]byte, base64.StdEncoding.DecodedLen(len(result.SecretBinary)))
 		length, err := base64.StdEncoding.Decode(decodedBinarySecretBytes, result.SecretBinary)
 		if err != nil {
 			log.Println("Fatal Error: Unable to decode binary secret from AWS Secrets Manager")
-			return "", err
+			return "", "", err
 		}
-		secretString = string(decodedBinarySecretBytes[:length])
+		return string(decodedBinarySecretBytes[:length]), versionID, nil
 	}
+	log.Println("Fatal Error: Unable to retrieve secret value from AWS Secrets Manager")
+	return "", "", errors.Join(errs...)
+}
 
-	if err := sonic.Unmarshal([]byte(secretString), &secretData); err != nil {
-		log.Println("Fatal Error: Unable to unmarshal secret data from AWS Secrets Manager")
-		return "", err
+// secretsManagerUnavailable reports whether a Secrets Manager error is a failure of the region rather than an
+// answer about the secret.
+func secretsManagerUnavailable(err error) bool {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) && isTransientStatus(requestFailure.StatusCode()) {
+		return true
 	}
-
-	secretValue, ok := secretData[secretKey].(string)
-	if !ok {
-		log.Printf("Fatal Error: Secret key '%s' not found in AWS Secrets Manager response", secretKey)
-		return "", fmt.Errorf("secret key '%s' not found", secretKey)
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case request.ErrCodeRequestError, request.ErrCodeResponseTimeout, "RequestTimeout",
+			secretsmanager.ErrCodeInternalServiceError, "ServiceUnavailable", "ThrottlingException":
+			return true
+		}
 	}
-
-	return secretValue, nil
+	return classifyError(err) == classTransient
 }
 
-// CreateSecretsManagerSession creates a session for AWS Secrets Manager.
-func CreateSecretsManagerSession() (*secretsmanager.SecretsManager, error) {
-	sess, err := CreateAWSSession()
+// CreateSecretsManagerSession creates a Secrets Manager client for the region, using the endpoint, profile and
+// role of the settings.
+func CreateSecretsManagerSession(region string) (*secretsmanager.SecretsManager, error) {
+	manager := config.secretsManagerConfig()
+	sess, err := CreateAWSSession(region, manager)
 	if err != nil {
 		log.Println("Fatal Error: Unable to create AWS session")
 		return nil, err
 	}
+	if manager.RoleARN != "" {
+		return secretsmanager.New(sess, &aws.Config{Credentials: stscreds.NewCredentials(sess, manager.RoleARN)}), nil
+	}
 	return secretsmanager.New(sess), nil
 }
 
-// CreateAWSSession creates and returns an AWS session configured for the 'us-east-1' region.
-func CreateAWSSession() (*session.Session, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1"),
-	})
+// defaultAWSRegion is the Secrets Manager region used when AWS_REGION is not set.
+const defaultAWSRegion = "us-east-1"
+
+// CreateAWSSession creates and returns an AWS session for the region with the endpoint and profile of manager.
+// Requests are retried RETRY_ATTEMPTS times in all, before fetchSecretVersion moves on to the next region.
+func CreateAWSSession(region string, manager secretsManagerConfig) (*session.Session, error) {
+	options := session.Options{
+		Config:  aws.Config{Region: aws.String(region), MaxRetries: aws.Int(config.retryPolicy().Attempts - 1)},
+		Profile: manager.Profile,
+	}
+	if manager.Endpoint != "" {
+		options.Config.Endpoint = aws.String(manager.Endpoint)
+	}
+	if manager.Profile != "" {
+		options.SharedConfigState = session.SharedConfigEnable
+	}
+	sess, err := session.NewSessionWithOptions(options)
 	if err != nil {
 		log.Println("Fatal Error: Unable to create AWS session")
 	}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum/core/types"
+	"google.golang.org/api/iterator"
+)
+
+const reportUsage = `usage: replay-bigquery-job report [-from DAY] [-to DAY] [-by day|run|batch|asset] [-format csv|json]
+                            [-price PRICE] [-price-file PATH] [-currency CODE] [-out PATH]
+
+Reports the gas spent anchoring the days from -from to -to (the previous calendar month by default), read from
+AUDIT_TABLE. Costs are in the native token of each target; with a price they are also converted to fiat.`
+
+// receiptFee is what a transaction cost: gasUsed × effectiveGasPrice, in wei. It is zero when the node did not
+// report the effective gas price.
+func receiptFee(receipt *types.Receipt) *big.Int {
+	if receipt == nil || receipt.EffectiveGasPrice == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice)
+}
+
+// splitFee apportions a fee equally over n rows. The remainder of the division goes to the first rows, one wei
+// each, so the shares always add up to the fee.
+func splitFee(fee *big.Int, n int) []*big.Int {
+	shares := make([]*big.Int, n)
+	for i := range shares {
+		shares[i] = feeShare(fee, n, i)
+	}
+	return shares
+}
+
+// feeShare is the share of the i-th of n rows in fee, as splitFee assigns it.
+func feeShare(fee *big.Int, n, i int) *big.Int {
+	share, remainder := new(big.Int).QuoRem(fee, big.NewInt(int64(n)), new(big.Int))
+	if int64(i) < remainder.Int64() {
+		share.Add(share, big.NewInt(1))
+	}
+	return share
+}
+
+// fiatPrices converts native token amounts to fiat. Prices are looked up by target and day, then by target, then
+// the default price applies.
+type fiatPrices struct {
+	Currency string
+	fallback *float64
+	byTarget map[string]float64
+	byDay    map[string]float64
+}
+
+// loadFiatPrices builds the price input from spec (GAS_TOKEN_PRICE): either one price for every target, e.g.
+// "0.52", or per target, e.g. "polygon=0.52,mainnet=2400". file (GAS_TOKEN_PRICE_FILE) optionally adds daily
+// prices, as CSV lines "target,day,price" where an empty target applies to every target.
+func loadFiatPrices(spec, file, currency string) (fiatPrices, error) {
+	prices := fiatPrices{Currency: currency, byTarget: map[string]float64{}, byDay: map[string]float64{}}
+	if prices.Currency == "" {
+		prices.Currency = "USD"
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, priceStr, perTarget := strings.Cut(entry, "=")
+		if !perTarget {
+			priceStr = target
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
+		if err != nil || price < 0 {
+			return prices, fmt.Errorf("invalid price %q", entry)
+		}
+		if perTarget {
+			prices.byTarget[strings.TrimSpace(target)] = price
+		} else {
+			prices.fallback = &price
+		}
+	}
+
+	if file == "" {
+		return prices, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return prices, err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return prices, fmt.Errorf("reading %s: %w", file, err)
+		}
+		if _, err := time.Parse("2006-01-02", record[1]); err != nil {
+			return prices, fmt.Errorf("%s: invalid day %q", file, record[1])
+		}
+		price, err := strconv.ParseFloat(record[2], 64)
+		if err != nil || price < 0 {
+			return prices, fmt.Errorf("%s: invalid price %q", file, record[2])
+		}
+		prices.byDay[record[0]+"/"+record[1]] = price
+	}
+	return prices, nil
+}
+
+// price returns the fiat price of one native token of the target on day.
+func (p fiatPrices) price(target, day string) (float64, bool) {
+	for _, key := range []string{target + "/" + day, "/" + day} {
+		if price, ok := p.byDay[key]; ok {
+			return price, true
+		}
+	}
+	if price, ok := p.byTarget[target]; ok {
+		return price, true
+	}
+	if p.fallback != nil {
+		return *p.fallback, true
+	}
+	return 0, false
+}
+
+// toFiat converts a wei amount at the given price.
+func toFiat(wei *big.Int, price float64) *big.Float {
+	amount := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18))
+	return amount.Mul(amount, big.NewFloat(price))
+}
+
+// costLine is one line of a gas cost report.
+type costLine struct {
+	Target  string `json:"target"`
+	Key     string `json:"key"`
+	Batches int64  `json:"batches"`
+	Rows    int64  `json:"rows"`
+	FeeWei  string `json:"feeWei"`
+	Fee     string `json:"fee"`
+	// Fiat is empty when no price covers every day of the line.
+	Fiat     string `json:"fiat,omitempty"`
+	Currency string `json:"currency,omitempty"`
+
+	fee  *big.Int
+	fiat *big.Float
+}
+
+// costRow is the fee of one group on one day, as read from the audit table.
+type costRow struct {
+	Target  string `bigquery:"target"`
+	Key     string `bigquery:"key"`
+	Day     string `bigquery:"day"`
+	Batches int64  `bigquery:"batches"`
+	Rows    int64  `bigquery:"rowCount"`
+	FeeWei  string `bigquery:"feeWei"`
+}
+
+// reportGroups maps the -by values to the audit table expression grouped on.
+var reportGroups = map[string]string{
+	"day":   "FORMAT_DATE('%F', day)",
+	"run":   "runId",
+	"batch": "txHash",
+	"asset": "IFNULL(assetId, '')",
+}
+
+// runReport prints the gas cost report.
+func runReport(ctx context.Context, args []string, secretName string) error {
+	now := time.Now()
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), reportUsage) }
+	from := flags.String("from", firstOfMonth.AddDate(0, -1, 0).Format("2006-01-02"), "first day to report (YYYY-MM-DD)")
+	to := flags.String("to", firstOfMonth.AddDate(0, 0, -1).Format("2006-01-02"), "last day to report (YYYY-MM-DD)")
+	by := flags.String("by", "day", "group costs by day, run, batch or asset")
+	format := flags.String("format", "csv", "output format, csv or json")
+	priceSpec := flags.String("price", config.Costs.GasTokenPrice, "fiat price of the native token, e.g. 0.52 or polygon=0.52,mainnet=2400")
+	priceFile := flags.String("price-file", config.Costs.GasTokenPriceFile, "CSV of daily prices: target,day,price")
+	currency := flags.String("currency", config.Costs.FiatCurrency, "fiat currency code, USD by default")
+	out := flags.String("out", "", "write the report to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fromDay, err := civil.ParseDate(*from)
+	if err != nil {
+		return fmt.Errorf("invalid -from %q: %w", *from, err)
+	}
+	toDay, err := civil.ParseDate(*to)
+	if err != nil {
+		return fmt.Errorf("invalid -to %q: %w", *to, err)
+	}
+	group, ok := reportGroups[*by]
+	if !ok {
+		return fmt.Errorf("invalid -by %q, expected day, run, batch or asset", *by)
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("invalid -format %q, expected csv or json", *format)
+	}
+	prices, err := loadFiatPrices(*priceSpec, *priceFile, *currency)
+	if err != nil {
+		return err
+	}
+
+	tableRef := config.BigQuery.AuditTable
+	if tableRef == "" {
+		return fmt.Errorf("AUDIT_TABLE is not set")
+	}
+	client, err := GetBigQueryClient(secretName)
+	if err != nil {
+		log.Println("Failed to create BigQuery client: ", err)
+		return err
+	}
+	defer client.Close()
+	table, err := bigQueryTable(client, tableRef)
+	if err != nil {
+		return err
+	}
+
+	query := client.Query(fmt.Sprintf(`
+		SELECT
+			target,
+			%s AS key,
+			FORMAT_DATE('%%F', day) AS day,
+			COUNT(DISTINCT txHash) AS batches,
+			COUNT(*) AS rowCount,
+			CAST(SUM(CAST(feeWei AS BIGNUMERIC)) AS STRING) AS feeWei
+		FROM
+			%s
+		WHERE
+			day BETWEEN @from AND @to AND feeWei IS NOT NULL
+		GROUP BY
+			target, key, day
+		ORDER BY
+			target, key, day
+	`, group, fmt.Sprintf("`%s.%s.%s`", table.ProjectID, table.DatasetID, table.TableID)))
+	query.Parameters = []bigquery.QueryParameter{{Name: "from", Value: fromDay}, {Name: "to", Value: toDay}}
+
+	var rows *bigquery.RowIterator
+	err = config.retryPolicy().do(ctx, "reading the audit table", func() (err error) {
+		rows, err = query.Read(ctx)
+		return err
+	})
+	if err != nil {
+		log.Println("Failed to query the audit table: ", err)
+		return err
+	}
+	var costRows []costRow
+	for {
+		var row costRow
+		err := rows.Next(&row)
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		costRows = append(costRows, row)
+	}
+
+	lines, err := aggregateCosts(costRows, prices)
+	if err != nil {
+		return err
+	}
+
+	output := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+	if *format == "json" {
+		return writeCostJSON(output, lines)
+	}
+	return writeCostCSV(output, lines)
+}
+
+// aggregateCosts sums the daily rows of every group into report lines, converting each day at its own price,
+// and appends a total line per target.
+func aggregateCosts(rows []costRow, prices fiatPrices) ([]costLine, error) {
+	var lines []costLine
+	totals := map[string]*costLine{}
+	var targets []string
+	add := func(line *costLine, row costRow, fee *big.Int) {
+		line.Batches += row.Batches
+		line.Rows += row.Rows
+		line.fee.Add(line.fee, fee)
+		if price, ok := prices.price(row.Target, row.Day); ok && line.fiat != nil {
+			line.fiat.Add(line.fiat, toFiat(fee, price))
+		} else {
+			line.fiat = nil
+		}
+	}
+
+	for _, row := range rows {
+		fee, ok := new(big.Int).SetString(row.FeeWei, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid fee %q for %s on %s", row.FeeWei, row.Key, row.Day)
+		}
+		if len(lines) == 0 || lines[len(lines)-1].Target != row.Target || lines[len(lines)-1].Key != row.Key {
+			lines = append(lines, costLine{Target: row.Target, Key: row.Key, fee: new(big.Int), fiat: new(big.Float)})
+		}
+		add(&lines[len(lines)-1], row, fee)
+
+		total, ok := totals[row.Target]
+		if !ok {
+			total = &costLine{Target: row.Target, Key: "total", fee: new(big.Int), fiat: new(big.Float)}
+			totals[row.Target] = total
+			targets = append(targets, row.Target)
+		}
+		add(total, row, fee)
+	}
+
+	sort.Strings(targets)
+	for _, target := range targets {
+		lines = append(lines, *totals[target])
+	}
+	for i := range lines {
+		lines[i].FeeWei = lines[i].fee.String()
+		lines[i].Fee = FromWei(lines[i].fee)
+		if lines[i].fiat != nil {
+			lines[i].Fiat = lines[i].fiat.Text('f', 4)
+			lines[i].Currency = prices.Currency
+		}
+	}
+	return lines, nil
+}
+
+func writeCostCSV(w io.Writer, lines []costLine) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"target", "key", "batches", "rows", "feeWei", "fee", "fiat", "currency"})
+	for _, line := range lines {
+		writer.Write([]string{line.Target, line.Key, strconv.FormatInt(line.Batches, 10), strconv.FormatInt(line.Rows, 10),
+			line.FeeWei, line.Fee, line.Fiat, line.Currency})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeCostJSON(w io.Writer, lines []costLine) error {
+	if lines == nil {
+		lines = []costLine{}
+	}
+	data, err := sonic.ConfigStd.MarshalIndent(lines, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
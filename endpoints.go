@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// RPCEndpoint is one node serving a chain target.
+type RPCEndpoint struct {
+	URL string `json:"url"`
+	// Priority orders the healthy endpoints, lowest first; endpoints of equal priority are ordered by latency.
+	Priority int `json:"priority"`
+}
+
+// parseRPCURLs turns a comma separated list of URLs into endpoints prioritised in the order they are listed.
+func parseRPCURLs(list string) []RPCEndpoint {
+	var endpoints []RPCEndpoint
+	for _, rpcURL := range strings.Split(list, ",") {
+		if rpcURL = strings.TrimSpace(rpcURL); rpcURL != "" {
+			endpoints = append(endpoints, RPCEndpoint{URL: rpcURL, Priority: len(endpoints)})
+		}
+	}
+	return endpoints
+}
+
+// preferredEndpoint returns the endpoint of the target with the lowest priority, or nil when it has none.
+func (t *ChainTarget) preferredEndpoint() *RPCEndpoint {
+	var preferred *RPCEndpoint
+	for i := range t.Endpoints {
+		if preferred == nil || t.Endpoints[i].Priority < preferred.Priority {
+			preferred = &t.Endpoints[i]
+		}
+	}
+	return preferred
+}
+
+// redactURL keeps the scheme and host of an endpoint URL, since paths and query strings often carry API keys.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return "endpoint"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// healthPolicy decides which endpoints are fit to use.
+type healthPolicy struct {
+	// MaxHeadLag is how many blocks an endpoint may trail the most advanced one (RPC_MAX_HEAD_LAG, default 5).
+	MaxHeadLag uint64
+	// MaxHeadAge rejects endpoints whose latest block is older than this; 0 disables the check
+	// (RPC_MAX_HEAD_AGE, default 0).
+	MaxHeadAge time.Duration
+	// Timeout bounds the probe of one endpoint (RPC_PROBE_TIMEOUT, default 10s).
+	Timeout time.Duration
+}
+
+// healthPolicy returns the RPC health settings, with the defaults for those left unset.
+func (s *Settings) healthPolicy() healthPolicy {
+	policy := healthPolicy{MaxHeadLag: 5, MaxHeadAge: s.RPCHealth.MaxHeadAge, Timeout: 10 * time.Second}
+	if s.RPCHealth.MaxHeadLag != nil {
+		policy.MaxHeadLag = *s.RPCHealth.MaxHeadLag
+	}
+	if s.RPCHealth.ProbeTimeout > 0 {
+		policy.Timeout = s.RPCHealth.ProbeTimeout
+	}
+	return policy
+}
+
+// endpointProbe is the state of an endpoint when the target was dialled.
+type endpointProbe struct {
+	endpoint RPCEndpoint
+	client   chainClient
+	chainID  *big.Int
+	head     *types.Header
+	latency  time.Duration
+	err      error
+}
+
+// probeEndpoint connects to an endpoint and reads its chain ID and latest header, timing the round trips.
+func probeEndpoint(ctx context.Context, endpoint RPCEndpoint, timeout time.Duration) *endpointProbe {
+	probe := &endpointProbe{endpoint: endpoint}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	client, err := dialRPC(ctx, endpoint.URL)
+	if err != nil {
+		probe.err = err
+		return probe
+	}
+	if probe.chainID, err = client.ChainID(ctx); err == nil {
+		probe.head, err = client.HeaderByNumber(ctx, nil)
+	}
+	if err != nil {
+		client.Close()
+		probe.err = err
+		return probe
+	}
+	probe.client = client
+	probe.latency = time.Since(start)
+	return probe
+}
+
+// dialEndpoints probes every endpoint of the target and returns a client over the healthy ones, best first.
+// Endpoints are healthy when they serve the target's chain (or, without a configured chain ID, the chain of
+// the best reachable endpoint), trail the most advanced endpoint by at most MaxHeadLag blocks and, when
+// MaxHeadAge is set, have produced a block recently.
+func (t *ChainTarget) dialEndpoints(ctx context.Context) (chainClient, error) {
+	policy := config.healthPolicy()
+
+	probes := make([]*endpointProbe, len(t.Endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range t.Endpoints {
+		wg.Add(1)
+		go func(i int, endpoint RPCEndpoint) {
+			defer wg.Done()
+			probes[i] = probeEndpoint(ctx, endpoint, policy.Timeout)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	sort.SliceStable(probes, func(i, j int) bool {
+		if probes[i].endpoint.Priority != probes[j].endpoint.Priority {
+			return probes[i].endpoint.Priority < probes[j].endpoint.Priority
+		}
+		return probes[i].latency < probes[j].latency
+	})
+
+	expected := big.NewInt(t.ChainID)
+	if t.ChainID == 0 {
+		expected = nil
+	}
+	var bestHead uint64
+	for _, probe := range probes {
+		if probe.err != nil {
+			continue
+		}
+		if expected == nil {
+			expected = probe.chainID
+		}
+		if probe.chainID.Cmp(expected) != 0 {
+			probe.err = fmt.Errorf("serves chain %s, expected %s", probe.chainID, expected)
+			continue
+		}
+		bestHead = max(bestHead, probe.head.Number.Uint64())
+	}
+
+	var healthy []*endpointProbe
+	var problems []error
+	for _, probe := range probes {
+		if probe.err == nil {
+			head := probe.head.Number.Uint64()
+			age := time.Since(time.Unix(int64(probe.head.Time), 0))
+			switch {
+			case bestHead-head > policy.MaxHeadLag:
+				probe.err = fmt.Errorf("head %d is %d blocks behind", head, bestHead-head)
+			case policy.MaxHeadAge > 0 && age > policy.MaxHeadAge:
+				probe.err = fmt.Errorf("latest block is %s old", age.Round(time.Second))
+			}
+		}
+		if probe.err != nil {
+			if probe.client != nil {
+				probe.client.Close()
+			}
+			log.Printf("[%s] RPC endpoint %s is unhealthy: %v", t.Name, redactURL(probe.endpoint.URL), probe.err)
+			problems = append(problems, fmt.Errorf("%s: %w", redactURL(probe.endpoint.URL), probe.err))
+			continue
+		}
+		healthy = append(healthy, probe)
+	}
+
+	if len(healthy) == 0 {
+		return nil, errors.Join(append([]error{fmt.Errorf("chain target %q: no healthy RPC endpoint", t.Name)}, problems...)...)
+	}
+	if len(problems) > 0 {
+		log.Printf("[%s] Using %d of %d RPC endpoints, %s first", t.Name, len(healthy), len(probes), redactURL(healthy[0].endpoint.URL))
+	}
+	t.healthy = make([]RPCEndpoint, len(healthy))
+	for i, probe := range healthy {
+		t.healthy[i] = probe.endpoint
+	}
+	return &failoverClient{target: t.Name, members: healthy}, nil
+}
+
+// dialHealthy connects to the endpoints that passed the last probe, keeping their order, without probing them
+// again. It returns nil when none of them can be dialled.
+func (t *ChainTarget) dialHealthy(ctx context.Context) *failoverClient {
+	var members []*endpointProbe
+	for _, endpoint := range t.healthy {
+		client, err := dialRPC(ctx, endpoint.URL)
+		if err != nil {
+			log.Printf("[%s] RPC endpoint %s is unreachable: %v", t.Name, redactURL(endpoint.URL), err)
+			continue
+		}
+		members = append(members, &endpointProbe{endpoint: endpoint, client: client})
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return &failoverClient{target: t.Name, members: members}
+}
+
+// failoverClient routes calls to the healthiest endpoint and moves on to the next one when a call fails with a
+// transient error, staying there for the following calls. Signed transactions are broadcast to every endpoint.
+type failoverClient struct {
+	target  string
+	members []*endpointProbe
+
+	mu      sync.Mutex
+	current int
+}
+
+// failover runs call against the current endpoint, then the others in order while it fails transiently.
+func failover[T any](c *failoverClient, call func(chainClient) (T, error)) (T, error) {
+	c.mu.Lock()
+	start := c.current
+	c.mu.Unlock()
+
+	var result T
+	var err error
+	for i := range c.members {
+		index := (start + i) % len(c.members)
+		result, err = call(c.members[index].client)
+		if err == nil || classifyError(err) != classTransient {
+			if i > 0 {
+				c.mu.Lock()
+				c.current = index
+				c.mu.Unlock()
+			}
+			return result, err
+		}
+		if len(c.members) > 1 {
+			log.Printf("[%s] RPC endpoint %s failed, failing over: %v", c.target, redactURL(c.members[index].endpoint.URL), err)
+		}
+	}
+	return result, err
+}
+
+// SendTransaction broadcasts tx to every endpoint, so it reaches the network as long as one of them relays it.
+// It succeeds when any endpoint accepts the transaction; otherwise it returns the first error that is not
+// transient, so nonce and fee problems are reported over connection failures.
+func (c *failoverClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	errs := make([]error, len(c.members))
+	var wg sync.WaitGroup
+	for i, member := range c.members {
+		wg.Add(1)
+		go func(i int, client chainClient) {
+			defer wg.Done()
+			errs[i] = client.SendTransaction(ctx, tx)
+		}(i, member.client)
+	}
+	wg.Wait()
+
+	accepted := false
+	for _, err := range errs {
+		if err == nil || isAlreadyKnown(err) {
+			accepted = true
+		}
+	}
+	if accepted {
+		for i, err := range errs {
+			if err != nil && !isAlreadyKnown(err) {
+				log.Printf("[%s] RPC endpoint %s rejected transaction %s: %v", c.target, redactURL(c.members[i].endpoint.URL), tx.Hash().Hex(), err)
+			}
+		}
+		return nil
+	}
+
+	c.mu.Lock()
+	err := errs[c.current]
+	c.mu.Unlock()
+	for _, candidate := range errs {
+		if classifyError(candidate) != classTransient {
+			return candidate
+		}
+	}
+	return err
+}
+
+func (c *failoverClient) Close() {
+	for _, member := range c.members {
+		member.client.Close()
+	}
+}
+
+func (c *failoverClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return failover(c, func(client chainClient) (*big.Int, error) { return client.ChainID(ctx) })
+}
+
+func (c *failoverClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return failover(c, func(client chainClient) ([]byte, error) { return client.CodeAt(ctx, account, blockNumber) })
+}
+
+func (c *failoverClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return failover(c, func(client chainClient) ([]byte, error) { return client.CallContract(ctx, call, blockNumber) })
+}
+
+func (c *failoverClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return failover(c, func(client chainClient) (*types.Header, error) { return client.HeaderByNumber(ctx, number) })
+}
+
+func (c *failoverClient) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return failover(c, func(client chainClient) ([]byte, error) { return client.PendingCodeAt(ctx, account) })
+}
+
+func (c *failoverClient) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return failover(c, func(client chainClient) (uint64, error) { return client.PendingNonceAt(ctx, account) })
+}
+
+func (c *failoverClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return failover(c, func(client chainClient) (*big.Int, error) { return client.SuggestGasPrice(ctx) })
+}
+
+func (c *failoverClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return failover(c, func(client chainClient) (*big.Int, error) { return client.SuggestGasTipCap(ctx) })
+}
+
+func (c *failoverClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return failover(c, func(client chainClient) (uint64, error) { return client.EstimateGas(ctx, call) })
+}
+
+func (c *failoverClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return failover(c, func(client chainClient) ([]types.Log, error) { return client.FilterLogs(ctx, query) })
+}
+
+func (c *failoverClient) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return failover(c, func(client chainClient) (ethereum.Subscription, error) {
+		return client.SubscribeFilterLogs(ctx, query, ch)
+	})
+}
+
+func (c *failoverClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return failover(c, func(client chainClient) (*big.Int, error) { return client.BalanceAt(ctx, account, blockNumber) })
+}
+
+func (c *failoverClient) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	return failover(c, func(client chainClient) ([]byte, error) { return client.StorageAt(ctx, account, key, blockNumber) })
+}
+
+func (c *failoverClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return failover(c, func(client chainClient) (uint64, error) { return client.NonceAt(ctx, account, blockNumber) })
+}
+
+// TransactionByHash asks every endpoint in turn until one knows the transaction, since a broadcast may have
+// reached only some of them. It only reports ethereum.NotFound when every endpoint answered that way, so a
+// failing endpoint is never taken as proof that a transaction was dropped.
+func (c *failoverClient) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	err := ethereum.NotFound
+	for _, member := range c.members {
+		tx, isPending, memberErr := member.client.TransactionByHash(ctx, hash)
+		if memberErr == nil {
+			return tx, isPending, nil
+		}
+		if !errors.Is(memberErr, ethereum.NotFound) {
+			err = memberErr
+		}
+	}
+	return nil, false, err
+}
+
+func (c *failoverClient) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return failover(c, func(client chainClient) (*types.Receipt, error) { return client.TransactionReceipt(ctx, hash) })
+}
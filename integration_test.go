@@ -0,0 +1,1462 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// simulatedClient adapts the simulated backend to chainClient. Every sent transaction is mined immediately, so
+// waitForConfirmation finds the receipt on its first poll.
+type simulatedClient struct {
+	simulated.Client
+	backend *simulated.Backend
+}
+
+func (c simulatedClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := c.Client.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	c.backend.Commit()
+	return nil
+}
+
+func (c simulatedClient) Close() {}
+
+// testChain is an in-process chain running the test records contract, with the default chain target pointed at it.
+type testChain struct {
+	client   simulatedClient
+	key      *ecdsa.PrivateKey
+	contract common.Address
+	records  *Records
+	target   *ChainTarget
+}
+
+// useEnvSettings loads the settings from the environment the test set up, as main does, until the test ends.
+func useEnvSettings(t *testing.T) {
+	t.Helper()
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatalf("loading settings: %v", err)
+	}
+	previous := config
+	config = settings
+	t.Cleanup(func() { config = previous })
+}
+
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	funds := new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))
+	backend := simulated.NewBackend(types.GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: funds}})
+	t.Cleanup(func() { backend.Close() })
+	client := simulatedClient{Client: backend.Client(), backend: backend}
+
+	chainID, err := client.ChainID(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := bind.NewKeyedTransactorWithChainID(key, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := RecordsMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, _, records, err := bind.DeployContract(auth, *parsed, recordsContractCode(), client)
+	if err != nil {
+		t.Fatalf("deploying the test contract: %v", err)
+	}
+
+	for name, value := range map[string]string{
+		"CHAIN_TARGETS_FILE":     "",
+		"CONTRACT_REGISTRY_FILE": "",
+		"CONTRACT_ADDRESS":       contract.Hex(),
+		"RPC_URL":                "http://simulated.test",
+		"CHAIN_ID":               "",
+		"BATCH_SIZE":             "",
+		"DEPLOYER_PRIVATE_KEY":   fmt.Sprintf("%x", crypto.FromECDSA(key)),
+		"LOW_BALANCE_THRESHOLD":  "",
+		"PREFLIGHT_MAX_WAIT":     "",
+		"ALERT_WEBHOOK_URL":      "",
+		"QUARANTINE_TABLE":       "",
+		"AUDIT_TABLE":            "",
+		"PENDING_TX_FILE":        filepath.Join(t.TempDir(), "pending.json"),
+		"RUN_LOCK":               "",
+	} {
+		t.Setenv(name, value)
+	}
+	useEnvSettings(t)
+
+	dial := dialRPC
+	dialRPC = func(context.Context, string) (chainClient, error) { return client, nil }
+	t.Cleanup(func() { dialRPC = dial })
+
+	targets, err := LoadChainTargets()
+	if err != nil {
+		t.Fatalf("loading chain targets: %v", err)
+	}
+
+	return &testChain{
+		client:   client,
+		key:      key,
+		contract: contract,
+		records: &Records{
+			RecordsCaller:     RecordsCaller{contract: records},
+			RecordsTransactor: RecordsTransactor{contract: records},
+			RecordsFilterer:   RecordsFilterer{contract: records},
+		},
+		target: targets[0],
+	}
+}
+
+// sendTx sends value and data from key to to, mined at once, and returns the transaction hash.
+func (c *testChain) sendTx(t *testing.T, key *ecdsa.PrivateKey, to common.Address, value *big.Int, data []byte) common.Hash {
+	t.Helper()
+	ctx := context.Background()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	nonce, err := c.client.PendingNonceAt(ctx, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasPrice, err := c.client.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID, err := c.client.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: gasPrice, Gas: 100_000, To: &to, Value: value, Data: data}),
+		types.LatestSignerForChainID(chainID), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.client.SendTransaction(ctx, tx); err != nil {
+		t.Fatalf("sending %s: %v", tx.Hash().Hex(), err)
+	}
+	return tx.Hash()
+}
+
+// transactOpts signs with the deployer key.
+func (c *testChain) transactOpts(t *testing.T) *bind.TransactOpts {
+	t.Helper()
+	auth, err := newTransactOpts(context.Background(), c.client, c.key, FeePolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+// storedRecords reads the records stored for a (userId, day, assetId) key.
+func (c *testChain) storedRecords(t *testing.T, userID string, day time.Time, assetID string) []ReplayLibraryTransaction {
+	t.Helper()
+	stored, err := c.records.GetTransactionsByDay(&bind.CallOpts{}, userID,
+		big.NewInt(int64(day.Day())), big.NewInt(int64(day.Month())), big.NewInt(int64(day.Year())), assetID)
+	if err != nil {
+		t.Fatalf("getTransactionsByDay: %v", err)
+	}
+	return stored
+}
+
+var testDay = time.Date(2024, time.October, 20, 0, 0, 0, 0, time.UTC)
+
+func testRow(jobID string, chunkID float64, userID, assetID string, duration int64, consumer, owner float64) JobDataRow {
+	return JobDataRow{
+		JobID:                    jobID,
+		ChunkID:                  chunkID,
+		UserID:                   userID,
+		AssetID:                  bigquery.NullString{StringVal: assetID, Valid: true},
+		TotalDuration:            duration,
+		TotalRewardsConsumer:     consumer,
+		TotalRewardsContentOwner: owner,
+		CreatedAtDay:             testDay,
+	}
+}
+
+func TestAddToBlockchainEmitsAndStoresEveryRow(t *testing.T) {
+	chain := newTestChain(t)
+
+	rows := []JobDataRow{
+		testRow("job-1", 1, "user-a", "asset-1", 120, 1.5, 0.25),
+		testRow("job-1", 1, "user-b", "asset-2", 45, 0.000001, 3),
+		testRow("job-1", 1, strings.Repeat("long-user-id-", 5), "asset-with-a-name-longer-than-one-word", 7, 2, 0),
+	}
+
+	receipt, err := addToBlockchain(context.Background(), chain.target, Batch{JobID: "job-1", ChunkID: 1, Rows: rows})
+	if err != nil {
+		t.Fatalf("addToBlockchain: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("receipt status = %d, want success", receipt.Status)
+	}
+	if len(receipt.Logs) != len(rows) {
+		t.Fatalf("receipt has %d logs, want one per row (%d)", len(receipt.Logs), len(rows))
+	}
+
+	expected := buildTransactions(rows)
+	for i, log := range receipt.Logs {
+		if log.Address != chain.contract {
+			t.Errorf("log %d emitted by %s, want the records contract %s", i, log.Address.Hex(), chain.contract.Hex())
+		}
+		event, err := chain.records.ParseTransactionAdded(*log)
+		if err != nil {
+			t.Fatalf("log %d is not a TransactionAdded event: %v", i, err)
+		}
+
+		want := expected[i]
+		if event.UserId != crypto.Keccak256Hash([]byte(want.UserId)) {
+			t.Errorf("event %d: userId topic does not match %q", i, want.UserId)
+		}
+		if event.AssetId != want.AssetId {
+			t.Errorf("event %d: assetId = %q, want %q", i, event.AssetId, want.AssetId)
+		}
+		for _, field := range []struct {
+			name      string
+			got, want *big.Int
+		}{
+			{"day", event.Day, want.Day},
+			{"month", event.Month, want.Month},
+			{"year", event.Year, want.Year},
+			{"totalDuration", event.TotalDuration, want.TotalDuration},
+			{"totalRewardsConsumer", event.TotalRewardsConsumer, want.TotalRewardsConsumer},
+			{"totalRewardsContentOwner", event.TotalRewardsContentOwner, want.TotalRewardsContentOwner},
+		} {
+			if field.got.Cmp(field.want) != 0 {
+				t.Errorf("event %d: %s = %s, want %s", i, field.name, field.got, field.want)
+			}
+		}
+
+		stored := chain.storedRecords(t, want.UserId, testDay, want.AssetId)
+		if len(stored) != 1 {
+			t.Fatalf("row %d: %d records stored, want 1", i, len(stored))
+		}
+		if fmt.Sprint(stored[0]) != fmt.Sprint(want) {
+			t.Errorf("row %d: stored %+v, want %+v", i, stored[0], want)
+		}
+	}
+
+	if want := ToWei(1.5); expected[0].TotalRewardsConsumer.Cmp(want) != 0 {
+		t.Errorf("1.5 tokens encoded as %s wei, want %s", expected[0].TotalRewardsConsumer, want)
+	}
+}
+
+func TestAddToBlockchainAppendsRecordsOfTheSameDay(t *testing.T) {
+	chain := newTestChain(t)
+
+	first := Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1)}}
+	second := Batch{JobID: "job-1", ChunkID: 2, Rows: []JobDataRow{testRow("job-1", 2, "user-a", "asset-1", 20, 2, 2)}}
+
+	firstReceipt, err := addToBlockchain(context.Background(), chain.target, first)
+	if err != nil {
+		t.Fatalf("first batch: %v", err)
+	}
+	secondReceipt, err := addToBlockchain(context.Background(), chain.target, second)
+	if err != nil {
+		t.Fatalf("second batch: %v", err)
+	}
+	if firstReceipt.TxHash == secondReceipt.TxHash {
+		t.Fatal("both batches were reported with the same transaction")
+	}
+
+	stored := chain.storedRecords(t, "user-a", testDay, "asset-1")
+	if len(stored) != 2 {
+		t.Fatalf("%d records stored, want 2", len(stored))
+	}
+	for i, duration := range []int64{10, 20} {
+		if stored[i].TotalDuration.Int64() != duration {
+			t.Errorf("record %d: totalDuration = %s, want %d", i, stored[i].TotalDuration, duration)
+		}
+	}
+}
+
+func TestPausedContractFailsPreflightAndRejectsBatches(t *testing.T) {
+	chain := newTestChain(t)
+
+	if _, err := chain.records.Pause(chain.transactOpts(t)); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+
+	problem, err := contractProblem(context.Background(), chain.records, chain.target.SignerAddress())
+	if err != nil {
+		t.Fatalf("contractProblem: %v", err)
+	}
+	if !strings.Contains(problem, "paused") {
+		t.Errorf("contractProblem = %q, want it to report the pause", problem)
+	}
+
+	if err := checkContractReady(context.Background(), chain.target, testDay); err == nil {
+		t.Error("checkContractReady accepted a paused contract")
+	}
+
+	batch := Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1)}}
+	if _, err := addToBlockchain(context.Background(), chain.target, batch); err == nil {
+		t.Error("addToBlockchain succeeded on a paused contract")
+	}
+	if stored := chain.storedRecords(t, "user-a", testDay, "asset-1"); len(stored) != 0 {
+		t.Errorf("%d records stored while paused, want none", len(stored))
+	}
+
+	if _, err := chain.records.Unpause(chain.transactOpts(t)); err != nil {
+		t.Fatalf("unpause: %v", err)
+	}
+	if err := checkContractReady(context.Background(), chain.target, testDay); err != nil {
+		t.Errorf("checkContractReady after unpause: %v", err)
+	}
+}
+
+func TestAddToBlockchainResumesPendingTransactions(t *testing.T) {
+	chain := newTestChain(t)
+
+	sent, err := addToBlockchain(context.Background(), chain.target,
+		Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1)}})
+	if err != nil {
+		t.Fatalf("first batch: %v", err)
+	}
+
+	// An interrupted run left the transaction above pending for chunk job-1:2, which holds the same row, and a
+	// dropped one for job-1:3.
+	day := testDay.Format("2006-01-02")
+	dropped := common.HexToHash("0x01")
+	for _, entry := range []pendingTx{
+		{Target: chain.target.Name, Day: day, Chunk: "job-1:2", TxHash: sent.TxHash},
+		{Target: chain.target.Name, Day: day, Chunk: "job-1:3", TxHash: dropped},
+	} {
+		if err := rememberPendingTx(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resumed, err := addToBlockchain(context.Background(), chain.target,
+		Batch{JobID: "job-1", ChunkID: 2, Rows: []JobDataRow{testRow("job-1", 2, "user-a", "asset-1", 10, 1, 1)}})
+	if err != nil {
+		t.Fatalf("resumed batch: %v", err)
+	}
+	if resumed.TxHash != sent.TxHash {
+		t.Errorf("resumed chunk reported %s, want the pending transaction %s", resumed.TxHash.Hex(), sent.TxHash.Hex())
+	}
+	if stored := chain.storedRecords(t, "user-a", testDay, "asset-1"); len(stored) != 1 {
+		t.Errorf("%d records stored, want 1: the pending chunk must not be sent again", len(stored))
+	}
+
+	resent, err := addToBlockchain(context.Background(), chain.target,
+		Batch{JobID: "job-1", ChunkID: 3, Rows: []JobDataRow{testRow("job-1", 3, "user-b", "asset-1", 30, 3, 3)}})
+	if err != nil {
+		t.Fatalf("batch with a dropped transaction: %v", err)
+	}
+	if resent.TxHash == dropped {
+		t.Error("the dropped transaction was reported instead of a new one")
+	}
+	if stored := chain.storedRecords(t, "user-b", testDay, "asset-1"); len(stored) != 1 {
+		t.Errorf("%d records stored for the dropped chunk, want 1", len(stored))
+	}
+
+	if pending, err := readPendingTxs(); err != nil || len(pending) != 0 {
+		t.Errorf("pending transactions left: %v (err %v)", pending, err)
+	}
+}
+
+func TestProcessJobsDoesNotResendTheChunksOfAnInterruptedRun(t *testing.T) {
+	chain := newTestChain(t)
+
+	// The interrupted run broadcast chunk job-1:1 and was stopped before it saw the receipt, leaving the pending
+	// record behind; it had also anchored a chunk of a day the next run no longer reads.
+	row := testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1)
+	sent, err := addToBlockchain(context.Background(), chain.target, Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{row}})
+	if err != nil {
+		t.Fatalf("interrupted batch: %v", err)
+	}
+	old := testRow("job-9", 1, "user-z", "asset-9", 10, 1, 1)
+	old.CreatedAtDay = testDay.AddDate(0, 0, -5)
+	oldSent, err := addToBlockchain(context.Background(), chain.target, Batch{JobID: "job-9", ChunkID: 1, Rows: []JobDataRow{old}})
+	if err != nil {
+		t.Fatalf("batch of an earlier day: %v", err)
+	}
+	for _, entry := range []pendingTx{
+		{Target: chain.target.Name, Day: testDay.Format("2006-01-02"), Chunk: "job-1:1", TxHash: sent.TxHash},
+		{Target: chain.target.Name, Day: old.CreatedAtDay.Format("2006-01-02"), Chunk: "job-9:1", TxHash: oldSent.TxHash},
+	} {
+		if err := rememberPendingTx(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := filepath.Join(t.TempDir(), "rows.jsonl")
+	line := `{"JOB_ID":"job-1","CHUNK_ID":1,"userId":"user-a","assetId":"asset-1","totalDuration":10,"totalRewardsConsumer":1,"totalRewardsContentOwner":1,"createdAtDay":"2024-10-20"}`
+	if err := os.WriteFile(source, []byte(line+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := processJobs(context.Background(), "", RunOptions{Day: testDay, Source: "jsonl:" + source}); err != nil {
+		t.Fatalf("processJobs: %v", err)
+	}
+	if stored := chain.storedRecords(t, "user-a", testDay, "asset-1"); len(stored) != 1 {
+		t.Errorf("%d records stored, want 1: the resumed run must not send the chunk again", len(stored))
+	}
+	if pending, err := readPendingTxs(); err != nil || len(pending) != 0 {
+		t.Errorf("pending transactions left: %v (err %v)", pending, err)
+	}
+}
+
+func TestProcessJobsArchivesAndAnchorsAFileSource(t *testing.T) {
+	chain := newTestChain(t)
+	dir := t.TempDir()
+
+	source := filepath.Join(dir, "rows.jsonl")
+	lines := []string{
+		`{"JOB_ID":"job-2","CHUNK_ID":1,"userId":"user-c","assetId":"asset-3","totalDuration":30,"totalRewardsConsumer":3,"totalRewardsContentOwner":1,"createdAtDay":"2024-10-20"}`,
+		`{"JOB_ID":"job-1","CHUNK_ID":1,"userId":"user-a","assetId":"asset-1","totalDuration":10,"totalRewardsConsumer":1,"totalRewardsContentOwner":0.5,"createdAtDay":"2024-10-20"}`,
+		`{"JOB_ID":"job-1","CHUNK_ID":1,"userId":"user-b","assetId":null,"totalDuration":5,"totalRewardsConsumer":1,"totalRewardsContentOwner":1,"createdAtDay":"2024-10-20"}`,
+		`{"JOB_ID":"job-1","CHUNK_ID":2,"userId":"user-a","assetId":"asset-2","totalDuration":20,"totalRewardsConsumer":2,"totalRewardsContentOwner":0,"createdAtDay":"2024-10-20"}`,
+	}
+	if err := os.WriteFile(source, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "archive.jsonl")
+
+	err := processJobs(context.Background(), "", RunOptions{
+		Day:    testDay,
+		Source: "jsonl:" + source,
+		Sinks:  "file:" + archive + "+chain",
+	})
+	if err != nil {
+		t.Fatalf("processJobs: %v", err)
+	}
+
+	iter, err := chain.records.FilterTransactionAdded(&bind.FilterOpts{Start: 0}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Close()
+	var anchored []string
+	for iter.Next() {
+		anchored = append(anchored, iter.Event.AssetId)
+	}
+	if err := iter.Error(); err != nil {
+		t.Fatal(err)
+	}
+	// The row without an assetId is quarantined; the others are anchored in JOB_ID, CHUNK_ID order.
+	if got, want := strings.Join(anchored, ","), "asset-1,asset-2,asset-3"; got != want {
+		t.Errorf("anchored assets %s, want %s", got, want)
+	}
+
+	if stored := chain.storedRecords(t, "user-c", testDay, "asset-3"); len(stored) != 1 {
+		t.Errorf("%d records stored for user-c, want 1", len(stored))
+	}
+
+	archived, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(archived), "\n"); n != 3 {
+		t.Errorf("archive holds %d rows, want 3", n)
+	}
+}
+
+func TestRunOnceToStdoutNeedsNoChain(t *testing.T) {
+	dir := t.TempDir()
+	for name, value := range map[string]string{
+		"ENVIRONMENT":          "test",
+		"CHAIN_TARGETS_FILE":   "",
+		"RPC_URL":              "",
+		"CONTRACT_ADDRESS":     "",
+		"DEPLOYER_PRIVATE_KEY": "",
+		"QUARANTINE_TABLE":     "",
+		"AUDIT_TABLE":          "",
+		"PENDING_TX_FILE":      filepath.Join(dir, "pending.json"),
+		"RUN_LOCK":             "",
+	} {
+		t.Setenv(name, value)
+	}
+	useEnvSettings(t)
+	dial := dialRPC
+	dialRPC = func(context.Context, string) (chainClient, error) {
+		t.Fatal("a stdout run dialled a chain")
+		return nil, nil
+	}
+	t.Cleanup(func() { dialRPC = dial })
+
+	source := filepath.Join(dir, "rows.jsonl")
+	row := `{"JOB_ID":"job-1","CHUNK_ID":1,"userId":"user-a","assetId":"asset-1","totalDuration":10,"totalRewardsConsumer":1,"totalRewardsContentOwner":0.5,"createdAtDay":"2024-10-20"}`
+	if err := os.WriteFile(source, []byte(row+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+
+	err = runOnce(context.Background(), []string{"-day", "2024-10-20", "-source", "jsonl:" + source, "-sink", "stdout"}, config)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatalf("runOnce: %v", err)
+	}
+	printed, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(printed), `"asset-1"`) {
+		t.Errorf("stdout %q does not hold the row", printed)
+	}
+}
+
+// memoryTable is an in-memory source table: each run reads the rows of its window without a status, and marks
+// them the way the bigquery source does.
+type memoryTable struct {
+	rows []JobDataRow
+}
+
+func (table *memoryTable) open(_, _ string, from, to time.Time) (RecordSource, error) {
+	var pending []JobDataRow
+	for _, row := range table.rows {
+		if !row.Status.Valid && !row.CreatedAtDay.Before(from) && !row.CreatedAtDay.After(to) {
+			pending = append(pending, row)
+		}
+	}
+	return &memoryTableRun{fileSource: &fileSource{rows: pending}, table: table}, nil
+}
+
+type memoryTableRun struct {
+	*fileSource
+	table *memoryTable
+}
+
+func (r *memoryTableRun) MarkRows(_ context.Context, status string, keys []sourceRowKey) error {
+	for _, key := range keys {
+		for i, row := range r.table.rows {
+			if newSourceRowKey(row) == key && !row.Status.Valid {
+				r.table.rows[i].Status = bigquery.NullString{StringVal: status, Valid: true}
+			}
+		}
+	}
+	return nil
+}
+
+func TestProcessJobsLookBackAnchorsLateRowsButNotAnchoredDays(t *testing.T) {
+	chain := newTestChain(t)
+
+	row := func(jobID, userID string, daysBefore int) JobDataRow {
+		row := testRow(jobID, 1, userID, "asset-1", 10, 1, 1)
+		row.CreatedAtDay = testDay.AddDate(0, 0, -daysBefore)
+		return row
+	}
+	table := &memoryTable{rows: []JobDataRow{
+		row("job-a", "user-a", 3),
+		row("job-b", "user-b", 2),
+		row("job-c", "user-c", 1),
+		row("job-d", "user-d", 0),
+	}}
+	open := openRecordSource
+	openRecordSource = table.open
+	t.Cleanup(func() { openRecordSource = open })
+
+	// Each scheduled run reads its day and the day before it.
+	for _, day := range []time.Time{testDay.AddDate(0, 0, -2), testDay.AddDate(0, 0, -1), testDay} {
+		if day.Equal(testDay) {
+			// A row of an already anchored day lands late, in a chunk of its own.
+			table.rows = append(table.rows, row("job-late", "user-late", 1))
+		}
+		if err := processJobs(context.Background(), "", RunOptions{Day: day, LookbackDays: 1}); err != nil {
+			t.Fatalf("run of %s: %v", day.Format("2006-01-02"), err)
+		}
+	}
+
+	// Every day was read by two runs, but only the first anchored it.
+	for _, r := range table.rows {
+		day := r.CreatedAtDay
+		if stored := chain.storedRecords(t, r.UserID, day, "asset-1"); len(stored) != 1 {
+			t.Errorf("%s of %s: %d records stored, want 1", r.UserID, day.Format("2006-01-02"), len(stored))
+		}
+		if r.Status.StringVal != statusAnchored {
+			t.Errorf("%s of %s: status %q, want %q", r.UserID, day.Format("2006-01-02"), r.Status.StringVal, statusAnchored)
+		}
+	}
+}
+
+func TestProcessJobsRefusesADayLockedByAnotherInstance(t *testing.T) {
+	chain := newTestChain(t)
+	dir := t.TempDir()
+	t.Setenv("ENVIRONMENT", "test")
+	t.Setenv("RUN_LOCK", "file:"+dir)
+	useEnvSettings(t)
+
+	source := filepath.Join(dir, "rows.jsonl")
+	row := `{"JOB_ID":"job-1","CHUNK_ID":1,"userId":"user-a","assetId":"asset-1","totalDuration":10,"totalRewardsConsumer":1,"totalRewardsContentOwner":1,"createdAtDay":"2024-10-20"}`
+	if err := os.WriteFile(source, []byte(row+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := RunOptions{Day: testDay, Source: "jsonl:" + source}
+
+	lease := fmt.Sprintf(`{"owner":"other-instance","expiresAt":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	leaseFile := filepath.Join(dir, "test_2024-10-20.lock")
+	if err := os.WriteFile(leaseFile, []byte(lease), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := processJobs(context.Background(), "", opts)
+	if err == nil || !strings.Contains(err.Error(), "other-instance") {
+		t.Fatalf("processJobs = %v, want it to report the lease held by other-instance", err)
+	}
+	if stored := chain.storedRecords(t, "user-a", testDay, "asset-1"); len(stored) != 0 {
+		t.Fatalf("%d records anchored while the day was locked", len(stored))
+	}
+
+	// Once the other lease expires the day can be anchored, and the lease is released afterwards.
+	expired := fmt.Sprintf(`{"owner":"other-instance","expiresAt":%q}`, time.Now().Add(-time.Minute).Format(time.RFC3339))
+	if err := os.WriteFile(leaseFile, []byte(expired), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := processJobs(context.Background(), "", opts); err != nil {
+		t.Fatalf("processJobs after the lease expired: %v", err)
+	}
+	if stored := chain.storedRecords(t, "user-a", testDay, "asset-1"); len(stored) != 1 {
+		t.Errorf("%d records anchored, want 1", len(stored))
+	}
+	if _, err := os.Stat(leaseFile); !os.IsNotExist(err) {
+		t.Errorf("lease file left behind after the run: %v", err)
+	}
+}
+
+func TestFileRunLockGivesAnExpiredLeaseToOneInstance(t *testing.T) {
+	dir := t.TempDir()
+	key := "test/2024-10-20"
+	expired, err := sonic.Marshal(fileLease{Owner: "crashed-instance", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Instance a is taking the expired lease over: b must wait for it, then find the lease taken.
+	a, b := fileRunLock{dir: dir, owner: "instance-a"}, fileRunLock{dir: dir, owner: "instance-b"}
+	if err := os.WriteFile(a.path(key), expired, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := a.guard(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type acquired struct {
+		holder string
+		ok     bool
+		err    error
+	}
+	result := make(chan acquired, 1)
+	go func() {
+		holder, ok, err := b.Acquire(context.Background(), key, time.Hour)
+		result <- acquired{holder, ok, err}
+	}()
+	select {
+	case got := <-result:
+		t.Fatalf("b acquired %+v during a's takeover", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := a.write(key, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if got := <-result; got.err != nil || got.ok || got.holder != "instance-a" {
+		t.Fatalf("b acquired %+v after a's takeover, want the lease held by instance-a", got)
+	}
+
+	// Racing instances never both get the lease.
+	for round := 0; round < 100; round++ {
+		if err := os.WriteFile(fileRunLock{dir: dir}.path(key), expired, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		instances := []fileRunLock{a, b}
+		granted := make([]bool, len(instances))
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i, lock := range instances {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				_, ok, err := lock.Acquire(context.Background(), key, time.Hour)
+				if err != nil {
+					t.Errorf("%s: %v", lock.owner, err)
+				}
+				granted[i] = ok
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if granted[0] == granted[1] {
+			t.Fatalf("round %d: leases granted %v, want exactly one", round, granted)
+		}
+		winner := instances[0]
+		if granted[1] {
+			winner = instances[1]
+		}
+		if lease, err := winner.read(key); err != nil || lease.Owner != winner.owner {
+			t.Fatalf("round %d: lease %+v (err %v), want it held by %s", round, lease, err, winner.owner)
+		}
+	}
+}
+
+// flakyClient fails the first sends with the given errors before handing transactions to the chain.
+type flakyClient struct {
+	simulatedClient
+	failures []error
+	sent     []*types.Transaction
+}
+
+func (c *flakyClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	c.sent = append(c.sent, tx)
+	if len(c.failures) > 0 {
+		err := c.failures[0]
+		c.failures = c.failures[1:]
+		return err
+	}
+	return c.simulatedClient.SendTransaction(ctx, tx)
+}
+
+func TestAddToBlockchainRetriesTransientAndUnderpricedSends(t *testing.T) {
+	chain := newTestChain(t)
+	t.Setenv("RETRY_BASE_DELAY", "1ms")
+	useEnvSettings(t)
+
+	client := &flakyClient{simulatedClient: chain.client, failures: []error{
+		rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"},
+		errors.New("replacement transaction underpriced"),
+	}}
+	dialRPC = func(context.Context, string) (chainClient, error) { return client, nil }
+
+	receipt, err := addToBlockchain(context.Background(), chain.target,
+		Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1)}})
+	if err != nil {
+		t.Fatalf("addToBlockchain: %v", err)
+	}
+
+	if len(client.sent) != 3 {
+		t.Fatalf("%d sends, want 3", len(client.sent))
+	}
+	first, second, last := client.sent[0], client.sent[1], client.sent[2]
+	if second.Hash() != first.Hash() {
+		t.Error("a transient failure re-signed the transaction instead of resending it")
+	}
+	if last.Nonce() != first.Nonce() || last.GasPrice().Cmp(first.GasPrice()) <= 0 {
+		t.Errorf("underpriced transaction resent with nonce %d and gas price %s, want nonce %d and more than %s",
+			last.Nonce(), last.GasPrice(), first.Nonce(), first.GasPrice())
+	}
+	if receipt.TxHash != last.Hash() {
+		t.Errorf("receipt for %s, want the bumped transaction %s", receipt.TxHash.Hex(), last.Hash().Hex())
+	}
+	if stored := chain.storedRecords(t, "user-a", testDay, "asset-1"); len(stored) != 1 {
+		t.Errorf("%d records stored, want 1", len(stored))
+	}
+	if pending, err := readPendingTxs(); err != nil || len(pending) != 0 {
+		t.Errorf("pending transactions left: %v (err %v)", pending, err)
+	}
+}
+
+func TestRetryReportsCancellationDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := retryPolicy{Attempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	transient := rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"}
+
+	err := policy.do(ctx, "sending", func() error {
+		cancel()
+		return transient
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("do returned %v, want the cancellation", err)
+	}
+}
+
+func TestAddToBlockchainDoesNotRetryReverts(t *testing.T) {
+	chain := newTestChain(t)
+	t.Setenv("RETRY_BASE_DELAY", "1ms")
+	useEnvSettings(t)
+
+	client := &flakyClient{simulatedClient: chain.client, failures: []error{errors.New("execution reverted")}}
+	dialRPC = func(context.Context, string) (chainClient, error) { return client, nil }
+
+	_, err := addToBlockchain(context.Background(), chain.target,
+		Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1)}})
+	if err == nil {
+		t.Fatal("addToBlockchain succeeded although the send was rejected")
+	}
+	if len(client.sent) != 1 {
+		t.Errorf("%d sends, want 1: reverts are not retried", len(client.sent))
+	}
+	if pending, err := readPendingTxs(); err != nil || len(pending) != 0 {
+		t.Errorf("pending transactions left for a rejected send: %v (err %v)", pending, err)
+	}
+}
+
+// unreachableClient fails every chain ID request, as a node behind a failing gateway does.
+type unreachableClient struct {
+	simulatedClient
+}
+
+func (unreachableClient) ChainID(context.Context) (*big.Int, error) {
+	return nil, rpc.HTTPError{StatusCode: 502, Status: "502 Bad Gateway"}
+}
+
+func TestAddToBlockchainFailsOverAndBroadcastsToEveryHealthyEndpoint(t *testing.T) {
+	chain := newTestChain(t)
+	t.Setenv("RETRY_BASE_DELAY", "1ms")
+	t.Setenv("RPC_URL", "https://down.example/key,https://primary.example/key,https://backup.example/key")
+	useEnvSettings(t)
+
+	primary := &flakyClient{simulatedClient: chain.client, failures: []error{
+		rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"},
+	}}
+	backup := &flakyClient{simulatedClient: chain.client}
+	clients := map[string]chainClient{
+		"https://down.example/key":    unreachableClient{chain.client},
+		"https://primary.example/key": primary,
+		"https://backup.example/key":  backup,
+	}
+	dialRPC = func(_ context.Context, url string) (chainClient, error) { return clients[url], nil }
+
+	targets, err := LoadChainTargets()
+	if err != nil {
+		t.Fatalf("loading chain targets: %v", err)
+	}
+	if len(targets[0].Endpoints) != 3 {
+		t.Fatalf("%d endpoints parsed from RPC_URL, want 3", len(targets[0].Endpoints))
+	}
+
+	receipt, err := addToBlockchain(context.Background(), targets[0],
+		Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1)}})
+	if err != nil {
+		t.Fatalf("addToBlockchain: %v", err)
+	}
+
+	if len(primary.sent) != 1 || len(backup.sent) != 1 {
+		t.Fatalf("transaction sent %d times to the primary and %d times to the backup, want once to each",
+			len(primary.sent), len(backup.sent))
+	}
+	if receipt.TxHash != backup.sent[0].Hash() {
+		t.Errorf("receipt for %s, want the broadcast transaction %s", receipt.TxHash.Hex(), backup.sent[0].Hash().Hex())
+	}
+	if stored := chain.storedRecords(t, "user-a", testDay, "asset-1"); len(stored) != 1 {
+		t.Errorf("%d records stored, want 1", len(stored))
+	}
+}
+
+// probeCountingClient counts the chain ID requests made by endpoint probes.
+type probeCountingClient struct {
+	simulatedClient
+	probes *int
+}
+
+func (c probeCountingClient) ChainID(ctx context.Context) (*big.Int, error) {
+	*c.probes++
+	return c.simulatedClient.ChainID(ctx)
+}
+
+func TestDialProbesEndpointsOncePerRun(t *testing.T) {
+	chain := newTestChain(t)
+	t.Setenv("RPC_URL", "https://down.example/key,https://primary.example/key")
+	useEnvSettings(t)
+
+	var probes int
+	var mu sync.Mutex // endpoints are probed concurrently
+	dialled := map[string]int{}
+	clients := map[string]chainClient{
+		"https://down.example/key":    unreachableClient{chain.client},
+		"https://primary.example/key": probeCountingClient{simulatedClient: chain.client, probes: &probes},
+	}
+	dialRPC = func(_ context.Context, url string) (chainClient, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dialled[url]++
+		return clients[url], nil
+	}
+
+	targets, err := LoadChainTargets()
+	if err != nil {
+		t.Fatalf("loading chain targets: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		client, err := targets[0].Dial(context.Background())
+		if err != nil {
+			t.Fatalf("dial %d: %v", i+1, err)
+		}
+		client.Close()
+	}
+
+	if probes != 1 {
+		t.Errorf("healthy endpoint probed %d times over three dials, want once", probes)
+	}
+	if dialled["https://down.example/key"] != 1 {
+		t.Errorf("unhealthy endpoint dialled %d times, want only by the first probe", dialled["https://down.example/key"])
+	}
+}
+
+// tamperingClient hands out receipts with their last log removed, as if the contract had skipped a record.
+type tamperingClient struct {
+	simulatedClient
+}
+
+func (c tamperingClient) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	receipt, err := c.simulatedClient.TransactionReceipt(ctx, hash)
+	if err != nil || len(receipt.Logs) == 0 {
+		return receipt, err
+	}
+	tampered := *receipt
+	tampered.Logs = receipt.Logs[:len(receipt.Logs)-1]
+	return &tampered, nil
+}
+
+func TestAddToBlockchainVerifiesOneEventPerRow(t *testing.T) {
+	chain := newTestChain(t)
+
+	batch := Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{
+		testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1),
+		testRow("job-1", 1, "user-b", "asset-1", 20, 2, 2),
+	}}
+	receipt, err := addToBlockchain(context.Background(), chain.target, batch)
+	if err != nil {
+		t.Fatalf("addToBlockchain: %v", err)
+	}
+	var status sinkStatus
+	status.record(batch, receipt, nil)
+	if indexes := status.Results[0].LogIndexes; fmt.Sprint(indexes) != "[0 1]" {
+		t.Errorf("log indexes = %v, want [0 1]", indexes)
+	}
+
+	dialRPC = func(context.Context, string) (chainClient, error) { return tamperingClient{chain.client}, nil }
+	batch.ChunkID = 2
+	receipt, err = addToBlockchain(context.Background(), chain.target, batch)
+	if err == nil || !strings.Contains(err.Error(), "1 TransactionAdded events for 2 rows") {
+		t.Fatalf("addToBlockchain with a skipped record: err = %v, want a verification failure", err)
+	}
+	if receipt == nil {
+		t.Error("the receipt of the unverified batch was not returned")
+	}
+}
+
+func TestAuditRowsTraceEveryRowToItsLog(t *testing.T) {
+	chain := newTestChain(t)
+
+	batch := Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{
+		testRow("job-1", 1, "user-a", "asset-1", 10, 1.5, 0.25),
+		testRow("job-1", 1, "user-b", "asset-2", 20, 2, 2),
+	}}
+	anchored, err := addToBlockchain(context.Background(), chain.target, batch)
+	if err != nil {
+		t.Fatalf("addToBlockchain: %v", err)
+	}
+
+	rows, err := newAuditRows("run-1", batch, anchored)
+	if err != nil {
+		t.Fatalf("newAuditRows: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("%d audit rows, want 2", len(rows))
+	}
+	signer := crypto.PubkeyToAddress(chain.key.PublicKey)
+	for i, row := range rows {
+		if row.RunID != "run-1" || row.Target != chain.target.Name || row.UserID != batch.Rows[i].UserID {
+			t.Errorf("row %d: run %q, target %q, userId %q", i, row.RunID, row.Target, row.UserID)
+		}
+		if row.TxHash != anchored.TxHash.Hex() || row.BlockNumber != anchored.BlockNumber.Int64() ||
+			row.LogIndex != (bigquery.NullInt64{Int64: int64(i), Valid: true}) || row.LeafIndex.Valid {
+			t.Errorf("row %d: tx %s block %d log %d, want tx %s block %s log %d",
+				i, row.TxHash, row.BlockNumber, row.LogIndex.Int64, anchored.TxHash.Hex(), anchored.BlockNumber, i)
+		}
+		if row.SignerAddress != signer.Hex() || row.ContractAddress != chain.contract.Hex() {
+			t.Errorf("row %d: signer %s contract %s, want %s and %s", i, row.SignerAddress, row.ContractAddress, signer.Hex(), chain.contract.Hex())
+		}
+		if row.GasUsed == 0 || row.EffectiveGasPrice == "" {
+			t.Errorf("row %d: gas used %d at %q, want the receipt's gas", i, row.GasUsed, row.EffectiveGasPrice)
+		}
+		if row.Day.String() != testDay.Format("2006-01-02") {
+			t.Errorf("row %d: day %s, want %s", i, row.Day, testDay.Format("2006-01-02"))
+		}
+	}
+	// The deployment used nonce 0, so the batch is the signer's second transaction.
+	if rows[0].Nonce != 1 {
+		t.Errorf("nonce %d, want 1", rows[0].Nonce)
+	}
+	if rows[0].TotalRewardsConsumerWei != "1500000000000000000" {
+		t.Errorf("totalRewardsConsumerWei = %s, want 1500000000000000000", rows[0].TotalRewardsConsumerWei)
+	}
+
+	fee := receiptFee(anchored.Receipt)
+	if fee.Sign() <= 0 || rows[0].BatchFeeWei != fee.String() {
+		t.Fatalf("batch fee %s, want the receipt's gasUsed x effectiveGasPrice %s", rows[0].BatchFeeWei, fee)
+	}
+	shares := new(big.Int)
+	for _, row := range rows {
+		share, _ := new(big.Int).SetString(row.FeeWei, 10)
+		shares.Add(shares, share)
+	}
+	if shares.Cmp(fee) != 0 {
+		t.Errorf("row fees add up to %s, want the batch fee %s", shares, fee)
+	}
+}
+
+func TestCostReportConvertsEachDayAtItsPrice(t *testing.T) {
+	priceFile := filepath.Join(t.TempDir(), "prices.csv")
+	if err := os.WriteFile(priceFile, []byte("# target,day,price\npolygon,2024-10-20,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := loadFiatPrices("polygon=1", priceFile, "EUR")
+	if err != nil {
+		t.Fatalf("loadFiatPrices: %v", err)
+	}
+
+	lines, err := aggregateCosts([]costRow{
+		{Target: "polygon", Key: "asset-1", Day: "2024-10-19", Batches: 1, Rows: 2, FeeWei: "1000000000000000000"},
+		{Target: "polygon", Key: "asset-1", Day: "2024-10-20", Batches: 1, Rows: 1, FeeWei: "500000000000000000"},
+		{Target: "mainnet", Key: "asset-1", Day: "2024-10-20", Batches: 1, Rows: 1, FeeWei: "3"},
+	}, prices)
+	if err != nil {
+		t.Fatalf("aggregateCosts: %v", err)
+	}
+
+	var out strings.Builder
+	if err := writeCostCSV(&out, lines); err != nil {
+		t.Fatal(err)
+	}
+	want := `target,key,batches,rows,feeWei,fee,fiat,currency
+polygon,asset-1,2,3,1500000000000000000,1.500000,2.0000,EUR
+mainnet,asset-1,1,1,3,0.000000,,
+mainnet,total,1,1,3,0.000000,,
+polygon,total,2,3,1500000000000000000,1.500000,2.0000,EUR
+`
+	if out.String() != want {
+		t.Errorf("report:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	for _, fee := range []int64{10, 2} {
+		shares := splitFee(big.NewInt(fee), 3)
+		sum := new(big.Int)
+		for _, share := range shares {
+			sum.Add(sum, share)
+		}
+		if sum.Int64() != fee || new(big.Int).Sub(shares[0], shares[2]).Int64() > 1 {
+			t.Errorf("fee %d split as %v", fee, shares)
+		}
+	}
+}
+
+func TestMerkleSinkAnchorsTheDayRootAndProvesEveryRecord(t *testing.T) {
+	chain := newTestChain(t)
+	dir := t.TempDir()
+	t.Setenv("MERKLE_TREE_DIR", filepath.Join(dir, "trees"))
+	t.Setenv("MERKLE_ANCHOR_ADDRESS", "")
+	useEnvSettings(t)
+
+	source := filepath.Join(dir, "rows.jsonl")
+	lines := []string{
+		`{"JOB_ID":"job-1","CHUNK_ID":1,"userId":"user-a","assetId":"asset-1","totalDuration":10,"totalRewardsConsumer":1,"totalRewardsContentOwner":0.5,"createdAtDay":"2024-10-20"}`,
+		`{"JOB_ID":"job-1","CHUNK_ID":1,"userId":"user-b","assetId":"asset-1","totalDuration":5,"totalRewardsConsumer":1,"totalRewardsContentOwner":1,"createdAtDay":"2024-10-20"}`,
+		`{"JOB_ID":"job-1","CHUNK_ID":2,"userId":"user-a","assetId":"asset-2","totalDuration":20,"totalRewardsConsumer":2,"totalRewardsContentOwner":0,"createdAtDay":"2024-10-20"}`,
+	}
+	if err := os.WriteFile(source, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := RunOptions{Day: testDay, Source: "jsonl:" + source, Sinks: "merkle"}
+	if err := processJobs(context.Background(), "", opts); err != nil {
+		t.Fatalf("processJobs: %v", err)
+	}
+
+	// Only the root goes on chain.
+	if stored := chain.storedRecords(t, "user-a", testDay, "asset-1"); len(stored) != 0 {
+		t.Errorf("%d records stored on chain, want none", len(stored))
+	}
+
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "trees", "*", "2024-10-20", "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("temporary files left next to the tree: %v", leftovers)
+	}
+	proofs, err := findMerkleProofs("", "2024-10-20", "user-a", "asset-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proofs) != 1 {
+		t.Fatalf("%d proofs for user-a/asset-2, want 1", len(proofs))
+	}
+	proof := proofs[0]
+	if proof.Record.TotalDuration != "20" || proof.Record.TotalRewardsConsumerWei != ToWei(2).String() {
+		t.Errorf("proved record %+v does not match the source row", proof.Record)
+	}
+	if err := proof.verify(); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	anchorer := chain.target.SignerAddress()
+	if err := proof.verifyAnchored(context.Background(), chain.client, anchorer); err != nil {
+		t.Errorf("verifyAnchored: %v", err)
+	}
+
+	// Anyone can send the anchoring calldata of a made-up root; only the anchoring account's transaction counts.
+	forger, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgerAddress := crypto.PubkeyToAddress(forger.PublicKey)
+	chain.sendTx(t, chain.key, forgerAddress, big.NewInt(1e18), nil)
+	forged := proof
+	forged.Record.TotalDuration = "21"
+	tx, err := forged.Record.transaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forged.Root, err = merkleLeaf(tx); err != nil {
+		t.Fatal(err)
+	}
+	forged.Record.Leaf, forged.Proof = forged.Root, nil
+	forgedHash := chain.sendTx(t, forger, anchorer, new(big.Int), merkleAnchorData(forged.Day, forged.Root))
+	forged.TxHash = &forgedHash
+	if err := forged.verify(); err != nil {
+		t.Fatalf("the forged proof is not even consistent: %v", err)
+	}
+	if err := forged.verifyAnchored(context.Background(), chain.client, anchorer); err == nil {
+		t.Error("a root anchored by another account verified")
+	}
+	if err := forged.verifyAnchored(context.Background(), chain.client, forgerAddress); err == nil {
+		t.Error("a root sent to another address than the anchor address verified")
+	}
+
+	tampered := proof
+	tampered.Record.TotalDuration = "21"
+	if err := tampered.verify(); err == nil {
+		t.Error("a proof of an altered record verified")
+	}
+	tampered = proof
+	tampered.Root[0] ^= 1
+	if err := tampered.verify(); err == nil {
+		t.Error("a proof against another root verified")
+	}
+
+	// A rerun over the same rows finds the root anchored and sends nothing.
+	before, err := chain.client.PendingNonceAt(context.Background(), chain.target.SignerAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := processJobs(context.Background(), "", opts); err != nil {
+		t.Fatalf("second processJobs: %v", err)
+	}
+	after, err := chain.client.PendingNonceAt(context.Background(), chain.target.SignerAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("rerun sent %d transactions, want none", after-before)
+	}
+
+	// Checking proofs reads the chain without the signer key.
+	t.Setenv("DEPLOYER_PRIVATE_KEY", "")
+	useEnvSettings(t)
+	data, err := sonic.Marshal([]merkleProof{proof, forged})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofFile := filepath.Join(dir, "proofs.json")
+	if err := os.WriteFile(proofFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = runProof(context.Background(), []string{"-verify", proofFile, "-anchorer", anchorer.Hex()})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 proofs failed") {
+		t.Errorf("runProof -verify returned %v, want only the forged proof to fail", err)
+	}
+}
+
+func TestMerkleAuditRowsIndexTheLeavesAndShareTheRootFee(t *testing.T) {
+	anchored := &anchoredBatch{Target: "default", Receipt: &types.Receipt{
+		TxHash: common.HexToHash("0x01"), BlockNumber: big.NewInt(7), GasUsed: 5, EffectiveGasPrice: big.NewInt(1),
+	}}
+	first := Batch{JobID: "job-1", ChunkID: 1, Rows: []JobDataRow{
+		testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1),
+		testRow("job-1", 1, "user-b", "asset-1", 10, 1, 1),
+	}}
+	second := Batch{JobID: "job-1", ChunkID: 2, Rows: []JobDataRow{testRow("job-1", 2, "user-c", "asset-1", 10, 1, 1)}}
+
+	rows := append(newMerkleAuditRows("run-1", first, anchored, 0, 3), newMerkleAuditRows("run-1", second, anchored, 2, 3)...)
+	sum := new(big.Int)
+	for i, row := range rows {
+		if row.LogIndex.Valid || row.LeafIndex != (bigquery.NullInt64{Int64: int64(i), Valid: true}) {
+			t.Errorf("row %d has log index %v and leaf index %v, want no log and its position in the tree's records", i, row.LogIndex, row.LeafIndex)
+		}
+		if row.TxHash != anchored.TxHash.Hex() || row.BatchFeeWei != "5" {
+			t.Errorf("row %d linked to %s with batch fee %s, want the root transaction and its whole fee", i, row.TxHash, row.BatchFeeWei)
+		}
+		fee, _ := new(big.Int).SetString(row.FeeWei, 10)
+		sum.Add(sum, fee)
+	}
+	if sum.Int64() != 5 {
+		t.Errorf("row fees add up to %s, want the transaction fee 5", sum)
+	}
+}
+
+func TestVerifyRecordsLinksEveryRecordToItsTransaction(t *testing.T) {
+	chain := newTestChain(t)
+
+	rows := []JobDataRow{
+		testRow("job-1", 1, "user-a", "asset-1", 10, 1.5, 0.5),
+		testRow("job-1", 1, "user-b", "asset-1", 20, 2, 1),
+	}
+	anchored, err := addToBlockchain(context.Background(), chain.target, Batch{JobID: "job-1", ChunkID: 1, Rows: rows})
+	if err != nil {
+		t.Fatalf("addToBlockchain: %v", err)
+	}
+
+	expected := buildTransactions(rows[:1])
+	result, err := verifyRecords(context.Background(), chain.records, chain.contract, "user-a", "asset-1", testDay, expected, 0)
+	if err != nil {
+		t.Fatalf("verifyRecords: %v", err)
+	}
+	if !result.Verified || len(result.Records) != 1 {
+		t.Fatalf("result %+v, want one verified record", result)
+	}
+	record := result.Records[0]
+	if !record.Expected || record.TxHash == nil || *record.TxHash != anchored.TxHash || record.BlockNumber != anchored.BlockNumber.Uint64() {
+		t.Errorf("record %+v, want it expected and written by %s in block %s", record, anchored.TxHash.Hex(), anchored.BlockNumber)
+	}
+	if !strings.Contains(result.text(), anchored.TxHash.Hex()) {
+		t.Errorf("text output does not name the transaction:\n%s", result.text())
+	}
+
+	// user-a's amounts are not what was stored for user-b.
+	result, err = verifyRecords(context.Background(), chain.records, chain.contract, "user-b", "asset-1", testDay, expected, 0)
+	if err != nil {
+		t.Fatalf("verifyRecords: %v", err)
+	}
+	if result.Verified || len(result.Missing) != 1 {
+		t.Errorf("result %+v, want the expected record missing", result)
+	}
+}
+
+func TestVerifyRecordsLinksEventsByContentFromALaterBlock(t *testing.T) {
+	chain := newTestChain(t)
+
+	var anchored []*anchoredBatch
+	for i, row := range []JobDataRow{
+		testRow("job-1", 1, "user-a", "asset-1", 10, 1, 1),
+		testRow("job-1", 2, "user-a", "asset-1", 20, 2, 2),
+	} {
+		batch, err := addToBlockchain(context.Background(), chain.target, Batch{JobID: "job-1", ChunkID: int64(i + 1), Rows: []JobDataRow{row}})
+		if err != nil {
+			t.Fatalf("addToBlockchain: %v", err)
+		}
+		anchored = append(anchored, batch)
+	}
+
+	// Searching from the block of the second record leaves out the event of the first.
+	result, err := verifyRecords(context.Background(), chain.records, chain.contract, "user-a", "asset-1", testDay, nil,
+		anchored[1].BlockNumber.Uint64())
+	if err != nil {
+		t.Fatalf("verifyRecords: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("%d records, want 2", len(result.Records))
+	}
+	if result.Records[0].TxHash != nil {
+		t.Errorf("first record linked to %s, whose event was not searched", result.Records[0].TxHash.Hex())
+	}
+	if result.Records[1].TxHash == nil || *result.Records[1].TxHash != anchored[1].TxHash {
+		t.Errorf("second record linked to %v, want %s", result.Records[1].TxHash, anchored[1].TxHash.Hex())
+	}
+}
+
+func TestLoadSettingsAppliesFileEnvironmentOverridesAndValidation(t *testing.T) {
+	dir := t.TempDir()
+	// The variables of the environment running the tests would override the file.
+	for _, name := range []string{"ENVIRONMENT", "SCHEDULE", "BATCH_SIZE", "RUN_LOCK_TTL", "CONTRACT_ADDRESS", "RPC_URL",
+		"SOURCE_TABLE", "AWS_REGION", "VALIDATION_REQUIRE_ASSET_ID", "SHUTDOWN_TIMEOUT", "CHAIN_TARGETS_FILE", "CONTRACT_REGISTRY_FILE",
+		"SECRET_NAME"} {
+		t.Setenv(name, "")
+	}
+	path := filepath.Join(dir, "config.yaml")
+	t.Setenv("CONFIG_FILE", path)
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`
+environment: staging
+schedule: "30 1 * * *"
+run:
+  batchSize: 20
+  lockTTL: 5m
+chain:
+  rpcUrl: https://rpc.example/key
+  contractAddress: "0x00000000000000000000000000000000000000aa"
+validation:
+  requireAssetId: false
+`)
+	t.Setenv("BATCH_SIZE", "30")
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatalf("LoadSettings: %v", err)
+	}
+	if settings.Environment != "staging" || settings.Run.BatchSize != 30 || settings.Schedule != "30 1 * * *" {
+		t.Errorf("settings %+v, want the file values with BATCH_SIZE from the environment", settings)
+	}
+	if settings.Run.LockTTL != 5*time.Minute || settings.validationRules().RequireAssetID ||
+		settings.BigQuery.SourceTable != defaultSourceTable || settings.AWS.Region != "us-east-1" {
+		t.Errorf("settings %+v, want the file values over the defaults", settings)
+	}
+	if settings.AWS.SecretName != "staging/imaginereplay" {
+		t.Errorf("secret name %q, want the one of the environment", settings.AWS.SecretName)
+	}
+
+	write(`
+schedule: "every day"
+chain:
+  contractAddress: "0x0000000000000000000000000000000000000000"
+  rpcUrl: ftp://rpc.example
+bigquery:
+  sourceTable: just-a-table
+`)
+	_, err = LoadSettings()
+	if err == nil {
+		t.Fatal("LoadSettings accepted an invalid configuration")
+	}
+	for _, name := range []string{"SCHEDULE", "CONTRACT_ADDRESS", "RPC_URL", "SOURCE_TABLE"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not report %s: %v", name, err)
+		}
+	}
+
+	write("chain:\n  rpcURL: https://rpc.example\n")
+	if _, err := LoadSettings(); err == nil || !strings.Contains(err.Error(), "rpcURL") {
+		t.Errorf("LoadSettings = %v, want the unknown field reported", err)
+	}
+}
+
+// fakeSecretsManager serves GetSecretValue like a LocalStack endpoint, failing with a 503 in the regions listed
+// in down. It records the region of every request.
+func fakeSecretsManager(t *testing.T, secret string, down ...string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var regions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The credential scope of the signature names the region: Credential=KEY/DATE/REGION/secretsmanager/...
+		_, scope, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+		region := strings.Split(scope, "/")[2]
+		regions = append(regions, region)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		for _, d := range down {
+			if region == d {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `{"__type":"ServiceUnavailable","message":"down"}`)
+				return
+			}
+		}
+		data, _ := sonic.Marshal(map[string]string{"Name": "test/imaginereplay", "SecretString": secret})
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server, &regions
+}
+
+func TestGetSecretFallsBackToAnotherRegion(t *testing.T) {
+	server, regions := fakeSecretsManager(t, `{"bigquery_project_id":"replay-test"}`, "us-east-1")
+	for name, value := range map[string]string{
+		"AWS_ACCESS_KEY_ID":                "test",
+		"AWS_SECRET_ACCESS_KEY":            "test",
+		"AWS_PROFILE":                      "",
+		"SECRETS_ROLE_ARN":                 "",
+		"AWS_REGION":                       "us-east-1",
+		"SECRETS_MANAGER_FALLBACK_REGIONS": "us-west-2, us-east-1",
+		"SECRETS_MANAGER_ENDPOINT":         server.URL,
+		"RETRY_ATTEMPTS":                   "1",
+	} {
+		t.Setenv(name, value)
+	}
+	useEnvSettings(t)
+
+	secrets.Invalidate("test/imaginereplay")
+	value, err := GetSecret("test/imaginereplay", "bigquery_project_id")
+	if err != nil {
+		t.Fatalf("GetSecret: %v", err)
+	}
+	if value != "replay-test" {
+		t.Errorf("GetSecret = %q, want replay-test", value)
+	}
+	if last := (*regions)[len(*regions)-1]; (*regions)[0] != "us-east-1" || last != "us-west-2" {
+		t.Errorf("regions asked %v, want us-east-1 first and us-west-2 last", *regions)
+	}
+
+	t.Setenv("SECRETS_MANAGER_FALLBACK_REGIONS", "")
+	useEnvSettings(t)
+	secrets.Invalidate("test/imaginereplay")
+	if _, err := GetSecret("test/imaginereplay", "bigquery_project_id"); err == nil {
+		t.Error("GetSecret succeeded with the only region down")
+	}
+}
+
+func TestSecretsProviderFetchesOncePerVersion(t *testing.T) {
+	t.Setenv("SECRETS_CACHE_TTL", "")
+	useEnvSettings(t)
+	versions := map[string]string{
+		secretCurrent:  `{"bigquery_project_id":"replay","bigquery_project_secret_pem":"pem-v1"}`,
+		secretPrevious: `{"bigquery_project_id":"replay","bigquery_project_secret_pem":"pem-v0"}`,
+	}
+	fetches := 0
+	provider := &secretsProvider{fetch: func(secretName, stage string) (string, string, error) {
+		fetches++
+		return versions[stage], stage + "-" + strconv.Itoa(fetches), nil
+	}}
+
+	for _, key := range []string{"bigquery_project_id", "bigquery_project_secret_pem", "bigquery_project_id"} {
+		if _, err := provider.Get("test/imaginereplay", key); err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("%d fetches for three keys, want 1", fetches)
+	}
+
+	// A rotation adding a key is picked up without waiting for the cache to expire.
+	versions[secretCurrent] = `{"bigquery_project_id":"replay","bigquery_project_secret_pem":"pem-v2","rpc_url":"https://rpc.example"}`
+	if value, err := provider.Get("test/imaginereplay", "rpc_url"); err != nil || value != "https://rpc.example" {
+		t.Errorf("Get(rpc_url) = %q, %v after the rotation", value, err)
+	}
+	if _, err := provider.Get("test/imaginereplay", "missing"); err == nil {
+		t.Error("Get returned a key the secret does not hold")
+	}
+
+	previous, err := provider.Bundle("test/imaginereplay", secretPrevious)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.values["bigquery_project_secret_pem"] != "pem-v0" {
+		t.Errorf("previous version holds %v", previous.values)
+	}
+
+	before := fetches
+	t.Setenv("SECRETS_CACHE_TTL", "0s")
+	useEnvSettings(t)
+	provider.Get("test/imaginereplay", "bigquery_project_id")
+	if fetches != before+1 {
+		t.Errorf("a disabled cache served the secret from memory")
+	}
+}
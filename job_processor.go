@@ -2,13 +2,13 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/bigquery"
-	"google.golang.org/api/iterator"
+	"github.com/google/uuid"
 )
 
 type JobDataRow struct {
@@ -23,90 +23,439 @@ type JobDataRow struct {
 	Status                   bigquery.NullString `bigquery:"status"`
 }
 
-func processJobs(secretName string) error {
-	fmt.Println("Processing jobs at:", time.Now())
+// RunOptions selects what a run anchors.
+type RunOptions struct {
+	// Day is the createdAtDay whose pending rows are read.
+	Day time.Time
+	// LookbackDays also reads the rows still pending from this many days before Day, oldest first, so rows that
+	// landed after their day's run are anchored late rather than never.
+	LookbackDays int
+	// OnlyChunks, when not empty, restricts the run to the matching chunks.
+	OnlyChunks ChunkSelector
+	// SkipChunks lists chunks that are never sent.
+	SkipChunks ChunkSelector
+	// Source selects where rows are read from, see OpenRecordSource.
+	Source string
+	// Sinks selects where batches are written to, see OpenBatchSinks.
+	Sinks string
+}
 
-	client, err := GetBigQueryClient(secretName)
+// defaultRunOptions describes the scheduled run: yesterday's rows and those still pending from the LOOKBACK_DAYS
+// before it, read from RECORD_SOURCE (BigQuery by default), minus the chunks listed in SKIP_CHUNKS, written to
+// SINKS (every chain target by default).
+func (s *Settings) defaultRunOptions() (RunOptions, error) {
+	skip, err := ParseChunkSelector(s.Run.SkipChunks)
 	if err != nil {
-		log.Println("Failed to create BigQuery client: ", err)
+		return RunOptions{}, fmt.Errorf("invalid SKIP_CHUNKS: %w", err)
+	}
+	return RunOptions{Day: time.Now().AddDate(0, 0, -1), LookbackDays: s.Run.LookbackDays, SkipChunks: skip,
+		Source: s.Run.Source, Sinks: s.Run.Sinks}, nil
+}
+
+// FirstDay is the oldest createdAtDay the run reads.
+func (o RunOptions) FirstDay() time.Time {
+	return o.Day.AddDate(0, 0, -o.LookbackDays)
+}
+
+// rowBufferBatches bounds how many batches worth of rows are read ahead of the batching stage.
+const rowBufferBatches = 4
+
+// sinkQueueSize bounds how many batches wait for a sink; the slowest sink throttles the reader.
+const sinkQueueSize = 2
+
+// quarantineFlushSize is how many rejected rows are buffered before they are written to the quarantine table.
+const quarantineFlushSize = 500
+
+// runPlan summarises the rows a run will read, so preflight checks can size the whole run before it starts.
+type runPlan struct {
+	Rows    int64
+	Chunks  int64
+	Batches int64
+	// Days breaks the totals down per createdAtDay, oldest first.
+	Days []dayPlan
+}
+
+// dayPlan counts the rows of one createdAtDay.
+type dayPlan struct {
+	Day     string `bigquery:"day"`
+	Rows    int64  `bigquery:"rowCount"`
+	Chunks  int64  `bigquery:"chunks"`
+	Batches int64  `bigquery:"batches"`
+}
+
+// add counts a day in the plan.
+func (p *runPlan) add(day dayPlan) {
+	p.Rows += day.Rows
+	p.Chunks += day.Chunks
+	p.Batches += day.Batches
+	p.Days = append(p.Days, day)
+}
+
+// processJobs reads the rows selected by opts and writes them to every sink. Cancelling ctx stops reading and
+// sending; transactions already broadcast are still waited for, see sendBatch.
+func processJobs(ctx context.Context, secretName string, opts RunOptions) error {
+	runID := uuid.NewString()
+	fmt.Println("Processing jobs at:", time.Now(), "run", runID)
+
+	rules := config.validationRules()
+
+	lock, err := OpenRunLock(config.Run.Lock, secretName)
+	if err != nil {
+		log.Println("Failed to open run lock: ", err)
 		return err
 	}
-	defer func(client *bigquery.Client) {
-		err := client.Close()
+	defer lock.Close()
+
+	// Only one instance anchors a day at a time; losing any lease cancels ctx and stops the run.
+	for day := opts.FirstDay(); !day.After(opts.Day); day = day.AddDate(0, 0, 1) {
+		var release func()
+		ctx, release, err = holdRunLock(ctx, lock, day)
 		if err != nil {
-			log.Println("Failed to close BigQuery client: ", err)
-		}
-	}(client)
-
-	dMinus1 := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
-	queryStr := fmt.Sprintf(`
-		SELECT
-			CHUNK_ID,
-			JOB_ID,
-			assetId,
-			createdAtDay,
-			totalDuration,
-			totalRewardsConsumer,
-			totalRewardsContentOwner,
-			userId,
-			status
-		FROM
-			replay-353318.replayAnalytics.table_blockchain_chunked_data_of_the_day_and_asset
-		WHERE
-			createdAtDay = '%s' AND
-		    status IS NULL
-	`, dMinus1)
-
-	query := client.Query(queryStr)
-
-	rows, err := query.Read(context.Background())
+			log.Println("Not starting the run: ", err)
+			return err
+		}
+		defer release()
+	}
+
+	sinks, err := OpenBatchSinks(opts.Sinks)
 	if err != nil {
-		log.Println("Failed to execute query: ", err)
+		log.Println("Failed to open sinks: ", err)
 		return err
 	}
+	defer closeSinks(sinks)
+	resolvePending(ctx, sinks, opts.FirstDay())
 
-	var jobs []JobDataRow
-	var count int
-
-	for {
-		var row JobDataRow
-		err := rows.Next(&row)
-		if errors.Is(err, iterator.Done) {
-			if count == 0 {
-				log.Println("The query returned an empty result set.")
-			} else {
-				log.Printf("Total jobs read: %d", count)
-			}
-			break
+	source, err := openRecordSource(opts.Source, secretName, opts.FirstDay(), opts.Day)
+	if err != nil {
+		log.Println("Failed to open record source: ", err)
+		return err
+	}
+	defer func(source RecordSource) {
+		err := source.Close()
+		if err != nil {
+			log.Println("Failed to close record source: ", err)
 		}
+	}(source)
+
+	// Rejected rows and the audit trail go to BigQuery even when the records come from a file, as long as their
+	// tables are set. A bigquery source shares its client, which it replaces when the credentials are refused.
+	client := func() *bigquery.Client { return nil }
+	if bq, ok := source.(*bigQuerySource); ok {
+		client = bq.Client
+	} else if config.BigQuery.QuarantineTable != "" || config.BigQuery.AuditTable != "" {
+		own, err := GetBigQueryClient(secretName)
 		if err != nil {
-			log.Println("Failed to read results: ", err)
+			log.Println("Failed to create BigQuery client: ", err)
 			return err
 		}
+		defer own.Close()
+		client = func() *bigquery.Client { return own }
+	}
 
-		jobs = append(jobs, row)
-		count++
+	audit, err := openAuditTrail(client, runID)
+	if err != nil {
+		log.Println("Failed to open audit table: ", err)
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	plan, err := source.Plan(ctx)
+	if err != nil {
+		log.Println("Failed to plan the run: ", err)
+		return err
+	}
+	if plan.Rows == 0 {
+		log.Println("The query returned an empty result set.")
+		return nil
+	}
+	log.Printf("%d rows in %d chunks to read, about %d batches", plan.Rows, plan.Chunks, plan.Batches)
+	reportLateRows(plan, opts.Day)
+
+	rows := make(chan JobDataRow, rowBufferBatches*config.Run.BatchSize)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(rows)
+		readErr <- source.Stream(ctx, rows)
+	}()
+
+	// Every sink works through the batches on its own queue, so a failing chain does not hold back the others,
+	// while the bounded queues keep the reader from running far ahead of the slowest one.
+	statuses := make([]*sinkStatus, len(sinks))
+	queues := make([]chan Batch, len(sinks))
+	marks := newRowMarks(source, len(sinks))
+	var wg sync.WaitGroup
+	for i, sink := range sinks {
+		statuses[i] = &sinkStatus{Sink: sink.Name()}
+		queues[i] = make(chan Batch, sinkQueueSize)
+		wg.Add(1)
+		go func(sink BatchSink, queue <-chan Batch, status *sinkStatus, handled func(Batch, error)) {
+			defer wg.Done()
+			writeToSink(ctx, sink, plan, queue, status, audit, handled)
+		}(sink, queues[i], statuses[i], marks.handler(ctx, i))
+	}
+
+	var count, batchCount int
+	var rejected []QuarantinedRow
+	batcher := &chunkBatcher{
+		only: opts.OnlyChunks,
+		skip: opts.SkipChunks,
+		emit: func(batch Batch) {
+			batchCount++
+			for _, queue := range queues {
+				queue <- batch
+			}
+		},
 	}
 
-	batchSize := 50
-	for i := 0; i < len(jobs); i += batchSize {
-		end := i + batchSize
-		if end > len(jobs) {
-			end = len(jobs)
+	for row := range rows {
+		count++
+		if !batcher.Selects(row) {
+			continue
+		}
+		if reason := rules.Validate(row); reason != "" {
+			rejected = append(rejected, newQuarantinedRow(row, reason))
+			if len(rejected) >= quarantineFlushSize {
+				flushQuarantine(ctx, client, source, rejected)
+				rejected = nil
+			}
+			continue
 		}
+		batcher.Add(row)
+	}
+	batcher.Flush()
+	flushQuarantine(ctx, client, source, rejected)
 
-		batch := jobs[i:end]
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	finishSinks(ctx, sinks, statuses, audit, marks)
+	marks.flush(ctx)
 
-		err := addToBlockchain(batch)
+	readFailure := <-readErr
+	if readFailure != nil && ctx.Err() != nil {
+		log.Printf("Run interrupted after reading %d rows: %v", count, readFailure)
+	} else if readFailure != nil {
+		log.Println("Failed to read results: ", readFailure)
+		sendAlert("Record source read failed", fmt.Sprintf("stopped after %d rows: %v", count, readFailure))
+	}
+	log.Printf("Total jobs read: %d, sent as %d batches", count, batchCount)
 
-		if err != nil {
-			log.Printf("Error processing batch %d to %d: %v", i, end, err)
+	prices, err := loadFiatPrices(config.Costs.GasTokenPrice, config.Costs.GasTokenPriceFile, config.Costs.FiatCurrency)
+	if err != nil {
+		log.Println("Invalid gas token prices, reporting costs without fiat: ", err)
+	}
+
+	skipped := 0
+	for _, status := range statuses {
+		log.Println(status.summary())
+		if cost := status.costSummary(prices); cost != "" {
+			log.Printf("%s, run %s", cost, runID)
+		}
+		if status.Skipped != nil {
+			skipped++
+		}
+		if status.Skipped != nil || status.Failed > 0 {
+			sendAlert("Anchoring incomplete", status.summary())
 		}
+	}
 
-		fmt.Printf("Batch %d processed successfully\n", i)
+	if skipped == len(sinks) {
+		return fmt.Errorf("no sink could be written")
+	}
+	if readFailure != nil {
+		return readFailure
 	}
 
 	fmt.Println("All jobs were processed successfully")
 
 	return nil
 }
+
+// reportLateRows logs the rows found for days before the run's own day, which arrived after those days were run.
+func reportLateRows(plan runPlan, day time.Time) {
+	current := day.Format("2006-01-02")
+	var late int64
+	for _, d := range plan.Days {
+		if d.Day < current {
+			log.Printf("Found %d late rows in %d chunks for %s", d.Rows, d.Chunks, d.Day)
+			late += d.Rows
+		}
+	}
+	if late > 0 {
+		log.Printf("%d late rows from earlier days will be anchored before %s", late, current)
+	}
+}
+
+// flushQuarantine writes rejected rows, alerting when they cannot be stored. Once they are in QUARANTINE_TABLE
+// they are marked in the source, so the next runs do not quarantine them again.
+func flushQuarantine(ctx context.Context, client func() *bigquery.Client, source RecordSource, rejected []QuarantinedRow) {
+	if len(rejected) == 0 {
+		return
+	}
+	log.Printf("%d rows failed validation", len(rejected))
+	if err := quarantineRows(client, rejected); err != nil {
+		sendAlert("Quarantine write failed", fmt.Sprintf("%d invalid rows could not be stored: %v", len(rejected), err))
+		return
+	}
+
+	marker, ok := source.(rowMarker)
+	if !ok || config.BigQuery.QuarantineTable == "" {
+		return
+	}
+	keys := make([]sourceRowKey, len(rejected))
+	for i, row := range rejected {
+		keys[i] = row.key()
+	}
+	if err := marker.MarkRows(context.WithoutCancel(ctx), statusQuarantined, keys); err != nil {
+		sendAlert("Quarantine mark failed", fmt.Sprintf("%d quarantined rows will be read again by the next run: %v", len(keys), err))
+	}
+}
+
+// writeToSink prepares the sink on its first batch and then writes every batch it receives, recording the
+// outcome in status and the rows anchored on chain in the audit trail, and reporting it to handled unless the
+// sink holds the batch back for Finish. A sink that fails to prepare keeps draining its queue so the other sinks
+// are not blocked.
+func writeToSink(ctx context.Context, sink BatchSink, plan runPlan, batches <-chan Batch, status *sinkStatus, audit *auditTrail,
+	handled func(Batch, error)) {
+	prepared := false
+	holds := holdsBatches(sink)
+	for batch := range batches {
+		if status.Skipped != nil {
+			handled(batch, status.Skipped)
+			continue
+		}
+		if ctx.Err() != nil {
+			err := fmt.Errorf("not sent: %w", ctx.Err())
+			status.record(batch, nil, err)
+			handled(batch, err)
+			continue
+		}
+
+		if !prepared {
+			prepared = true
+			if err := sink.Prepare(ctx, plan, batch); err != nil {
+				log.Printf("[%s] Refusing to start the run: %v", sink.Name(), err)
+				status.Skipped = err
+				handled(batch, err)
+				continue
+			}
+		}
+
+		anchored, err := sink.Write(ctx, batch)
+		status.record(batch, anchored, err)
+
+		if err != nil {
+			log.Printf("[%s] Error processing chunk %s (%d rows): %v", sink.Name(), batch.Label(), len(batch.Rows), err)
+			handled(batch, err)
+			continue
+		}
+		if !holds {
+			handled(batch, nil)
+		}
+		if anchored != nil {
+			if err := audit.record(context.WithoutCancel(ctx), batch, anchored); err != nil {
+				sendAlert("Audit write failed", fmt.Sprintf("[%s] chunk %s, transaction %s: %v",
+					sink.Name(), batch.Label(), anchored.TxHash.Hex(), err))
+			}
+		}
+
+		fmt.Printf("[%s] Chunk %s processed successfully\n", sink.Name(), batch.Label())
+	}
+}
+
+// markFlushSize is how many anchored rows are collected before they are marked in the source.
+const markFlushSize = 500
+
+// rowMarks marks the rows of a run anchored in the source once every sink has handled their batch, so the next
+// runs, whose look-back windows cover the same days, do not send them again. A batch that failed on any sink is
+// left unmarked and read again by the next run. A nil rowMarks, for sources that cannot be marked, does nothing.
+type rowMarks struct {
+	marker rowMarker
+	sinks  int
+
+	mu      sync.Mutex
+	batches map[string]*batchProgress
+	ready   []sourceRowKey
+}
+
+// batchProgress records which sinks have handled a batch, and whether any of them failed it.
+type batchProgress struct {
+	reported map[int]bool
+	failed   bool
+}
+
+func newRowMarks(source RecordSource, sinks int) *rowMarks {
+	marker, ok := source.(rowMarker)
+	if !ok {
+		return nil
+	}
+	return &rowMarks{marker: marker, sinks: sinks, batches: make(map[string]*batchProgress)}
+}
+
+// handler returns the function the sink at index sink reports the outcome of its batches to.
+func (m *rowMarks) handler(ctx context.Context, sink int) func(Batch, error) {
+	return func(batch Batch, err error) {
+		if m != nil {
+			m.handled(ctx, sink, batch, err)
+		}
+	}
+}
+
+// handled records the outcome of a batch on a sink; only the first report of each sink counts.
+func (m *rowMarks) handled(ctx context.Context, sink int, batch Batch, err error) {
+	key := batch.Rows[0].CreatedAtDay.Format("2006-01-02") + "/" + batch.Label()
+
+	m.mu.Lock()
+	progress := m.batches[key]
+	if progress == nil {
+		progress = &batchProgress{reported: make(map[int]bool)}
+		m.batches[key] = progress
+	}
+	if progress.reported[sink] {
+		m.mu.Unlock()
+		return
+	}
+	progress.reported[sink] = true
+	progress.failed = progress.failed || err != nil
+
+	var rows []sourceRowKey
+	if len(progress.reported) == m.sinks {
+		delete(m.batches, key)
+		if !progress.failed {
+			for _, row := range batch.Rows {
+				m.ready = append(m.ready, newSourceRowKey(row))
+			}
+		}
+		if len(m.ready) >= markFlushSize {
+			rows, m.ready = m.ready, nil
+		}
+	}
+	m.mu.Unlock()
+
+	m.mark(ctx, rows)
+}
+
+// flush marks the anchored rows still waiting, once every sink is done.
+func (m *rowMarks) flush(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	rows := m.ready
+	m.ready = nil
+	m.mu.Unlock()
+
+	m.mark(ctx, rows)
+}
+
+func (m *rowMarks) mark(ctx context.Context, rows []sourceRowKey) {
+	if len(rows) == 0 {
+		return
+	}
+	if err := m.marker.MarkRows(context.WithoutCancel(ctx), statusAnchored, rows); err != nil {
+		sendAlert("Anchored rows not marked", fmt.Sprintf("%d anchored rows will be read and sent again by the next run: %v", len(rows), err))
+	}
+}
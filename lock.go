@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/bytedance/sonic"
+	"google.golang.org/api/iterator"
+)
+
+// defaultRunLockTTL is how long a lease lasts without being renewed when RUN_LOCK_TTL is not set.
+const defaultRunLockTTL = 10 * time.Minute
+
+// RunLock is a lease shared by every instance of the job, so only one of them anchors a given day at a time.
+// Leases expire unless renewed, so a crashed instance does not block the day forever.
+type RunLock interface {
+	// Acquire takes the lease on key for ttl. When another instance holds it, ok is false and holder names it.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (holder string, ok bool, err error)
+	// Renew extends a lease held by this instance, failing when it was lost.
+	Renew(ctx context.Context, key string, ttl time.Duration) error
+	// Release gives up a lease held by this instance.
+	Release(ctx context.Context, key string) error
+	// Close releases the resources held by the backend.
+	Close() error
+}
+
+// errLeaseLost is returned by Renew when the lease expired and was taken over, or was removed.
+var errLeaseLost = errors.New("run lock lease lost")
+
+// lockOwner identifies this process in lease records.
+var lockOwner = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d/%d", host, os.Getpid(), time.Now().UnixNano())
+}()
+
+// OpenRunLock opens the lock backend described by spec (RUN_LOCK): "" or "none" only relies on the scheduler
+// not overlapping runs within this process, "file:DIR" keeps lease files in a directory shared by the
+// instances, and "bigquery:TABLE" keeps lease rows in a BigQuery table ("dataset.table" or
+// "project.dataset.table") with the columns lockKey, owner, acquiredAt and expiresAt.
+func OpenRunLock(spec, secretName string) (RunLock, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "none":
+		return noRunLock{}, nil
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("run lock %q: missing directory", spec)
+		}
+		if err := os.MkdirAll(arg, 0o755); err != nil {
+			return nil, err
+		}
+		return fileRunLock{dir: arg, owner: lockOwner}, nil
+	case "bigquery":
+		client, err := GetBigQueryClient(secretName)
+		if err != nil {
+			log.Println("Failed to create BigQuery client: ", err)
+			return nil, err
+		}
+		table, err := bigQueryTable(client, arg)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		return &bigQueryRunLock{client: client, table: table}, nil
+	default:
+		return nil, fmt.Errorf("unknown run lock %q, expected none, file:DIR or bigquery:TABLE", spec)
+	}
+}
+
+// holdRunLock takes the lease for the run of day and keeps renewing it in the background. The returned context
+// is cancelled if the lease is lost, so the run stops sending; release must be called when the run ends.
+func holdRunLock(ctx context.Context, lock RunLock, day time.Time) (context.Context, func(), error) {
+	ttl := defaultRunLockTTL
+	if config.Run.LockTTL > 0 {
+		ttl = config.Run.LockTTL
+	}
+
+	key := fmt.Sprintf("%s/%s", config.Environment, day.Format("2006-01-02"))
+	holder, ok, err := lock.Acquire(ctx, key, ttl)
+	if err != nil {
+		log.Printf("Failed to acquire run lock %s: %v", key, err)
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("run lock %s is held by %s", key, holder)
+	}
+	log.Printf("Acquired run lock %s for %s", key, ttl)
+
+	lockedCtx, cancel := context.WithCancel(ctx)
+	// The lease is renewed until it is released, not until a shutdown cancels ctx: the run still drains and
+	// waits for its broadcast transactions then, and the day must stay locked meanwhile.
+	renewCtx := context.WithoutCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := lock.Renew(renewCtx, key, ttl); err != nil {
+					log.Printf("Failed to renew run lock %s: %v", key, err)
+					if errors.Is(err, errLeaseLost) {
+						sendAlert("Run lock lost", fmt.Sprintf("%s: stopping the run so another instance can take over", key))
+						cancel()
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	release := func() {
+		close(done)
+		cancel()
+		if err := lock.Release(renewCtx, key); err != nil {
+			log.Printf("Failed to release run lock %s: %v", key, err)
+		}
+	}
+	return lockedCtx, release, nil
+}
+
+// noRunLock always grants the lease.
+type noRunLock struct{}
+
+func (noRunLock) Acquire(context.Context, string, time.Duration) (string, bool, error) {
+	return lockOwner, true, nil
+}
+
+func (noRunLock) Renew(context.Context, string, time.Duration) error { return nil }
+
+func (noRunLock) Release(context.Context, string) error { return nil }
+
+func (noRunLock) Close() error { return nil }
+
+// fileRunLock keeps one lease file per key. Every change to a lease is made under an exclusive flock of a guard
+// file next to it, so two instances cannot both take over an expired lease.
+type fileRunLock struct {
+	dir   string
+	owner string
+}
+
+// fileLease is the content of a lease file.
+type fileLease struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (l fileRunLock) path(key string) string {
+	return filepath.Join(l.dir, strings.ReplaceAll(key, "/", "_")+".lock")
+}
+
+// guard takes the flock serialising the changes to key's lease; the returned function releases it.
+func (l fileRunLock) guard(key string) (func(), error) {
+	file, err := os.OpenFile(l.path(key)+".guard", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("locking %s: %w", file.Name(), err)
+	}
+	// Closing the file releases the flock.
+	return func() { file.Close() }, nil
+}
+
+func (l fileRunLock) read(key string) (fileLease, error) {
+	var lease fileLease
+	data, err := os.ReadFile(l.path(key))
+	if err != nil {
+		return lease, err
+	}
+	err = sonic.Unmarshal(data, &lease)
+	return lease, err
+}
+
+// write gives key's lease to this instance for ttl. The lease is written to a temporary file renamed over the
+// lease file, so it is never seen half written.
+func (l fileRunLock) write(key string, ttl time.Duration) error {
+	data, err := sonic.Marshal(fileLease{Owner: l.owner, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(l.dir, filepath.Base(l.path(key))+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), l.path(key))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (l fileRunLock) Acquire(_ context.Context, key string, ttl time.Duration) (string, bool, error) {
+	unlock, err := l.guard(key)
+	if err != nil {
+		return "", false, err
+	}
+	defer unlock()
+
+	lease, err := l.read(key)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return "", false, err
+	case time.Now().Before(lease.ExpiresAt):
+		return lease.Owner, false, nil
+	default:
+		log.Printf("Run lock %s held by %s expired at %s, taking it over", key, lease.Owner, lease.ExpiresAt)
+	}
+
+	if err := l.write(key, ttl); err != nil {
+		return "", false, err
+	}
+	return l.owner, true, nil
+}
+
+func (l fileRunLock) Renew(_ context.Context, key string, ttl time.Duration) error {
+	unlock, err := l.guard(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	lease, err := l.read(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return errLeaseLost
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Owner != l.owner {
+		return errLeaseLost
+	}
+	return l.write(key, ttl)
+}
+
+func (l fileRunLock) Release(_ context.Context, key string) error {
+	unlock, err := l.guard(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	lease, err := l.read(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Owner != l.owner {
+		return nil
+	}
+	return os.Remove(l.path(key))
+}
+
+func (fileRunLock) Close() error { return nil }
+
+// bigQueryRunLock keeps leases as rows of a BigQuery table. BigQuery serialises DML on a table, so the MERGE
+// that takes a free or expired lease is atomic; a concurrent MERGE fails instead of granting a second lease.
+type bigQueryRunLock struct {
+	client *bigquery.Client
+	table  *bigquery.Table
+}
+
+func (l *bigQueryRunLock) tableName() string {
+	return fmt.Sprintf("`%s.%s.%s`", l.table.ProjectID, l.table.DatasetID, l.table.TableID)
+}
+
+// run executes a DML statement and returns the number of rows it changed. Every statement is safe to repeat,
+// so transient failures are retried.
+func (l *bigQueryRunLock) run(ctx context.Context, sql string, params ...bigquery.QueryParameter) (int64, error) {
+	var affected int64
+	err := config.retryPolicy().do(ctx, "updating the run lock", func() error {
+		query := l.client.Query(sql)
+		query.Parameters = params
+		job, err := query.Run(ctx)
+		if err != nil {
+			return err
+		}
+		status, err := job.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		if err := status.Err(); err != nil {
+			return err
+		}
+		if stats, ok := status.Statistics.Details.(*bigquery.QueryStatistics); ok {
+			affected = stats.NumDMLAffectedRows
+		}
+		return nil
+	})
+	return affected, err
+}
+
+func (l *bigQueryRunLock) Acquire(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	_, err := l.run(ctx, fmt.Sprintf(`
+		MERGE %s AS lease
+		USING (SELECT @key AS lockKey) AS request
+		ON lease.lockKey = request.lockKey
+		WHEN MATCHED AND lease.expiresAt < CURRENT_TIMESTAMP() THEN
+			UPDATE SET
+				owner = @owner,
+				acquiredAt = CURRENT_TIMESTAMP(),
+				expiresAt = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl SECOND)
+		WHEN NOT MATCHED THEN
+			INSERT (lockKey, owner, acquiredAt, expiresAt)
+			VALUES (@key, @owner, CURRENT_TIMESTAMP(), TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl SECOND))
+	`, l.tableName()),
+		bigquery.QueryParameter{Name: "key", Value: key},
+		bigquery.QueryParameter{Name: "owner", Value: lockOwner},
+		bigquery.QueryParameter{Name: "ttl", Value: int64(ttl.Seconds())},
+	)
+	if err != nil {
+		return "", false, err
+	}
+
+	query := l.client.Query(fmt.Sprintf("SELECT owner FROM %s WHERE lockKey = @key", l.tableName()))
+	query.Parameters = []bigquery.QueryParameter{{Name: "key", Value: key}}
+	var rows *bigquery.RowIterator
+	err = config.retryPolicy().do(ctx, "reading the run lock", func() (err error) {
+		rows, err = query.Read(ctx)
+		return err
+	})
+	if err != nil {
+		return "", false, err
+	}
+	var row struct {
+		Owner string `bigquery:"owner"`
+	}
+	if err := rows.Next(&row); errors.Is(err, iterator.Done) {
+		return "", false, fmt.Errorf("run lock %s has no lease row after acquiring it", key)
+	} else if err != nil {
+		return "", false, err
+	}
+	return row.Owner, row.Owner == lockOwner, nil
+}
+
+func (l *bigQueryRunLock) Renew(ctx context.Context, key string, ttl time.Duration) error {
+	updated, err := l.run(ctx, fmt.Sprintf(`
+		UPDATE %s
+		SET expiresAt = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl SECOND)
+		WHERE lockKey = @key AND owner = @owner
+	`, l.tableName()),
+		bigquery.QueryParameter{Name: "key", Value: key},
+		bigquery.QueryParameter{Name: "owner", Value: lockOwner},
+		bigquery.QueryParameter{Name: "ttl", Value: int64(ttl.Seconds())},
+	)
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+func (l *bigQueryRunLock) Release(ctx context.Context, key string) error {
+	_, err := l.run(ctx, fmt.Sprintf("DELETE FROM %s WHERE lockKey = @key AND owner = @owner", l.tableName()),
+		bigquery.QueryParameter{Name: "key", Value: key},
+		bigquery.QueryParameter{Name: "owner", Value: lockOwner},
+	)
+	return err
+}
+
+func (l *bigQueryRunLock) Close() error {
+	return l.client.Close()
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/dotenv-org/godotenvvault"
 	"github.com/robfig/cron/v3"
@@ -15,14 +19,80 @@ func main() {
 		log.Println("Error loading .env file:", err)
 	}
 
-	secretName := fmt.Sprintf("%s/imaginereplay", os.Getenv("ENVIRONMENT"))
+	settings, err := LoadSettings()
+	if err != nil {
+		log.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+	config = settings
+
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		if err := runAdmin(os.Args[2:]); err != nil {
+			log.Println("Admin command failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	secretName := settings.SecretName()
+
+	// SIGTERM (sent by the platform on restart) and SIGINT stop new work; batches already broadcast are waited for.
+	// A second signal kills the process at once.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	// Create a new cron instance with a panic recovery wrapper
-	c := cron.New(cron.WithChain(cron.Recover(cron.DefaultLogger)))
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		if err := runReport(ctx, os.Args[2:], secretName); err != nil {
+			log.Println("Report failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "proof" {
+		if err := runProof(ctx, os.Args[2:]); err != nil {
+			log.Println("Proof failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Schedule the job to run at 00:10 every day
-	_, err = c.AddFunc("10 00 * * *", func() {
-		err := processJobs(secretName)
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		if err := runVerify(ctx, os.Args[2:]); err != nil {
+			log.Println("Verification failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		if err := runOnce(ctx, os.Args[2:], settings); err != nil {
+			log.Println("Run failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The scheduled job also needs what its sinks write with; fail now rather than at the first run.
+	if err := settings.checkJob(settings.Run.Sinks); err != nil {
+		log.Println("Invalid configuration:", err)
+		os.Exit(1)
+	}
+
+	// Create a new cron instance with a panic recovery wrapper that never starts a run while the previous one is
+	// still going; RUN_LOCK extends that guarantee across instances.
+	c := cron.New(cron.WithChain(cron.Recover(cron.DefaultLogger), cron.SkipIfStillRunning(cron.DefaultLogger)))
+
+	// Schedule the job, at 00:10 every day unless SCHEDULE says otherwise
+	_, err = c.AddFunc(settings.Schedule, func() {
+		opts, err := settings.defaultRunOptions()
+		if err == nil {
+			err = processJobs(ctx, secretName, opts)
+		}
 		if err != nil {
 			log.Println("Erro ao processar jobs:", err)
 		}
@@ -37,6 +107,15 @@ func main() {
 
 	fmt.Println("Cron started...")
 
-	// Block the main goroutine as long as the application is running
-	select {}
+	// Block the main goroutine until a shutdown signal arrives
+	<-ctx.Done()
+
+	shutdownTimeout := settings.ShutdownTimeout
+	log.Printf("Shutting down, waiting up to %s for the running job", shutdownTimeout)
+	select {
+	case <-c.Stop().Done():
+		log.Println("Shutdown complete")
+	case <-time.After(shutdownTimeout):
+		log.Printf("Running job did not finish within %s, its pending transactions are left in %s", shutdownTimeout, pendingTxFile())
+	}
 }
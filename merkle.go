@@ -0,0 +1,760 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const proofUsage = `usage: replay-bigquery-job proof -day DAY -user USER_ID -asset ASSET_ID [-target NAME]
+       replay-bigquery-job proof -verify PROOF.json [-chain=false] [-anchorer ADDRESS] [-rpc URL]
+
+The first form prints the inclusion proofs of the matching records from the trees stored in MERKLE_TREE_DIR.
+The second checks a printed proof and, unless -chain=false, that its root was anchored on chain by the
+anchoring account, -anchorer or MERKLE_ANCHORER. No signer key is needed: the transaction is read through -rpc
+or the preferred endpoint of the proof's chain target.`
+
+// merkleAnchorPrefix starts the calldata of a root anchoring transaction; the day and the 32-byte root follow.
+const merkleAnchorPrefix = "replay-merkle-v1:"
+
+// merkleTupleArguments is the ABI encoding of a Transaction tuple, field by field in contract order.
+var merkleTupleArguments = func() abi.Arguments {
+	stringType, _ := abi.NewType("string", "", nil)
+	uintType, _ := abi.NewType("uint256", "", nil)
+	return abi.Arguments{
+		{Name: "userId", Type: stringType},
+		{Name: "day", Type: uintType},
+		{Name: "month", Type: uintType},
+		{Name: "year", Type: uintType},
+		{Name: "totalDuration", Type: uintType},
+		{Name: "totalRewardsConsumer", Type: uintType},
+		{Name: "totalRewardsContentOwner", Type: uintType},
+		{Name: "assetId", Type: stringType},
+	}
+}()
+
+// merkleLeaf hashes a record the way OpenZeppelin's StandardMerkleTree does: keccak256 of keccak256 of the ABI
+// encoded tuple, so the proofs can also be checked with MerkleProof.verify on chain.
+func merkleLeaf(tx ReplayLibraryTransaction) (common.Hash, error) {
+	encoded, err := merkleTupleArguments.Pack(tx.UserId, tx.Day, tx.Month, tx.Year, tx.TotalDuration,
+		tx.TotalRewardsConsumer, tx.TotalRewardsContentOwner, tx.AssetId)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(crypto.Keccak256(encoded)), nil
+}
+
+// hashPair combines two nodes in sorted order, so a proof needs no left or right flags.
+func hashPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256Hash(a[:], b[:])
+}
+
+// buildMerkleLayers builds the tree bottom up over the sorted leaves. A node without a sibling moves up as is.
+func buildMerkleLayers(leaves []common.Hash) [][]common.Hash {
+	layer := append([]common.Hash(nil), leaves...)
+	sort.Slice(layer, func(i, j int) bool { return bytes.Compare(layer[i][:], layer[j][:]) < 0 })
+	layers := [][]common.Hash{layer}
+	for len(layer) > 1 {
+		next := make([]common.Hash, 0, (len(layer)+1)/2)
+		for i := 0; i < len(layer); i += 2 {
+			if i+1 < len(layer) {
+				next = append(next, hashPair(layer[i], layer[i+1]))
+			} else {
+				next = append(next, layer[i])
+			}
+		}
+		layers = append(layers, next)
+		layer = next
+	}
+	return layers
+}
+
+// merkleProofOf returns the siblings of the leaf at index, from the bottom of the tree up.
+func merkleProofOf(layers [][]common.Hash, index int) []common.Hash {
+	var proof []common.Hash
+	for _, layer := range layers[:len(layers)-1] {
+		if sibling := index ^ 1; sibling < len(layer) {
+			proof = append(proof, layer[sibling])
+		}
+		index /= 2
+	}
+	return proof
+}
+
+// verifyMerkleProof reports whether proof links leaf to root.
+func verifyMerkleProof(leaf common.Hash, proof []common.Hash, root common.Hash) bool {
+	node := leaf
+	for _, sibling := range proof {
+		node = hashPair(node, sibling)
+	}
+	return node == root
+}
+
+// merkleAnchorData is the calldata that anchors the root of a day.
+func merkleAnchorData(day string, root common.Hash) []byte {
+	return append([]byte(merkleAnchorPrefix+day+":"), root[:]...)
+}
+
+// merkleRecord is a leaf of a stored tree: the contract tuple, with amounts in wei, and the chunk it came from.
+type merkleRecord struct {
+	Leaf                        common.Hash `json:"leaf"`
+	JobID                       string      `json:"JOB_ID"`
+	ChunkID                     float64     `json:"CHUNK_ID"`
+	UserID                      string      `json:"userId"`
+	AssetID                     string      `json:"assetId"`
+	Day                         int64       `json:"day"`
+	Month                       int64       `json:"month"`
+	Year                        int64       `json:"year"`
+	TotalDuration               string      `json:"totalDuration"`
+	TotalRewardsConsumerWei     string      `json:"totalRewardsConsumerWei"`
+	TotalRewardsContentOwnerWei string      `json:"totalRewardsContentOwnerWei"`
+}
+
+// transaction rebuilds the contract tuple of the record.
+func (r merkleRecord) transaction() (ReplayLibraryTransaction, error) {
+	tx := ReplayLibraryTransaction{
+		UserId:  r.UserID,
+		AssetId: r.AssetID,
+		Day:     big.NewInt(r.Day),
+		Month:   big.NewInt(r.Month),
+		Year:    big.NewInt(r.Year),
+	}
+	for _, field := range []struct {
+		value string
+		out   **big.Int
+	}{
+		{r.TotalDuration, &tx.TotalDuration},
+		{r.TotalRewardsConsumerWei, &tx.TotalRewardsConsumer},
+		{r.TotalRewardsContentOwnerWei, &tx.TotalRewardsContentOwner},
+	} {
+		value, ok := new(big.Int).SetString(field.value, 10)
+		if !ok {
+			return tx, fmt.Errorf("invalid amount %q in record of %s", field.value, r.UserID)
+		}
+		*field.out = value
+	}
+	return tx, nil
+}
+
+// newMerkleRecord hashes the contract tuple of a row into its record.
+func newMerkleRecord(row JobDataRow, tx ReplayLibraryTransaction) (merkleRecord, error) {
+	leaf, err := merkleLeaf(tx)
+	if err != nil {
+		return merkleRecord{}, fmt.Errorf("encoding the record of %s: %w", tx.UserId, err)
+	}
+	return merkleRecord{
+		Leaf:                        leaf,
+		JobID:                       row.JobID,
+		ChunkID:                     row.ChunkID,
+		UserID:                      tx.UserId,
+		AssetID:                     tx.AssetId,
+		Day:                         tx.Day.Int64(),
+		Month:                       tx.Month.Int64(),
+		Year:                        tx.Year.Int64(),
+		TotalDuration:               tx.TotalDuration.String(),
+		TotalRewardsConsumerWei:     tx.TotalRewardsConsumer.String(),
+		TotalRewardsContentOwnerWei: tx.TotalRewardsContentOwner.String(),
+	}, nil
+}
+
+// merkleTree is the off-chain copy of a day's tree, stored as MERKLE_TREE_DIR/TARGET/DAY/ROOT.json next to
+// ROOT.records.jsonl, which lists its records one per line in the order the rows were read.
+type merkleTree struct {
+	Target      string          `json:"target"`
+	Day         string          `json:"day"`
+	Root        common.Hash     `json:"root"`
+	TxHash      *common.Hash    `json:"txHash,omitempty"`
+	BlockNumber uint64          `json:"blockNumber,omitempty"`
+	Rows        int             `json:"rows"`
+	Layers      [][]common.Hash `json:"layers"`
+
+	// records is the temporary file the records were written to until save moves it next to the tree.
+	records string
+}
+
+// buildMerkleTree builds the tree of the batches spilled for a day. Only the leaves are kept in memory: the
+// records are written to a temporary file in the tree's directory as the batches are read.
+func buildMerkleTree(target, day string, spill io.ReadSeeker) (*merkleTree, error) {
+	dir := filepath.Join(merkleTreeDir(), target, day)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, "records-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	var leaves []common.Hash
+	err = readSpill(spill, func(batch Batch) error {
+		for i, tx := range buildTransactions(batch.Rows) {
+			record, err := newMerkleRecord(batch.Rows[i], tx)
+			if err != nil {
+				return err
+			}
+			line, err := sonic.ConfigStd.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return err
+			}
+			leaves = append(leaves, record.Leaf)
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	layers := buildMerkleLayers(leaves)
+	return &merkleTree{Target: target, Day: day, Root: layers[len(layers)-1][0], Rows: len(leaves), Layers: layers,
+		records: file.Name()}, nil
+}
+
+// merkleTreeDir is where trees are stored, MERKLE_TREE_DIR or merkle_trees.
+func merkleTreeDir() string {
+	if dir := config.Chain.MerkleTreeDir; dir != "" {
+		return dir
+	}
+	return "merkle_trees"
+}
+
+func (t *merkleTree) path() string {
+	return filepath.Join(merkleTreeDir(), t.Target, t.Day, t.Root.Hex()+".json")
+}
+
+func (t *merkleTree) recordsPath() string {
+	return filepath.Join(merkleTreeDir(), t.Target, t.Day, t.Root.Hex()+".records.jsonl")
+}
+
+// save writes the tree through a rename, so a crash never leaves it half written. The records are moved into
+// place first, so a stored tree always has its records.
+func (t *merkleTree) save() error {
+	data, err := sonic.ConfigStd.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path()), 0o755); err != nil {
+		return err
+	}
+	if t.records != "" {
+		if err := os.Rename(t.records, t.recordsPath()); err != nil {
+			return err
+		}
+		t.records = ""
+	}
+	tmp := t.path() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path())
+}
+
+func loadMerkleTree(path string) (*merkleTree, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree merkleTree
+	if err := sonic.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &tree, nil
+}
+
+// discard removes the records of a tree that was not saved.
+func (t *merkleTree) discard() {
+	if t.records != "" {
+		os.Remove(t.records)
+		t.records = ""
+	}
+}
+
+// readJSONLines decodes every non-blank line of r into a T and passes it to fn, in order.
+func readJSONLines[T any](r io.Reader, fn func(T) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var value T
+			if err := sonic.ConfigStd.Unmarshal(line, &value); err != nil {
+				return err
+			}
+			if err := fn(value); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// readSpill passes the batches spilled to a file to fn, in the order they were written.
+func readSpill(spill io.ReadSeeker, fn func(Batch) error) error {
+	if _, err := spill.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return readJSONLines(spill, fn)
+}
+
+// merkleSink spills the batches of the run to a temporary file per day and, once every batch is in, anchors one
+// Merkle root per day on the target instead of writing the records themselves. Only the leaves of the day being
+// anchored are held in memory.
+type merkleSink struct {
+	target   *ChainTarget
+	spillDir string
+	days     map[string]*os.File
+}
+
+func (s *merkleSink) Name() string {
+	return "merkle:" + s.target.Name
+}
+
+func (s *merkleSink) Prepare(context.Context, runPlan, Batch) error {
+	return nil
+}
+
+// Write only spills the batch; it is anchored by Finish.
+func (s *merkleSink) Write(_ context.Context, batch Batch) (*anchoredBatch, error) {
+	spill, err := s.spill(batch.Rows[0].CreatedAtDay.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	line, err := sonic.ConfigStd.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	_, err = spill.Write(append(line, '\n'))
+	return nil, err
+}
+
+// spill returns the file the batches of a day are spilled to, creating it on first use.
+func (s *merkleSink) spill(day string) (*os.File, error) {
+	if file := s.days[day]; file != nil {
+		return file, nil
+	}
+	if s.spillDir == "" {
+		dir, err := os.MkdirTemp("", "merkle-spill-")
+		if err != nil {
+			return nil, err
+		}
+		s.spillDir = dir
+		s.days = make(map[string]*os.File)
+	}
+	file, err := os.Create(filepath.Join(s.spillDir, day+".jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	s.days[day] = file
+	return file, nil
+}
+
+func (s *merkleSink) Holds() bool {
+	return true
+}
+
+// Finish builds and stores the tree of every day, oldest first, and anchors its root. Every batch of the day is
+// then recorded with the anchoring transaction, and its rows in the audit trail.
+func (s *merkleSink) Finish(ctx context.Context, status *sinkStatus, audit *auditTrail, handled func(Batch, error)) {
+	days := make([]string, 0, len(s.days))
+	for day := range s.days {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, day := range days {
+		anchored, rows, err := s.anchorDay(ctx, day)
+		position := 0
+		readErr := readSpill(s.days[day], func(batch Batch) error {
+			status.record(batch, anchored, err)
+			if err == nil {
+				if err := audit.recordMerkle(context.WithoutCancel(ctx), batch, anchored, position, rows); err != nil {
+					sendAlert("Audit write failed", fmt.Sprintf("[%s] chunk %s, transaction %s: %v",
+						s.Name(), batch.Label(), anchored.TxHash.Hex(), err))
+				}
+			}
+			position += len(batch.Rows)
+			handled(batch, err)
+			return nil
+		})
+		if readErr != nil {
+			log.Printf("[%s] Failed to read the batches of %s back: %v", s.Name(), day, readErr)
+		}
+	}
+}
+
+// anchorDay builds the tree of the batches spilled for a day and anchors its root, returning how many rows it has.
+func (s *merkleSink) anchorDay(ctx context.Context, day string) (*anchoredBatch, int, error) {
+	if ctx.Err() != nil {
+		return nil, 0, fmt.Errorf("not sent: %w", ctx.Err())
+	}
+	tree, err := buildMerkleTree(s.target.Name, day, s.days[day])
+	if err != nil {
+		log.Printf("[%s] Error building the Merkle tree of %s: %v", s.Name(), day, err)
+		return nil, 0, err
+	}
+	defer tree.discard()
+
+	anchored, err := anchorMerkleRoot(ctx, s.target, tree)
+	if err != nil {
+		log.Printf("[%s] Error anchoring the Merkle root of %s (%d rows): %v", s.Name(), day, tree.Rows, err)
+	}
+	return anchored, tree.Rows, err
+}
+
+func (s *merkleSink) ResolvePending(ctx context.Context, firstDay time.Time) {
+	resolvePendingTxs(ctx, s.target, firstDay)
+}
+
+// Close removes the spilled batches.
+func (s *merkleSink) Close() error {
+	for _, file := range s.days {
+		file.Close()
+	}
+	if s.spillDir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.spillDir)
+}
+
+// merkleAnchorAddress is where the anchorer sends root anchoring transactions, MERKLE_ANCHOR_ADDRESS or the
+// anchorer itself.
+func merkleAnchorAddress(anchorer common.Address) common.Address {
+	if address := config.Chain.MerkleAnchorAddress; address != "" {
+		return common.HexToAddress(address)
+	}
+	return anchorer
+}
+
+// anchorMerkleRoot stores the tree of a day's rows and sends a transaction carrying its root. The tree is saved
+// before the transaction is signed, so an anchored root always has its tree on disk. A root already anchored by
+// an earlier run is not sent again.
+func anchorMerkleRoot(ctx context.Context, target *ChainTarget, tree *merkleTree) (*anchoredBatch, error) {
+	signer := target.SignerAddress()
+	if anchorer := config.Chain.MerkleAnchorer; anchorer != "" && common.HexToAddress(anchorer) != signer {
+		return nil, fmt.Errorf("signer %s is not the anchoring account MERKLE_ANCHORER %s, its roots would not verify", signer.Hex(), anchorer)
+	}
+	day, to := tree.Day, merkleAnchorAddress(signer)
+
+	client, err := target.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	anchored := &anchoredBatch{Target: target.Name, Signer: signer, Contract: to}
+	if stored, err := loadMerkleTree(tree.path()); err == nil && stored.TxHash != nil {
+		log.Printf("[%s] Merkle root %s of %s was already anchored in %s", target.Name, tree.Root.Hex(), day, stored.TxHash.Hex())
+		if anchored.Receipt, err = client.TransactionReceipt(ctx, *stored.TxHash); err != nil {
+			return nil, err
+		}
+		return anchored, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := tree.save(); err != nil {
+		log.Printf("[%s] Error storing the Merkle tree of %s: %v", target.Name, day, err)
+		return nil, err
+	}
+
+	chunk := "merkle-root:" + tree.Root.Hex()
+	pending, err := findPendingTx(target.Name, day, chunk)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		if anchored.Receipt, err = resumePendingTx(context.WithoutCancel(ctx), client, pending); err != nil {
+			return nil, err
+		}
+		anchored.Nonce = pending.Nonce
+	}
+	if anchored.Receipt == nil {
+		data := merkleAnchorData(day, tree.Root)
+		anchored.Receipt, anchored.Nonce, err = sendSigned(ctx, target, client, day, chunk, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+			return signAnchorTx(auth, client, to, data)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if anchored.Status != types.ReceiptStatusSuccessful {
+		return anchored, fmt.Errorf("transaction failed with status: %d", anchored.Status)
+	}
+	tree.TxHash = &anchored.TxHash
+	tree.BlockNumber = anchored.BlockNumber.Uint64()
+	if err := tree.save(); err != nil {
+		log.Printf("[%s] Error recording the anchoring transaction in the Merkle tree of %s: %v", target.Name, day, err)
+		return anchored, err
+	}
+	log.Printf("[%s] Merkle root %s of %d rows of %s anchored in %s", target.Name, tree.Root.Hex(), tree.Rows, day, anchored.TxHash.Hex())
+	return anchored, nil
+}
+
+// signAnchorTx signs a zero-value transaction to to carrying data, priced and numbered by auth.
+func signAnchorTx(auth *bind.TransactOpts, client chainClient, to common.Address, data []byte) (*types.Transaction, error) {
+	gas := auth.GasLimit
+	if gas == 0 {
+		var err error
+		if gas, err = client.EstimateGas(auth.Context, ethereum.CallMsg{From: auth.From, To: &to, Data: data}); err != nil {
+			return nil, err
+		}
+	}
+
+	var tx *types.Transaction
+	if auth.GasFeeCap != nil {
+		chainID, err := client.ChainID(auth.Context)
+		if err != nil {
+			return nil, err
+		}
+		tx = types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: auth.Nonce.Uint64(), GasTipCap: auth.GasTipCap,
+			GasFeeCap: auth.GasFeeCap, Gas: gas, To: &to, Value: new(big.Int), Data: data})
+	} else {
+		tx = types.NewTx(&types.LegacyTx{Nonce: auth.Nonce.Uint64(), GasPrice: auth.GasPrice, Gas: gas, To: &to,
+			Value: new(big.Int), Data: data})
+	}
+	return auth.Signer(auth.From, tx)
+}
+
+// merkleProof is the inclusion proof of one record, as printed by the proof command.
+type merkleProof struct {
+	Target string        `json:"target"`
+	Day    string        `json:"day"`
+	Root   common.Hash   `json:"root"`
+	TxHash *common.Hash  `json:"txHash,omitempty"`
+	Record merkleRecord  `json:"record"`
+	Proof  []common.Hash `json:"proof"`
+}
+
+// findMerkleProofs returns the proofs of the records of userId and assetId in every tree stored for the day,
+// optionally restricted to one target.
+func findMerkleProofs(target, day, userID, assetID string) ([]merkleProof, error) {
+	pattern := filepath.Join(merkleTreeDir(), "*", day, "*.json")
+	if target != "" {
+		pattern = filepath.Join(merkleTreeDir(), target, day, "*.json")
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var proofs []merkleProof
+	for _, path := range paths {
+		tree, err := loadMerkleTree(path)
+		if err != nil {
+			return nil, err
+		}
+		records, err := os.Open(tree.recordsPath())
+		if err != nil {
+			return nil, err
+		}
+		leaves := tree.Layers[0]
+		err = readJSONLines(records, func(record merkleRecord) error {
+			if record.UserID == userID && record.AssetID == assetID {
+				index := sort.Search(len(leaves), func(i int) bool { return bytes.Compare(leaves[i][:], record.Leaf[:]) >= 0 })
+				proofs = append(proofs, merkleProof{Target: tree.Target, Day: tree.Day, Root: tree.Root, TxHash: tree.TxHash,
+					Record: record, Proof: merkleProofOf(tree.Layers, index)})
+			}
+			return nil
+		})
+		records.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", tree.recordsPath(), err)
+		}
+	}
+	return proofs, nil
+}
+
+// verify checks that the record hashes to its leaf and the proof links the leaf to the root.
+func (p merkleProof) verify() error {
+	tx, err := p.Record.transaction()
+	if err != nil {
+		return err
+	}
+	leaf, err := merkleLeaf(tx)
+	if err != nil {
+		return err
+	}
+	if leaf != p.Record.Leaf {
+		return fmt.Errorf("record hashes to %s, not to its leaf %s", leaf.Hex(), p.Record.Leaf.Hex())
+	}
+	if !verifyMerkleProof(leaf, p.Proof, p.Root) {
+		return fmt.Errorf("proof does not lead to root %s", p.Root.Hex())
+	}
+	return nil
+}
+
+// verifyAnchored checks that the proof's transaction was sent by anchorer to its anchor address, mined
+// successfully and carries the root. Anyone can send the calldata; only the anchoring account vouches for it.
+func (p merkleProof) verifyAnchored(ctx context.Context, client chainClient, anchorer common.Address) error {
+	if p.TxHash == nil {
+		return fmt.Errorf("root %s has no anchoring transaction", p.Root.Hex())
+	}
+	tx, _, err := client.TransactionByHash(ctx, *p.TxHash)
+	if err != nil {
+		return fmt.Errorf("fetching transaction %s: %w", p.TxHash.Hex(), err)
+	}
+	if !bytes.Equal(tx.Data(), merkleAnchorData(p.Day, p.Root)) {
+		return fmt.Errorf("transaction %s does not carry root %s for %s", p.TxHash.Hex(), p.Root.Hex(), p.Day)
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return fmt.Errorf("recovering the sender of %s: %w", p.TxHash.Hex(), err)
+	}
+	if sender != anchorer {
+		return fmt.Errorf("transaction %s was sent by %s, not by the anchoring account %s", p.TxHash.Hex(), sender.Hex(), anchorer.Hex())
+	}
+	if to := merkleAnchorAddress(anchorer); tx.To() == nil || *tx.To() != to {
+		return fmt.Errorf("transaction %s was not sent to the anchor address %s", p.TxHash.Hex(), to.Hex())
+	}
+	receipt, err := client.TransactionReceipt(ctx, *p.TxHash)
+	if err != nil {
+		return fmt.Errorf("fetching the receipt of %s: %w", p.TxHash.Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("transaction %s failed with status %d", p.TxHash.Hex(), receipt.Status)
+	}
+	return nil
+}
+
+// runProof prints or verifies inclusion proofs.
+func runProof(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("proof", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), proofUsage) }
+	day := flags.String("day", "", "createdAtDay of the record (YYYY-MM-DD)")
+	userID := flags.String("user", "", "userId of the record")
+	assetID := flags.String("asset", "", "assetId of the record")
+	targetName := flags.String("target", "", "only look at the trees of this chain target")
+	verifyPath := flags.String("verify", "", "verify the proofs in this file, as printed by the first form")
+	onChain := flags.Bool("chain", true, "with -verify, also check the anchoring transaction on chain")
+	anchorerAddress := flags.String("anchorer", config.Chain.MerkleAnchorer, "with -verify, the account expected to have anchored the roots")
+	rpcURL := flags.String("rpc", "", "with -verify, read the transactions from this RPC URL instead of the proof's chain target")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *verifyPath == "" {
+		if _, err := time.Parse("2006-01-02", *day); err != nil || *userID == "" {
+			flags.Usage()
+			return fmt.Errorf("-day and -user are required")
+		}
+		proofs, err := findMerkleProofs(*targetName, *day, *userID, *assetID)
+		if err != nil {
+			return err
+		}
+		if len(proofs) == 0 {
+			return fmt.Errorf("no record of %q for asset %q in the trees of %s", *userID, *assetID, *day)
+		}
+		data, err := sonic.ConfigStd.MarshalIndent(proofs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	data, err := os.ReadFile(*verifyPath)
+	if err != nil {
+		return err
+	}
+	var proofs []merkleProof
+	if err := sonic.Unmarshal(data, &proofs); err != nil {
+		return fmt.Errorf("parsing %s: %w", *verifyPath, err)
+	}
+
+	var anchorer common.Address
+	var targets []*ChainTarget
+	if *onChain {
+		if !common.IsHexAddress(*anchorerAddress) {
+			return fmt.Errorf("-anchorer or MERKLE_ANCHORER must name the account that anchors the roots, got %q", *anchorerAddress)
+		}
+		anchorer = common.HexToAddress(*anchorerAddress)
+		if *rpcURL == "" {
+			if targets, err = LoadReadOnlyChainTargets(); err != nil {
+				return err
+			}
+		}
+	}
+	var failures []string
+	for _, proof := range proofs {
+		err := proof.verify()
+		if err == nil && *onChain {
+			var endpoint *RPCEndpoint
+			endpoint, err = proofEndpoint(targets, proof.Target, *rpcURL)
+			var client chainClient
+			if err == nil {
+				if client, err = dialRPC(ctx, endpoint.URL); err != nil {
+					err = fmt.Errorf("connecting to %s: %w", redactURL(endpoint.URL), err)
+				}
+			}
+			if err == nil {
+				err = proof.verifyAnchored(ctx, client, anchorer)
+				client.Close()
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s/%s: %v", proof.Record.UserID, proof.Record.AssetID, err))
+			continue
+		}
+		fmt.Printf("OK %s %s %s in root %s\n", proof.Day, proof.Record.UserID, proof.Record.AssetID, proof.Root.Hex())
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d proofs failed: %s", len(failures), len(proofs), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// proofEndpoint picks the endpoint a proof's transaction is read from: the first of the -rpc URLs, otherwise the
+// preferred endpoint of the proof's chain target.
+func proofEndpoint(targets []*ChainTarget, targetName, rpcURL string) (*RPCEndpoint, error) {
+	if endpoints := parseRPCURLs(rpcURL); len(endpoints) > 0 {
+		return &endpoints[0], nil
+	}
+	target, err := FindChainTarget(targets, targetName)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := target.preferredEndpoint()
+	if endpoint == nil {
+		return nil, fmt.Errorf("missing -rpc: chain target %q has no RPC endpoint", target.Name)
+	}
+	return endpoint, nil
+}
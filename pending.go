@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// pendingTx is a batch transaction that was signed and handed to the node but whose chunk has not been reported
+// as anchored yet. Entries are written before the transaction is broadcast and removed once the run sending the
+// chunk has its receipt, so a process stopped mid-batch leaves a record the next run uses instead of sending the
+// chunk again.
+type pendingTx struct {
+	Target string      `json:"target"`
+	Day    string      `json:"day"`
+	Chunk  string      `json:"chunk"`
+	TxHash common.Hash `json:"txHash"`
+	Nonce  uint64      `json:"nonce"`
+	SentAt time.Time   `json:"sentAt"`
+}
+
+// pendingMu serialises access to the pending transactions file across sink goroutines.
+var pendingMu sync.Mutex
+
+// pendingTxFile is the path of the pending transactions file, PENDING_TX_FILE or pending_transactions.json.
+func pendingTxFile() string {
+	if path := config.Run.PendingTxFile; path != "" {
+		return path
+	}
+	return "pending_transactions.json"
+}
+
+func readPendingTxs() ([]pendingTx, error) {
+	data, err := os.ReadFile(pendingTxFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []pendingTx
+	if err := sonic.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", pendingTxFile(), err)
+	}
+	return pending, nil
+}
+
+// writePendingTxs replaces the file through a rename, so a crash never leaves it half written.
+func writePendingTxs(pending []pendingTx) error {
+	path := pendingTxFile()
+	if len(pending) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := sonic.ConfigStd.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// rememberPendingTx records a transaction that is about to be broadcast.
+func rememberPendingTx(entry pendingTx) error {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	pending, err := readPendingTxs()
+	if err != nil {
+		return err
+	}
+	return writePendingTxs(append(pending, entry))
+}
+
+// forgetPendingTx removes a transaction once its outcome is known.
+func forgetPendingTx(target string, hash common.Hash) error {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	pending, err := readPendingTxs()
+	if err != nil {
+		return err
+	}
+	kept := pending[:0]
+	for _, entry := range pending {
+		if entry.Target != target || entry.TxHash != hash {
+			kept = append(kept, entry)
+		}
+	}
+	return writePendingTxs(kept)
+}
+
+// clearPendingTx forgets a pending transaction, logging when the file cannot be updated.
+func clearPendingTx(target string, hash common.Hash) {
+	if err := forgetPendingTx(target, hash); err != nil {
+		log.Printf("[%s] Failed to clear pending transaction %s: %v", target, hash.Hex(), err)
+	}
+}
+
+// findPendingTx returns the transaction left pending for a chunk of a day on a target, or nil.
+func findPendingTx(target, day, chunk string) (*pendingTx, error) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	pending, err := readPendingTxs()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range pending {
+		if entry.Target == target && entry.Day == day && entry.Chunk == chunk {
+			return &entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// resumePendingTx waits for a transaction sent by an earlier run. It returns a nil receipt when the node no
+// longer knows the transaction, in which case the entry is dropped and the chunk must be sent again.
+func resumePendingTx(ctx context.Context, client chainClient, entry *pendingTx) (*types.Receipt, error) {
+	err := config.retryPolicy().do(ctx, "looking up a pending transaction", func() error {
+		_, _, err := client.TransactionByHash(ctx, entry.TxHash)
+		return err
+	})
+	if errors.Is(err, ethereum.NotFound) {
+		log.Printf("[%s] Pending transaction %s for chunk %s was dropped, sending the chunk again",
+			entry.Target, entry.TxHash.Hex(), entry.Chunk)
+		return nil, forgetPendingTx(entry.Target, entry.TxHash)
+	} else if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[%s] Chunk %s was already sent in %s, waiting for it instead of sending it again",
+		entry.Target, entry.Chunk, entry.TxHash.Hex())
+	receipt, err := waitForConfirmation(ctx, client, entry.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	clearPendingTx(entry.Target, entry.TxHash)
+	return receipt, nil
+}
+
+// resolvePendingTxs settles the transactions an interrupted run left pending on the target, for a run starting
+// at firstDay. Successful ones are reported and kept, so the chunk they anchored is resumed from its receipt
+// instead of being sent again when the run reads it; failed and dropped ones are cleared so their chunk is sent
+// again; the rest are kept for the run that processes their day. Mined entries of days before firstDay are
+// cleared, since no run reads those days any more.
+func resolvePendingTxs(ctx context.Context, target *ChainTarget, firstDay time.Time) {
+	pendingMu.Lock()
+	pending, err := readPendingTxs()
+	pendingMu.Unlock()
+	if err != nil {
+		log.Printf("[%s] Failed to read pending transactions: %v", target.Name, err)
+		return
+	}
+
+	var own []pendingTx
+	for _, entry := range pending {
+		if entry.Target == target.Name {
+			own = append(own, entry)
+		}
+	}
+	if len(own) == 0 {
+		return
+	}
+
+	client, err := target.Dial(ctx)
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	for _, entry := range own {
+		receipt, err := client.TransactionReceipt(ctx, entry.TxHash)
+		switch {
+		case err == nil && receipt.Status != types.ReceiptStatusSuccessful:
+			log.Printf("[%s] Pending transaction %s for chunk %s of %s failed with status %d",
+				target.Name, entry.TxHash.Hex(), entry.Chunk, entry.Day, receipt.Status)
+			sendAlert("Interrupted batch failed", fmt.Sprintf("[%s] chunk %s of %s, transaction %s",
+				target.Name, entry.Chunk, entry.Day, entry.TxHash.Hex()))
+			err = forgetPendingTx(target.Name, entry.TxHash)
+		case err == nil && entry.Day < firstDay.Format("2006-01-02"):
+			log.Printf("[%s] Pending transaction %s anchored chunk %s of %s, which is no longer read",
+				target.Name, entry.TxHash.Hex(), entry.Chunk, entry.Day)
+			err = forgetPendingTx(target.Name, entry.TxHash)
+		case err == nil:
+			log.Printf("[%s] Pending transaction %s anchored chunk %s of %s, the chunk will not be sent again",
+				target.Name, entry.TxHash.Hex(), entry.Chunk, entry.Day)
+		case errors.Is(err, ethereum.NotFound):
+			if _, _, err = client.TransactionByHash(ctx, entry.TxHash); errors.Is(err, ethereum.NotFound) {
+				sendAlert("Interrupted batch dropped", fmt.Sprintf("[%s] chunk %s of %s was never mined and must be sent again",
+					target.Name, entry.Chunk, entry.Day))
+				err = forgetPendingTx(target.Name, entry.TxHash)
+			} else if err == nil {
+				log.Printf("[%s] Transaction %s for chunk %s of %s is still pending",
+					target.Name, entry.TxHash.Hex(), entry.Chunk, entry.Day)
+			}
+		}
+		if err != nil {
+			log.Printf("[%s] Failed to resolve pending transaction %s: %v", target.Name, entry.TxHash.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// contractPollInterval is how often checkContractReady re-checks a paused contract or a missing role.
+const contractPollInterval = time.Minute
+
+// balanceSafetyMarginPercent is added on top of the estimated run cost to absorb gas price movement during the run.
+const balanceSafetyMarginPercent = 20
+
+// checkContractReady verifies that the records contract is not paused and that the target's signer holds
+// ADMIN_ROLE, which batchInsertRecords requires. While either check fails it keeps polling for up to
+// PREFLIGHT_MAX_WAIT (a Go duration, default 0) and then gives up on the target. The deployment checked is the
+// one active for day.
+func checkContractReady(ctx context.Context, target *ChainTarget, day time.Time) error {
+	maxWait := config.Chain.PreflightMaxWait
+
+	client, err := target.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fromAddress := target.SignerAddress()
+
+	deployment, records, err := target.registry.BindActive(ctx, client, day)
+	if err != nil {
+		log.Printf("[%s] Error binding records contract: %v", target.Name, err)
+		return err
+	}
+	contractAddress := deployment.ContractAddress()
+
+	deadline := time.Now().Add(maxWait)
+	for {
+		problem, err := contractProblem(ctx, records, fromAddress)
+		if err != nil {
+			log.Printf("[%s] Error reading contract state: %v", target.Name, err)
+			return err
+		}
+		if problem == "" {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			sendAlert("Contract not ready", fmt.Sprintf("[%s] %s", target.Name, problem))
+			return fmt.Errorf("contract %s is not ready: %s", contractAddress.Hex(), problem)
+		}
+
+		log.Printf("[%s] Contract %s is not ready (%s), checking again in %s",
+			target.Name, contractAddress.Hex(), problem, contractPollInterval)
+		select {
+		case <-time.After(contractPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// contractProblem describes why the deployer cannot write to the contract right now, or returns "" when it can.
+func contractProblem(ctx context.Context, records *Records, fromAddress common.Address) (string, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	paused, err := records.Paused(opts)
+	if err != nil {
+		return "", err
+	}
+	if paused {
+		return "contract is paused", nil
+	}
+
+	adminRole, err := records.ADMINROLE(opts)
+	if err != nil {
+		return "", err
+	}
+
+	hasRole, err := records.HasRole(opts, adminRole, fromAddress)
+	if err != nil {
+		return "", err
+	}
+	if !hasRole {
+		return fmt.Sprintf("signer %s does not hold ADMIN_ROLE (0x%x)", fromAddress.Hex(), adminRole), nil
+	}
+
+	return "", nil
+}
+
+// checkDeployerBalance verifies that the target's signer can pay for the whole run before anything is sent.
+// The gas of the sample batch is estimated and scaled to the number of rows in the plan; since part of every
+// transaction's cost is fixed, scaling per row overestimates slightly, which errs on the safe side.
+func checkDeployerBalance(ctx context.Context, target *ChainTarget, plan runPlan, sample Batch) error {
+	client, err := target.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fromAddress := target.SignerAddress()
+
+	balance, err := client.BalanceAt(ctx, fromAddress, nil)
+	if err != nil {
+		log.Printf("[%s] Error fetching deployer balance: %v", target.Name, err)
+		return err
+	}
+
+	_, records, err := target.registry.BindActive(ctx, client, sample.Rows[0].CreatedAtDay)
+	if err != nil {
+		log.Printf("[%s] Error binding records contract: %v", target.Name, err)
+		return err
+	}
+
+	auth, err := newTransactOpts(ctx, client, target.privateKey, target.Fees)
+	if err != nil {
+		return err
+	}
+	auth.NoSend = true
+
+	// Building the sample batch without sending it makes the binding estimate its gas limit.
+	estimate, err := records.BatchInsertRecords(auth, buildTransactions(sample.Rows))
+	if err != nil {
+		log.Printf("[%s] Error estimating gas limit: %v", target.Name, err)
+		return err
+	}
+
+	required := new(big.Int).Mul(new(big.Int).SetUint64(estimate.Gas()), estimate.GasFeeCap())
+	required.Mul(required, big.NewInt(plan.Rows))
+	required.Div(required, big.NewInt(int64(len(sample.Rows))))
+	required.Mul(required, big.NewInt(100+balanceSafetyMarginPercent))
+	required.Div(required, big.NewInt(100))
+
+	log.Printf("[%s] Deployer %s balance: %s ETH, estimated cost of %d rows: %s ETH",
+		target.Name, fromAddress.Hex(), FromWei(balance), plan.Rows, FromWei(required))
+
+	if balance.Cmp(required) < 0 {
+		message := fmt.Sprintf("[%s] deployer %s holds %s ETH but the run needs about %s ETH for %d rows",
+			target.Name, fromAddress.Hex(), FromWei(balance), FromWei(required), plan.Rows)
+		sendAlert("Insufficient deployer balance", message)
+		return fmt.Errorf("insufficient deployer balance: %s", message)
+	}
+
+	return nil
+}
+
+// warnIfLowBalance alerts when the target's signer balance is below its lowBalanceThreshold (in ETH) after a run.
+func warnIfLowBalance(target *ChainTarget) {
+	if target.LowBalanceThreshold <= 0 {
+		return
+	}
+
+	client, err := target.Dial(context.Background())
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	fromAddress := target.SignerAddress()
+
+	balance, err := client.BalanceAt(context.Background(), fromAddress, nil)
+	if err != nil {
+		log.Printf("[%s] Error fetching deployer balance: %v", target.Name, err)
+		return
+	}
+
+	if balance.Cmp(ToWei(target.LowBalanceThreshold)) < 0 {
+		sendAlert("Low deployer balance", fmt.Sprintf("[%s] deployer %s balance is %s ETH, below the %g ETH threshold",
+			target.Name, fromAddress.Hex(), FromWei(balance), target.LowBalanceThreshold))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// transactionAddedID is the topic identifying TransactionAdded logs.
+var transactionAddedID = func() common.Hash {
+	parsedABI, err := RecordsMetaData.GetAbi()
+	if err != nil {
+		panic(fmt.Sprintf("parsing the records ABI: %v", err))
+	}
+	return parsedABI.Events["TransactionAdded"].ID
+}()
+
+// transactionAddedLogs returns the TransactionAdded logs of a receipt in the order they were emitted.
+func transactionAddedLogs(receipt *types.Receipt) []*types.Log {
+	var logs []*types.Log
+	for _, vLog := range receipt.Logs {
+		if len(vLog.Topics) > 0 && vLog.Topics[0] == transactionAddedID {
+			logs = append(logs, vLog)
+		}
+	}
+	return logs
+}
+
+// transactionAddedLogIndexes returns the block log index of every TransactionAdded log of a receipt. Once the
+// receipt passed verifyReceiptLogs, the i-th index belongs to the i-th row of the batch.
+func transactionAddedLogIndexes(receipt *types.Receipt) []uint {
+	logs := transactionAddedLogs(receipt)
+	indexes := make([]uint, len(logs))
+	for i, vLog := range logs {
+		indexes[i] = vLog.Index
+	}
+	return indexes
+}
+
+// verifyReceiptLogs checks that the contract emitted exactly one TransactionAdded event per row of the batch,
+// in order and with the submitted values. A successful status only means the call did not revert; this catches
+// a contract that skipped, duplicated or altered records without reverting.
+func verifyReceiptLogs(records *Records, contract common.Address, batch Batch, receipt *types.Receipt) error {
+	logs := transactionAddedLogs(receipt)
+	expected := buildTransactions(batch.Rows)
+	if len(logs) != len(expected) {
+		return fmt.Errorf("receipt has %d TransactionAdded events for %d rows", len(logs), len(expected))
+	}
+
+	for i, vLog := range logs {
+		if vLog.Address != contract {
+			return fmt.Errorf("row %d: TransactionAdded event emitted by %s instead of the records contract %s",
+				i, vLog.Address.Hex(), contract.Hex())
+		}
+		event, err := records.ParseTransactionAdded(*vLog)
+		if err != nil {
+			return fmt.Errorf("row %d: decoding TransactionAdded event at log index %d: %w", i, vLog.Index, err)
+		}
+
+		want := expected[i]
+		if event.UserId != crypto.Keccak256Hash([]byte(want.UserId)) {
+			return fmt.Errorf("row %d: event at log index %d is for another userId than %q", i, vLog.Index, want.UserId)
+		}
+		if event.AssetId != want.AssetId {
+			return fmt.Errorf("row %d: event at log index %d has assetId %q, submitted %q", i, vLog.Index, event.AssetId, want.AssetId)
+		}
+		for _, field := range []struct {
+			name      string
+			got, want *big.Int
+		}{
+			{"day", event.Day, want.Day},
+			{"month", event.Month, want.Month},
+			{"year", event.Year, want.Year},
+			{"totalDuration", event.TotalDuration, want.TotalDuration},
+			{"totalRewardsConsumer", event.TotalRewardsConsumer, want.TotalRewardsConsumer},
+			{"totalRewardsContentOwner", event.TotalRewardsContentOwner, want.TotalRewardsContentOwner},
+		} {
+			if field.got.Cmp(field.want) != 0 {
+				return fmt.Errorf("row %d: event at log index %d has %s %s, submitted %s",
+					i, vLog.Index, field.name, field.got, field.want)
+			}
+		}
+	}
+
+	return nil
+}
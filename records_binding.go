@@ -0,0 +1,1789 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package main
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = errors.New
+	_ = big.NewInt
+	_ = strings.NewReader
+	_ = ethereum.NotFound
+	_ = bind.Bind
+	_ = common.Big1
+	_ = types.BloomLookup
+	_ = event.NewSubscription
+	_ = abi.ConvertType
+)
+
+// ReplayLibraryTransaction is an auto generated low-level Go binding around an user-defined struct.
+type ReplayLibraryTransaction struct {
+	UserId                   string
+	Day                      *big.Int
+	Month                    *big.Int
+	Year                     *big.Int
+	TotalDuration            *big.Int
+	TotalRewardsConsumer     *big.Int
+	TotalRewardsContentOwner *big.Int
+	AssetId                  string
+}
+
+// RecordsMetaData contains all meta data concerning the Records contract.
+var RecordsMetaData = &bind.MetaData{
+	ABI: "[{\"inputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"constructor\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"address\",\"name\":\"previousOwner\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"newOwner\",\"type\":\"address\"}],\"name\":\"OwnershipTransferred\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"}],\"name\":\"Paused\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"role\",\"type\":\"bytes32\"},{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"previousAdminRole\",\"type\":\"bytes32\"},{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"newAdminRole\",\"type\":\"bytes32\"}],\"name\":\"RoleAdminChanged\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"role\",\"type\":\"bytes32\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"sender\",\"type\":\"address\"}],\"name\":\"RoleGranted\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"role\",\"type\":\"bytes32\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"},{\"indexed\":true,\"internalType\":\"address\",\"name\":\"sender\",\"type\":\"address\"}],\"name\":\"RoleRevoked\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"string\",\"name\":\"userId\",\"type\":\"string\"},{\"indexed\":true,\"internalType\":\"uint256\",\"name\":\"day\",\"type\":\"uint256\"},{\"indexed\":true,\"internalType\":\"uint256\",\"name\":\"month\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"year\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"string\",\"name\":\"assetId\",\"type\":\"string\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"totalDuration\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"totalRewardsConsumer\",\"type\":\"uint256\"},{\"indexed\":false,\"internalType\":\"uint256\",\"name\":\"totalRewardsContentOwner\",\"type\":\"uint256\"}],\"name\":\"TransactionAdded\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":false,\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"}],\"name\":\"Unpaused\",\"type\":\"event\"},{\"inputs\":[],\"name\":\"ADMIN_ROLE\",\"outputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"DEFAULT_ADMIN_ROLE\",\"outputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"components\":[{\"internalType\":\"string\",\"name\":\"userId\",\"type\":\"string\"},{\"internalType\":\"uint256\",\"name\":\"day\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"month\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"year\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalDuration\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalRewardsConsumer\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalRewardsContentOwner\",\"type\":\"uint256\"},{\"internalType\":\"string\",\"name\":\"assetId\",\"type\":\"string\"}],\"internalType\":\"structReplayLibrary.Transaction[]\",\"name\":\"transactions\",\"type\":\"tuple[]\"}],\"name\":\"batchInsertRecords\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"},{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"name\":\"dailyTransactions\",\"outputs\":[{\"internalType\":\"string\",\"name\":\"userId\",\"type\":\"string\"},{\"internalType\":\"uint256\",\"name\":\"day\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"month\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"year\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalDuration\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalRewardsConsumer\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalRewardsContentOwner\",\"type\":\"uint256\"},{\"internalType\":\"string\",\"name\":\"assetId\",\"type\":\"string\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"role\",\"type\":\"bytes32\"}],\"name\":\"getRoleAdmin\",\"outputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"string\",\"name\":\"userId\",\"type\":\"string\"},{\"internalType\":\"uint256\",\"name\":\"day\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"month\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"year\",\"type\":\"uint256\"},{\"internalType\":\"string\",\"name\":\"assetId\",\"type\":\"string\"}],\"name\":\"getTransactionsByDay\",\"outputs\":[{\"components\":[{\"internalType\":\"string\",\"name\":\"userId\",\"type\":\"string\"},{\"internalType\":\"uint256\",\"name\":\"day\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"month\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"year\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalDuration\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalRewardsConsumer\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"totalRewardsContentOwner\",\"type\":\"uint256\"},{\"internalType\":\"string\",\"name\":\"assetId\",\"type\":\"string\"}],\"internalType\":\"structReplayLibrary.Transaction[]\",\"name\":\"\",\"type\":\"tuple[]\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"role\",\"type\":\"bytes32\"},{\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"}],\"name\":\"grantRole\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"role\",\"type\":\"bytes32\"},{\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"}],\"name\":\"hasRole\",\"outputs\":[{\"internalType\":\"bool\",\"name\":\"\",\"type\":\"bool\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"string\",\"name\":\"\",\"type\":\"string\"}],\"name\":\"nonces\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"owner\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"pause\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"paused\",\"outputs\":[{\"internalType\":\"bool\",\"name\":\"\",\"type\":\"bool\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"renounceOwnership\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"role\",\"type\":\"bytes32\"},{\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"}],\"name\":\"renounceRole\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"role\",\"type\":\"bytes32\"},{\"internalType\":\"address\",\"name\":\"account\",\"type\":\"address\"}],\"name\":\"revokeRole\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"bytes4\",\"name\":\"interfaceId\",\"type\":\"bytes4\"}],\"name\":\"supportsInterface\",\"outputs\":[{\"internalType\":\"bool\",\"name\":\"\",\"type\":\"bool\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"newOwner\",\"type\":\"address\"}],\"name\":\"transferOwnership\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"unpause\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"}]",
+}
+
+// RecordsABI is the input ABI used to generate the binding from.
+// Deprecated: Use RecordsMetaData.ABI instead.
+var RecordsABI = RecordsMetaData.ABI
+
+// Records is an auto generated Go binding around an Ethereum contract.
+type Records struct {
+	RecordsCaller     // Read-only binding to the contract
+	RecordsTransactor // Write-only binding to the contract
+	RecordsFilterer   // Log filterer for contract events
+}
+
+// RecordsCaller is an auto generated read-only Go binding around an Ethereum contract.
+type RecordsCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// RecordsTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type RecordsTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// RecordsFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type RecordsFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// RecordsSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type RecordsSession struct {
+	Contract     *Records          // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// RecordsCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type RecordsCallerSession struct {
+	Contract *RecordsCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts  // Call options to use throughout this session
+}
+
+// RecordsTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type RecordsTransactorSession struct {
+	Contract     *RecordsTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts  // Transaction auth options to use throughout this session
+}
+
+// RecordsRaw is an auto generated low-level Go binding around an Ethereum contract.
+type RecordsRaw struct {
+	Contract *Records // Generic contract binding to access the raw methods on
+}
+
+// RecordsCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type RecordsCallerRaw struct {
+	Contract *RecordsCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// RecordsTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type RecordsTransactorRaw struct {
+	Contract *RecordsTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewRecords creates a new instance of Records, bound to a specific deployed contract.
+func NewRecords(address common.Address, backend bind.ContractBackend) (*Records, error) {
+	contract, err := bindRecords(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Records{RecordsCaller: RecordsCaller{contract: contract}, RecordsTransactor: RecordsTransactor{contract: contract}, RecordsFilterer: RecordsFilterer{contract: contract}}, nil
+}
+
+// NewRecordsCaller creates a new read-only instance of Records, bound to a specific deployed contract.
+func NewRecordsCaller(address common.Address, caller bind.ContractCaller) (*RecordsCaller, error) {
+	contract, err := bindRecords(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsCaller{contract: contract}, nil
+}
+
+// NewRecordsTransactor creates a new write-only instance of Records, bound to a specific deployed contract.
+func NewRecordsTransactor(address common.Address, transactor bind.ContractTransactor) (*RecordsTransactor, error) {
+	contract, err := bindRecords(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsTransactor{contract: contract}, nil
+}
+
+// NewRecordsFilterer creates a new log filterer instance of Records, bound to a specific deployed contract.
+func NewRecordsFilterer(address common.Address, filterer bind.ContractFilterer) (*RecordsFilterer, error) {
+	contract, err := bindRecords(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsFilterer{contract: contract}, nil
+}
+
+// bindRecords binds a generic wrapper to an already deployed contract.
+func bindRecords(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := RecordsMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, *parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Records *RecordsRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _Records.Contract.RecordsCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Records *RecordsRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Records.Contract.RecordsTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Records *RecordsRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Records.Contract.RecordsTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_Records *RecordsCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _Records.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_Records *RecordsTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Records.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_Records *RecordsTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _Records.Contract.contract.Transact(opts, method, params...)
+}
+
+// ADMINROLE is a free data retrieval call binding the contract method 0x75b238fc.
+//
+// Solidity: function ADMIN_ROLE() view returns(bytes32)
+func (_Records *RecordsCaller) ADMINROLE(opts *bind.CallOpts) ([32]byte, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "ADMIN_ROLE")
+
+	if err != nil {
+		return *new([32]byte), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new([32]byte)).(*[32]byte)
+
+	return out0, err
+
+}
+
+// ADMINROLE is a free data retrieval call binding the contract method 0x75b238fc.
+//
+// Solidity: function ADMIN_ROLE() view returns(bytes32)
+func (_Records *RecordsSession) ADMINROLE() ([32]byte, error) {
+	return _Records.Contract.ADMINROLE(&_Records.CallOpts)
+}
+
+// ADMINROLE is a free data retrieval call binding the contract method 0x75b238fc.
+//
+// Solidity: function ADMIN_ROLE() view returns(bytes32)
+func (_Records *RecordsCallerSession) ADMINROLE() ([32]byte, error) {
+	return _Records.Contract.ADMINROLE(&_Records.CallOpts)
+}
+
+// DEFAULTADMINROLE is a free data retrieval call binding the contract method 0xa217fddf.
+//
+// Solidity: function DEFAULT_ADMIN_ROLE() view returns(bytes32)
+func (_Records *RecordsCaller) DEFAULTADMINROLE(opts *bind.CallOpts) ([32]byte, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "DEFAULT_ADMIN_ROLE")
+
+	if err != nil {
+		return *new([32]byte), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new([32]byte)).(*[32]byte)
+
+	return out0, err
+
+}
+
+// DEFAULTADMINROLE is a free data retrieval call binding the contract method 0xa217fddf.
+//
+// Solidity: function DEFAULT_ADMIN_ROLE() view returns(bytes32)
+func (_Records *RecordsSession) DEFAULTADMINROLE() ([32]byte, error) {
+	return _Records.Contract.DEFAULTADMINROLE(&_Records.CallOpts)
+}
+
+// DEFAULTADMINROLE is a free data retrieval call binding the contract method 0xa217fddf.
+//
+// Solidity: function DEFAULT_ADMIN_ROLE() view returns(bytes32)
+func (_Records *RecordsCallerSession) DEFAULTADMINROLE() ([32]byte, error) {
+	return _Records.Contract.DEFAULTADMINROLE(&_Records.CallOpts)
+}
+
+// DailyTransactions is a free data retrieval call binding the contract method 0xd5ee8be1.
+//
+// Solidity: function dailyTransactions(bytes32 , uint256 ) view returns(string userId, uint256 day, uint256 month, uint256 year, uint256 totalDuration, uint256 totalRewardsConsumer, uint256 totalRewardsContentOwner, string assetId)
+func (_Records *RecordsCaller) DailyTransactions(opts *bind.CallOpts, arg0 [32]byte, arg1 *big.Int) (struct {
+	UserId                   string
+	Day                      *big.Int
+	Month                    *big.Int
+	Year                     *big.Int
+	TotalDuration            *big.Int
+	TotalRewardsConsumer     *big.Int
+	TotalRewardsContentOwner *big.Int
+	AssetId                  string
+}, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "dailyTransactions", arg0, arg1)
+
+	outstruct := new(struct {
+		UserId                   string
+		Day                      *big.Int
+		Month                    *big.Int
+		Year                     *big.Int
+		TotalDuration            *big.Int
+		TotalRewardsConsumer     *big.Int
+		TotalRewardsContentOwner *big.Int
+		AssetId                  string
+	})
+	if err != nil {
+		return *outstruct, err
+	}
+
+	outstruct.UserId = *abi.ConvertType(out[0], new(string)).(*string)
+	outstruct.Day = *abi.ConvertType(out[1], new(*big.Int)).(**big.Int)
+	outstruct.Month = *abi.ConvertType(out[2], new(*big.Int)).(**big.Int)
+	outstruct.Year = *abi.ConvertType(out[3], new(*big.Int)).(**big.Int)
+	outstruct.TotalDuration = *abi.ConvertType(out[4], new(*big.Int)).(**big.Int)
+	outstruct.TotalRewardsConsumer = *abi.ConvertType(out[5], new(*big.Int)).(**big.Int)
+	outstruct.TotalRewardsContentOwner = *abi.ConvertType(out[6], new(*big.Int)).(**big.Int)
+	outstruct.AssetId = *abi.ConvertType(out[7], new(string)).(*string)
+
+	return *outstruct, err
+
+}
+
+// DailyTransactions is a free data retrieval call binding the contract method 0xd5ee8be1.
+//
+// Solidity: function dailyTransactions(bytes32 , uint256 ) view returns(string userId, uint256 day, uint256 month, uint256 year, uint256 totalDuration, uint256 totalRewardsConsumer, uint256 totalRewardsContentOwner, string assetId)
+func (_Records *RecordsSession) DailyTransactions(arg0 [32]byte, arg1 *big.Int) (struct {
+	UserId                   string
+	Day                      *big.Int
+	Month                    *big.Int
+	Year                     *big.Int
+	TotalDuration            *big.Int
+	TotalRewardsConsumer     *big.Int
+	TotalRewardsContentOwner *big.Int
+	AssetId                  string
+}, error) {
+	return _Records.Contract.DailyTransactions(&_Records.CallOpts, arg0, arg1)
+}
+
+// DailyTransactions is a free data retrieval call binding the contract method 0xd5ee8be1.
+//
+// Solidity: function dailyTransactions(bytes32 , uint256 ) view returns(string userId, uint256 day, uint256 month, uint256 year, uint256 totalDuration, uint256 totalRewardsConsumer, uint256 totalRewardsContentOwner, string assetId)
+func (_Records *RecordsCallerSession) DailyTransactions(arg0 [32]byte, arg1 *big.Int) (struct {
+	UserId                   string
+	Day                      *big.Int
+	Month                    *big.Int
+	Year                     *big.Int
+	TotalDuration            *big.Int
+	TotalRewardsConsumer     *big.Int
+	TotalRewardsContentOwner *big.Int
+	AssetId                  string
+}, error) {
+	return _Records.Contract.DailyTransactions(&_Records.CallOpts, arg0, arg1)
+}
+
+// GetRoleAdmin is a free data retrieval call binding the contract method 0x248a9ca3.
+//
+// Solidity: function getRoleAdmin(bytes32 role) view returns(bytes32)
+func (_Records *RecordsCaller) GetRoleAdmin(opts *bind.CallOpts, role [32]byte) ([32]byte, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "getRoleAdmin", role)
+
+	if err != nil {
+		return *new([32]byte), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new([32]byte)).(*[32]byte)
+
+	return out0, err
+
+}
+
+// GetRoleAdmin is a free data retrieval call binding the contract method 0x248a9ca3.
+//
+// Solidity: function getRoleAdmin(bytes32 role) view returns(bytes32)
+func (_Records *RecordsSession) GetRoleAdmin(role [32]byte) ([32]byte, error) {
+	return _Records.Contract.GetRoleAdmin(&_Records.CallOpts, role)
+}
+
+// GetRoleAdmin is a free data retrieval call binding the contract method 0x248a9ca3.
+//
+// Solidity: function getRoleAdmin(bytes32 role) view returns(bytes32)
+func (_Records *RecordsCallerSession) GetRoleAdmin(role [32]byte) ([32]byte, error) {
+	return _Records.Contract.GetRoleAdmin(&_Records.CallOpts, role)
+}
+
+// GetTransactionsByDay is a free data retrieval call binding the contract method 0x175743c5.
+//
+// Solidity: function getTransactionsByDay(string userId, uint256 day, uint256 month, uint256 year, string assetId) view returns((string,uint256,uint256,uint256,uint256,uint256,uint256,string)[])
+func (_Records *RecordsCaller) GetTransactionsByDay(opts *bind.CallOpts, userId string, day *big.Int, month *big.Int, year *big.Int, assetId string) ([]ReplayLibraryTransaction, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "getTransactionsByDay", userId, day, month, year, assetId)
+
+	if err != nil {
+		return *new([]ReplayLibraryTransaction), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new([]ReplayLibraryTransaction)).(*[]ReplayLibraryTransaction)
+
+	return out0, err
+
+}
+
+// GetTransactionsByDay is a free data retrieval call binding the contract method 0x175743c5.
+//
+// Solidity: function getTransactionsByDay(string userId, uint256 day, uint256 month, uint256 year, string assetId) view returns((string,uint256,uint256,uint256,uint256,uint256,uint256,string)[])
+func (_Records *RecordsSession) GetTransactionsByDay(userId string, day *big.Int, month *big.Int, year *big.Int, assetId string) ([]ReplayLibraryTransaction, error) {
+	return _Records.Contract.GetTransactionsByDay(&_Records.CallOpts, userId, day, month, year, assetId)
+}
+
+// GetTransactionsByDay is a free data retrieval call binding the contract method 0x175743c5.
+//
+// Solidity: function getTransactionsByDay(string userId, uint256 day, uint256 month, uint256 year, string assetId) view returns((string,uint256,uint256,uint256,uint256,uint256,uint256,string)[])
+func (_Records *RecordsCallerSession) GetTransactionsByDay(userId string, day *big.Int, month *big.Int, year *big.Int, assetId string) ([]ReplayLibraryTransaction, error) {
+	return _Records.Contract.GetTransactionsByDay(&_Records.CallOpts, userId, day, month, year, assetId)
+}
+
+// HasRole is a free data retrieval call binding the contract method 0x91d14854.
+//
+// Solidity: function hasRole(bytes32 role, address account) view returns(bool)
+func (_Records *RecordsCaller) HasRole(opts *bind.CallOpts, role [32]byte, account common.Address) (bool, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "hasRole", role, account)
+
+	if err != nil {
+		return *new(bool), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(bool)).(*bool)
+
+	return out0, err
+
+}
+
+// HasRole is a free data retrieval call binding the contract method 0x91d14854.
+//
+// Solidity: function hasRole(bytes32 role, address account) view returns(bool)
+func (_Records *RecordsSession) HasRole(role [32]byte, account common.Address) (bool, error) {
+	return _Records.Contract.HasRole(&_Records.CallOpts, role, account)
+}
+
+// HasRole is a free data retrieval call binding the contract method 0x91d14854.
+//
+// Solidity: function hasRole(bytes32 role, address account) view returns(bool)
+func (_Records *RecordsCallerSession) HasRole(role [32]byte, account common.Address) (bool, error) {
+	return _Records.Contract.HasRole(&_Records.CallOpts, role, account)
+}
+
+// Nonces is a free data retrieval call binding the contract method 0xb24fce88.
+//
+// Solidity: function nonces(string ) view returns(uint256)
+func (_Records *RecordsCaller) Nonces(opts *bind.CallOpts, arg0 string) (*big.Int, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "nonces", arg0)
+
+	if err != nil {
+		return *new(*big.Int), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+	return out0, err
+
+}
+
+// Nonces is a free data retrieval call binding the contract method 0xb24fce88.
+//
+// Solidity: function nonces(string ) view returns(uint256)
+func (_Records *RecordsSession) Nonces(arg0 string) (*big.Int, error) {
+	return _Records.Contract.Nonces(&_Records.CallOpts, arg0)
+}
+
+// Nonces is a free data retrieval call binding the contract method 0xb24fce88.
+//
+// Solidity: function nonces(string ) view returns(uint256)
+func (_Records *RecordsCallerSession) Nonces(arg0 string) (*big.Int, error) {
+	return _Records.Contract.Nonces(&_Records.CallOpts, arg0)
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Records *RecordsCaller) Owner(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "owner")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Records *RecordsSession) Owner() (common.Address, error) {
+	return _Records.Contract.Owner(&_Records.CallOpts)
+}
+
+// Owner is a free data retrieval call binding the contract method 0x8da5cb5b.
+//
+// Solidity: function owner() view returns(address)
+func (_Records *RecordsCallerSession) Owner() (common.Address, error) {
+	return _Records.Contract.Owner(&_Records.CallOpts)
+}
+
+// Paused is a free data retrieval call binding the contract method 0x5c975abb.
+//
+// Solidity: function paused() view returns(bool)
+func (_Records *RecordsCaller) Paused(opts *bind.CallOpts) (bool, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "paused")
+
+	if err != nil {
+		return *new(bool), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(bool)).(*bool)
+
+	return out0, err
+
+}
+
+// Paused is a free data retrieval call binding the contract method 0x5c975abb.
+//
+// Solidity: function paused() view returns(bool)
+func (_Records *RecordsSession) Paused() (bool, error) {
+	return _Records.Contract.Paused(&_Records.CallOpts)
+}
+
+// Paused is a free data retrieval call binding the contract method 0x5c975abb.
+//
+// Solidity: function paused() view returns(bool)
+func (_Records *RecordsCallerSession) Paused() (bool, error) {
+	return _Records.Contract.Paused(&_Records.CallOpts)
+}
+
+// SupportsInterface is a free data retrieval call binding the contract method 0x01ffc9a7.
+//
+// Solidity: function supportsInterface(bytes4 interfaceId) view returns(bool)
+func (_Records *RecordsCaller) SupportsInterface(opts *bind.CallOpts, interfaceId [4]byte) (bool, error) {
+	var out []interface{}
+	err := _Records.contract.Call(opts, &out, "supportsInterface", interfaceId)
+
+	if err != nil {
+		return *new(bool), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(bool)).(*bool)
+
+	return out0, err
+
+}
+
+// SupportsInterface is a free data retrieval call binding the contract method 0x01ffc9a7.
+//
+// Solidity: function supportsInterface(bytes4 interfaceId) view returns(bool)
+func (_Records *RecordsSession) SupportsInterface(interfaceId [4]byte) (bool, error) {
+	return _Records.Contract.SupportsInterface(&_Records.CallOpts, interfaceId)
+}
+
+// SupportsInterface is a free data retrieval call binding the contract method 0x01ffc9a7.
+//
+// Solidity: function supportsInterface(bytes4 interfaceId) view returns(bool)
+func (_Records *RecordsCallerSession) SupportsInterface(interfaceId [4]byte) (bool, error) {
+	return _Records.Contract.SupportsInterface(&_Records.CallOpts, interfaceId)
+}
+
+// BatchInsertRecords is a paid mutator transaction binding the contract method 0x64378c97.
+//
+// Solidity: function batchInsertRecords((string,uint256,uint256,uint256,uint256,uint256,uint256,string)[] transactions) returns()
+func (_Records *RecordsTransactor) BatchInsertRecords(opts *bind.TransactOpts, transactions []ReplayLibraryTransaction) (*types.Transaction, error) {
+	return _Records.contract.Transact(opts, "batchInsertRecords", transactions)
+}
+
+// BatchInsertRecords is a paid mutator transaction binding the contract method 0x64378c97.
+//
+// Solidity: function batchInsertRecords((string,uint256,uint256,uint256,uint256,uint256,uint256,string)[] transactions) returns()
+func (_Records *RecordsSession) BatchInsertRecords(transactions []ReplayLibraryTransaction) (*types.Transaction, error) {
+	return _Records.Contract.BatchInsertRecords(&_Records.TransactOpts, transactions)
+}
+
+// BatchInsertRecords is a paid mutator transaction binding the contract method 0x64378c97.
+//
+// Solidity: function batchInsertRecords((string,uint256,uint256,uint256,uint256,uint256,uint256,string)[] transactions) returns()
+func (_Records *RecordsTransactorSession) BatchInsertRecords(transactions []ReplayLibraryTransaction) (*types.Transaction, error) {
+	return _Records.Contract.BatchInsertRecords(&_Records.TransactOpts, transactions)
+}
+
+// GrantRole is a paid mutator transaction binding the contract method 0x2f2ff15d.
+//
+// Solidity: function grantRole(bytes32 role, address account) returns()
+func (_Records *RecordsTransactor) GrantRole(opts *bind.TransactOpts, role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.contract.Transact(opts, "grantRole", role, account)
+}
+
+// GrantRole is a paid mutator transaction binding the contract method 0x2f2ff15d.
+//
+// Solidity: function grantRole(bytes32 role, address account) returns()
+func (_Records *RecordsSession) GrantRole(role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.Contract.GrantRole(&_Records.TransactOpts, role, account)
+}
+
+// GrantRole is a paid mutator transaction binding the contract method 0x2f2ff15d.
+//
+// Solidity: function grantRole(bytes32 role, address account) returns()
+func (_Records *RecordsTransactorSession) GrantRole(role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.Contract.GrantRole(&_Records.TransactOpts, role, account)
+}
+
+// Pause is a paid mutator transaction binding the contract method 0x8456cb59.
+//
+// Solidity: function pause() returns()
+func (_Records *RecordsTransactor) Pause(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Records.contract.Transact(opts, "pause")
+}
+
+// Pause is a paid mutator transaction binding the contract method 0x8456cb59.
+//
+// Solidity: function pause() returns()
+func (_Records *RecordsSession) Pause() (*types.Transaction, error) {
+	return _Records.Contract.Pause(&_Records.TransactOpts)
+}
+
+// Pause is a paid mutator transaction binding the contract method 0x8456cb59.
+//
+// Solidity: function pause() returns()
+func (_Records *RecordsTransactorSession) Pause() (*types.Transaction, error) {
+	return _Records.Contract.Pause(&_Records.TransactOpts)
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Records *RecordsTransactor) RenounceOwnership(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Records.contract.Transact(opts, "renounceOwnership")
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Records *RecordsSession) RenounceOwnership() (*types.Transaction, error) {
+	return _Records.Contract.RenounceOwnership(&_Records.TransactOpts)
+}
+
+// RenounceOwnership is a paid mutator transaction binding the contract method 0x715018a6.
+//
+// Solidity: function renounceOwnership() returns()
+func (_Records *RecordsTransactorSession) RenounceOwnership() (*types.Transaction, error) {
+	return _Records.Contract.RenounceOwnership(&_Records.TransactOpts)
+}
+
+// RenounceRole is a paid mutator transaction binding the contract method 0x36568abe.
+//
+// Solidity: function renounceRole(bytes32 role, address account) returns()
+func (_Records *RecordsTransactor) RenounceRole(opts *bind.TransactOpts, role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.contract.Transact(opts, "renounceRole", role, account)
+}
+
+// RenounceRole is a paid mutator transaction binding the contract method 0x36568abe.
+//
+// Solidity: function renounceRole(bytes32 role, address account) returns()
+func (_Records *RecordsSession) RenounceRole(role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.Contract.RenounceRole(&_Records.TransactOpts, role, account)
+}
+
+// RenounceRole is a paid mutator transaction binding the contract method 0x36568abe.
+//
+// Solidity: function renounceRole(bytes32 role, address account) returns()
+func (_Records *RecordsTransactorSession) RenounceRole(role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.Contract.RenounceRole(&_Records.TransactOpts, role, account)
+}
+
+// RevokeRole is a paid mutator transaction binding the contract method 0xd547741f.
+//
+// Solidity: function revokeRole(bytes32 role, address account) returns()
+func (_Records *RecordsTransactor) RevokeRole(opts *bind.TransactOpts, role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.contract.Transact(opts, "revokeRole", role, account)
+}
+
+// RevokeRole is a paid mutator transaction binding the contract method 0xd547741f.
+//
+// Solidity: function revokeRole(bytes32 role, address account) returns()
+func (_Records *RecordsSession) RevokeRole(role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.Contract.RevokeRole(&_Records.TransactOpts, role, account)
+}
+
+// RevokeRole is a paid mutator transaction binding the contract method 0xd547741f.
+//
+// Solidity: function revokeRole(bytes32 role, address account) returns()
+func (_Records *RecordsTransactorSession) RevokeRole(role [32]byte, account common.Address) (*types.Transaction, error) {
+	return _Records.Contract.RevokeRole(&_Records.TransactOpts, role, account)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Records *RecordsTransactor) TransferOwnership(opts *bind.TransactOpts, newOwner common.Address) (*types.Transaction, error) {
+	return _Records.contract.Transact(opts, "transferOwnership", newOwner)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Records *RecordsSession) TransferOwnership(newOwner common.Address) (*types.Transaction, error) {
+	return _Records.Contract.TransferOwnership(&_Records.TransactOpts, newOwner)
+}
+
+// TransferOwnership is a paid mutator transaction binding the contract method 0xf2fde38b.
+//
+// Solidity: function transferOwnership(address newOwner) returns()
+func (_Records *RecordsTransactorSession) TransferOwnership(newOwner common.Address) (*types.Transaction, error) {
+	return _Records.Contract.TransferOwnership(&_Records.TransactOpts, newOwner)
+}
+
+// Unpause is a paid mutator transaction binding the contract method 0x3f4ba83a.
+//
+// Solidity: function unpause() returns()
+func (_Records *RecordsTransactor) Unpause(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _Records.contract.Transact(opts, "unpause")
+}
+
+// Unpause is a paid mutator transaction binding the contract method 0x3f4ba83a.
+//
+// Solidity: function unpause() returns()
+func (_Records *RecordsSession) Unpause() (*types.Transaction, error) {
+	return _Records.Contract.Unpause(&_Records.TransactOpts)
+}
+
+// Unpause is a paid mutator transaction binding the contract method 0x3f4ba83a.
+//
+// Solidity: function unpause() returns()
+func (_Records *RecordsTransactorSession) Unpause() (*types.Transaction, error) {
+	return _Records.Contract.Unpause(&_Records.TransactOpts)
+}
+
+// RecordsOwnershipTransferredIterator is returned from FilterOwnershipTransferred and is used to iterate over the raw logs and unpacked data for OwnershipTransferred events raised by the Records contract.
+type RecordsOwnershipTransferredIterator struct {
+	Event *RecordsOwnershipTransferred // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *RecordsOwnershipTransferredIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(RecordsOwnershipTransferred)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(RecordsOwnershipTransferred)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *RecordsOwnershipTransferredIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *RecordsOwnershipTransferredIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// RecordsOwnershipTransferred represents a OwnershipTransferred event raised by the Records contract.
+type RecordsOwnershipTransferred struct {
+	PreviousOwner common.Address
+	NewOwner      common.Address
+	Raw           types.Log // Blockchain specific contextual infos
+}
+
+// FilterOwnershipTransferred is a free log retrieval operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Records *RecordsFilterer) FilterOwnershipTransferred(opts *bind.FilterOpts, previousOwner []common.Address, newOwner []common.Address) (*RecordsOwnershipTransferredIterator, error) {
+
+	var previousOwnerRule []interface{}
+	for _, previousOwnerItem := range previousOwner {
+		previousOwnerRule = append(previousOwnerRule, previousOwnerItem)
+	}
+	var newOwnerRule []interface{}
+	for _, newOwnerItem := range newOwner {
+		newOwnerRule = append(newOwnerRule, newOwnerItem)
+	}
+
+	logs, sub, err := _Records.contract.FilterLogs(opts, "OwnershipTransferred", previousOwnerRule, newOwnerRule)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsOwnershipTransferredIterator{contract: _Records.contract, event: "OwnershipTransferred", logs: logs, sub: sub}, nil
+}
+
+// WatchOwnershipTransferred is a free log subscription operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Records *RecordsFilterer) WatchOwnershipTransferred(opts *bind.WatchOpts, sink chan<- *RecordsOwnershipTransferred, previousOwner []common.Address, newOwner []common.Address) (event.Subscription, error) {
+
+	var previousOwnerRule []interface{}
+	for _, previousOwnerItem := range previousOwner {
+		previousOwnerRule = append(previousOwnerRule, previousOwnerItem)
+	}
+	var newOwnerRule []interface{}
+	for _, newOwnerItem := range newOwner {
+		newOwnerRule = append(newOwnerRule, newOwnerItem)
+	}
+
+	logs, sub, err := _Records.contract.WatchLogs(opts, "OwnershipTransferred", previousOwnerRule, newOwnerRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(RecordsOwnershipTransferred)
+				if err := _Records.contract.UnpackLog(event, "OwnershipTransferred", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseOwnershipTransferred is a log parse operation binding the contract event 0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0.
+//
+// Solidity: event OwnershipTransferred(address indexed previousOwner, address indexed newOwner)
+func (_Records *RecordsFilterer) ParseOwnershipTransferred(log types.Log) (*RecordsOwnershipTransferred, error) {
+	event := new(RecordsOwnershipTransferred)
+	if err := _Records.contract.UnpackLog(event, "OwnershipTransferred", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// RecordsPausedIterator is returned from FilterPaused and is used to iterate over the raw logs and unpacked data for Paused events raised by the Records contract.
+type RecordsPausedIterator struct {
+	Event *RecordsPaused // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *RecordsPausedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(RecordsPaused)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(RecordsPaused)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *RecordsPausedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *RecordsPausedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// RecordsPaused represents a Paused event raised by the Records contract.
+type RecordsPaused struct {
+	Account common.Address
+	Raw     types.Log // Blockchain specific contextual infos
+}
+
+// FilterPaused is a free log retrieval operation binding the contract event 0x62e78cea01bee320cd4e420270b5ea74000d11b0c9f74754ebdbfc544b05a258.
+//
+// Solidity: event Paused(address account)
+func (_Records *RecordsFilterer) FilterPaused(opts *bind.FilterOpts) (*RecordsPausedIterator, error) {
+
+	logs, sub, err := _Records.contract.FilterLogs(opts, "Paused")
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsPausedIterator{contract: _Records.contract, event: "Paused", logs: logs, sub: sub}, nil
+}
+
+// WatchPaused is a free log subscription operation binding the contract event 0x62e78cea01bee320cd4e420270b5ea74000d11b0c9f74754ebdbfc544b05a258.
+//
+// Solidity: event Paused(address account)
+func (_Records *RecordsFilterer) WatchPaused(opts *bind.WatchOpts, sink chan<- *RecordsPaused) (event.Subscription, error) {
+
+	logs, sub, err := _Records.contract.WatchLogs(opts, "Paused")
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(RecordsPaused)
+				if err := _Records.contract.UnpackLog(event, "Paused", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParsePaused is a log parse operation binding the contract event 0x62e78cea01bee320cd4e420270b5ea74000d11b0c9f74754ebdbfc544b05a258.
+//
+// Solidity: event Paused(address account)
+func (_Records *RecordsFilterer) ParsePaused(log types.Log) (*RecordsPaused, error) {
+	event := new(RecordsPaused)
+	if err := _Records.contract.UnpackLog(event, "Paused", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// RecordsRoleAdminChangedIterator is returned from FilterRoleAdminChanged and is used to iterate over the raw logs and unpacked data for RoleAdminChanged events raised by the Records contract.
+type RecordsRoleAdminChangedIterator struct {
+	Event *RecordsRoleAdminChanged // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *RecordsRoleAdminChangedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(RecordsRoleAdminChanged)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(RecordsRoleAdminChanged)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *RecordsRoleAdminChangedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *RecordsRoleAdminChangedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// RecordsRoleAdminChanged represents a RoleAdminChanged event raised by the Records contract.
+type RecordsRoleAdminChanged struct {
+	Role              [32]byte
+	PreviousAdminRole [32]byte
+	NewAdminRole      [32]byte
+	Raw               types.Log // Blockchain specific contextual infos
+}
+
+// FilterRoleAdminChanged is a free log retrieval operation binding the contract event 0xbd79b86ffe0ab8e8776151514217cd7cacd52c909f66475c3af44e129f0b00ff.
+//
+// Solidity: event RoleAdminChanged(bytes32 indexed role, bytes32 indexed previousAdminRole, bytes32 indexed newAdminRole)
+func (_Records *RecordsFilterer) FilterRoleAdminChanged(opts *bind.FilterOpts, role [][32]byte, previousAdminRole [][32]byte, newAdminRole [][32]byte) (*RecordsRoleAdminChangedIterator, error) {
+
+	var roleRule []interface{}
+	for _, roleItem := range role {
+		roleRule = append(roleRule, roleItem)
+	}
+	var previousAdminRoleRule []interface{}
+	for _, previousAdminRoleItem := range previousAdminRole {
+		previousAdminRoleRule = append(previousAdminRoleRule, previousAdminRoleItem)
+	}
+	var newAdminRoleRule []interface{}
+	for _, newAdminRoleItem := range newAdminRole {
+		newAdminRoleRule = append(newAdminRoleRule, newAdminRoleItem)
+	}
+
+	logs, sub, err := _Records.contract.FilterLogs(opts, "RoleAdminChanged", roleRule, previousAdminRoleRule, newAdminRoleRule)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsRoleAdminChangedIterator{contract: _Records.contract, event: "RoleAdminChanged", logs: logs, sub: sub}, nil
+}
+
+// WatchRoleAdminChanged is a free log subscription operation binding the contract event 0xbd79b86ffe0ab8e8776151514217cd7cacd52c909f66475c3af44e129f0b00ff.
+//
+// Solidity: event RoleAdminChanged(bytes32 indexed role, bytes32 indexed previousAdminRole, bytes32 indexed newAdminRole)
+func (_Records *RecordsFilterer) WatchRoleAdminChanged(opts *bind.WatchOpts, sink chan<- *RecordsRoleAdminChanged, role [][32]byte, previousAdminRole [][32]byte, newAdminRole [][32]byte) (event.Subscription, error) {
+
+	var roleRule []interface{}
+	for _, roleItem := range role {
+		roleRule = append(roleRule, roleItem)
+	}
+	var previousAdminRoleRule []interface{}
+	for _, previousAdminRoleItem := range previousAdminRole {
+		previousAdminRoleRule = append(previousAdminRoleRule, previousAdminRoleItem)
+	}
+	var newAdminRoleRule []interface{}
+	for _, newAdminRoleItem := range newAdminRole {
+		newAdminRoleRule = append(newAdminRoleRule, newAdminRoleItem)
+	}
+
+	logs, sub, err := _Records.contract.WatchLogs(opts, "RoleAdminChanged", roleRule, previousAdminRoleRule, newAdminRoleRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(RecordsRoleAdminChanged)
+				if err := _Records.contract.UnpackLog(event, "RoleAdminChanged", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseRoleAdminChanged is a log parse operation binding the contract event 0xbd79b86ffe0ab8e8776151514217cd7cacd52c909f66475c3af44e129f0b00ff.
+//
+// Solidity: event RoleAdminChanged(bytes32 indexed role, bytes32 indexed previousAdminRole, bytes32 indexed newAdminRole)
+func (_Records *RecordsFilterer) ParseRoleAdminChanged(log types.Log) (*RecordsRoleAdminChanged, error) {
+	event := new(RecordsRoleAdminChanged)
+	if err := _Records.contract.UnpackLog(event, "RoleAdminChanged", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// RecordsRoleGrantedIterator is returned from FilterRoleGranted and is used to iterate over the raw logs and unpacked data for RoleGranted events raised by the Records contract.
+type RecordsRoleGrantedIterator struct {
+	Event *RecordsRoleGranted // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *RecordsRoleGrantedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(RecordsRoleGranted)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(RecordsRoleGranted)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *RecordsRoleGrantedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *RecordsRoleGrantedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// RecordsRoleGranted represents a RoleGranted event raised by the Records contract.
+type RecordsRoleGranted struct {
+	Role    [32]byte
+	Account common.Address
+	Sender  common.Address
+	Raw     types.Log // Blockchain specific contextual infos
+}
+
+// FilterRoleGranted is a free log retrieval operation binding the contract event 0x2f8788117e7eff1d82e926ec794901d17c78024a50270940304540a733656f0d.
+//
+// Solidity: event RoleGranted(bytes32 indexed role, address indexed account, address indexed sender)
+func (_Records *RecordsFilterer) FilterRoleGranted(opts *bind.FilterOpts, role [][32]byte, account []common.Address, sender []common.Address) (*RecordsRoleGrantedIterator, error) {
+
+	var roleRule []interface{}
+	for _, roleItem := range role {
+		roleRule = append(roleRule, roleItem)
+	}
+	var accountRule []interface{}
+	for _, accountItem := range account {
+		accountRule = append(accountRule, accountItem)
+	}
+	var senderRule []interface{}
+	for _, senderItem := range sender {
+		senderRule = append(senderRule, senderItem)
+	}
+
+	logs, sub, err := _Records.contract.FilterLogs(opts, "RoleGranted", roleRule, accountRule, senderRule)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsRoleGrantedIterator{contract: _Records.contract, event: "RoleGranted", logs: logs, sub: sub}, nil
+}
+
+// WatchRoleGranted is a free log subscription operation binding the contract event 0x2f8788117e7eff1d82e926ec794901d17c78024a50270940304540a733656f0d.
+//
+// Solidity: event RoleGranted(bytes32 indexed role, address indexed account, address indexed sender)
+func (_Records *RecordsFilterer) WatchRoleGranted(opts *bind.WatchOpts, sink chan<- *RecordsRoleGranted, role [][32]byte, account []common.Address, sender []common.Address) (event.Subscription, error) {
+
+	var roleRule []interface{}
+	for _, roleItem := range role {
+		roleRule = append(roleRule, roleItem)
+	}
+	var accountRule []interface{}
+	for _, accountItem := range account {
+		accountRule = append(accountRule, accountItem)
+	}
+	var senderRule []interface{}
+	for _, senderItem := range sender {
+		senderRule = append(senderRule, senderItem)
+	}
+
+	logs, sub, err := _Records.contract.WatchLogs(opts, "RoleGranted", roleRule, accountRule, senderRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(RecordsRoleGranted)
+				if err := _Records.contract.UnpackLog(event, "RoleGranted", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseRoleGranted is a log parse operation binding the contract event 0x2f8788117e7eff1d82e926ec794901d17c78024a50270940304540a733656f0d.
+//
+// Solidity: event RoleGranted(bytes32 indexed role, address indexed account, address indexed sender)
+func (_Records *RecordsFilterer) ParseRoleGranted(log types.Log) (*RecordsRoleGranted, error) {
+	event := new(RecordsRoleGranted)
+	if err := _Records.contract.UnpackLog(event, "RoleGranted", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// RecordsRoleRevokedIterator is returned from FilterRoleRevoked and is used to iterate over the raw logs and unpacked data for RoleRevoked events raised by the Records contract.
+type RecordsRoleRevokedIterator struct {
+	Event *RecordsRoleRevoked // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *RecordsRoleRevokedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(RecordsRoleRevoked)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(RecordsRoleRevoked)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *RecordsRoleRevokedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *RecordsRoleRevokedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// RecordsRoleRevoked represents a RoleRevoked event raised by the Records contract.
+type RecordsRoleRevoked struct {
+	Role    [32]byte
+	Account common.Address
+	Sender  common.Address
+	Raw     types.Log // Blockchain specific contextual infos
+}
+
+// FilterRoleRevoked is a free log retrieval operation binding the contract event 0xf6391f5c32d9c69d2a47ea670b442974b53935d1edc7fd64eb21e047a839171b.
+//
+// Solidity: event RoleRevoked(bytes32 indexed role, address indexed account, address indexed sender)
+func (_Records *RecordsFilterer) FilterRoleRevoked(opts *bind.FilterOpts, role [][32]byte, account []common.Address, sender []common.Address) (*RecordsRoleRevokedIterator, error) {
+
+	var roleRule []interface{}
+	for _, roleItem := range role {
+		roleRule = append(roleRule, roleItem)
+	}
+	var accountRule []interface{}
+	for _, accountItem := range account {
+		accountRule = append(accountRule, accountItem)
+	}
+	var senderRule []interface{}
+	for _, senderItem := range sender {
+		senderRule = append(senderRule, senderItem)
+	}
+
+	logs, sub, err := _Records.contract.FilterLogs(opts, "RoleRevoked", roleRule, accountRule, senderRule)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsRoleRevokedIterator{contract: _Records.contract, event: "RoleRevoked", logs: logs, sub: sub}, nil
+}
+
+// WatchRoleRevoked is a free log subscription operation binding the contract event 0xf6391f5c32d9c69d2a47ea670b442974b53935d1edc7fd64eb21e047a839171b.
+//
+// Solidity: event RoleRevoked(bytes32 indexed role, address indexed account, address indexed sender)
+func (_Records *RecordsFilterer) WatchRoleRevoked(opts *bind.WatchOpts, sink chan<- *RecordsRoleRevoked, role [][32]byte, account []common.Address, sender []common.Address) (event.Subscription, error) {
+
+	var roleRule []interface{}
+	for _, roleItem := range role {
+		roleRule = append(roleRule, roleItem)
+	}
+	var accountRule []interface{}
+	for _, accountItem := range account {
+		accountRule = append(accountRule, accountItem)
+	}
+	var senderRule []interface{}
+	for _, senderItem := range sender {
+		senderRule = append(senderRule, senderItem)
+	}
+
+	logs, sub, err := _Records.contract.WatchLogs(opts, "RoleRevoked", roleRule, accountRule, senderRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(RecordsRoleRevoked)
+				if err := _Records.contract.UnpackLog(event, "RoleRevoked", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseRoleRevoked is a log parse operation binding the contract event 0xf6391f5c32d9c69d2a47ea670b442974b53935d1edc7fd64eb21e047a839171b.
+//
+// Solidity: event RoleRevoked(bytes32 indexed role, address indexed account, address indexed sender)
+func (_Records *RecordsFilterer) ParseRoleRevoked(log types.Log) (*RecordsRoleRevoked, error) {
+	event := new(RecordsRoleRevoked)
+	if err := _Records.contract.UnpackLog(event, "RoleRevoked", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// RecordsTransactionAddedIterator is returned from FilterTransactionAdded and is used to iterate over the raw logs and unpacked data for TransactionAdded events raised by the Records contract.
+type RecordsTransactionAddedIterator struct {
+	Event *RecordsTransactionAdded // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *RecordsTransactionAddedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(RecordsTransactionAdded)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(RecordsTransactionAdded)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *RecordsTransactionAddedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *RecordsTransactionAddedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// RecordsTransactionAdded represents a TransactionAdded event raised by the Records contract.
+type RecordsTransactionAdded struct {
+	UserId                   common.Hash
+	Day                      *big.Int
+	Month                    *big.Int
+	Year                     *big.Int
+	AssetId                  string
+	TotalDuration            *big.Int
+	TotalRewardsConsumer     *big.Int
+	TotalRewardsContentOwner *big.Int
+	Raw                      types.Log // Blockchain specific contextual infos
+}
+
+// FilterTransactionAdded is a free log retrieval operation binding the contract event 0xcdb5ced38cd3f2e0ab4e0401f4d49b296020a590e01e1fa1855bc1f023af174f.
+//
+// Solidity: event TransactionAdded(string indexed userId, uint256 indexed day, uint256 indexed month, uint256 year, string assetId, uint256 totalDuration, uint256 totalRewardsConsumer, uint256 totalRewardsContentOwner)
+func (_Records *RecordsFilterer) FilterTransactionAdded(opts *bind.FilterOpts, userId []string, day []*big.Int, month []*big.Int) (*RecordsTransactionAddedIterator, error) {
+
+	var userIdRule []interface{}
+	for _, userIdItem := range userId {
+		userIdRule = append(userIdRule, userIdItem)
+	}
+	var dayRule []interface{}
+	for _, dayItem := range day {
+		dayRule = append(dayRule, dayItem)
+	}
+	var monthRule []interface{}
+	for _, monthItem := range month {
+		monthRule = append(monthRule, monthItem)
+	}
+
+	logs, sub, err := _Records.contract.FilterLogs(opts, "TransactionAdded", userIdRule, dayRule, monthRule)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsTransactionAddedIterator{contract: _Records.contract, event: "TransactionAdded", logs: logs, sub: sub}, nil
+}
+
+// WatchTransactionAdded is a free log subscription operation binding the contract event 0xcdb5ced38cd3f2e0ab4e0401f4d49b296020a590e01e1fa1855bc1f023af174f.
+//
+// Solidity: event TransactionAdded(string indexed userId, uint256 indexed day, uint256 indexed month, uint256 year, string assetId, uint256 totalDuration, uint256 totalRewardsConsumer, uint256 totalRewardsContentOwner)
+func (_Records *RecordsFilterer) WatchTransactionAdded(opts *bind.WatchOpts, sink chan<- *RecordsTransactionAdded, userId []string, day []*big.Int, month []*big.Int) (event.Subscription, error) {
+
+	var userIdRule []interface{}
+	for _, userIdItem := range userId {
+		userIdRule = append(userIdRule, userIdItem)
+	}
+	var dayRule []interface{}
+	for _, dayItem := range day {
+		dayRule = append(dayRule, dayItem)
+	}
+	var monthRule []interface{}
+	for _, monthItem := range month {
+		monthRule = append(monthRule, monthItem)
+	}
+
+	logs, sub, err := _Records.contract.WatchLogs(opts, "TransactionAdded", userIdRule, dayRule, monthRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(RecordsTransactionAdded)
+				if err := _Records.contract.UnpackLog(event, "TransactionAdded", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseTransactionAdded is a log parse operation binding the contract event 0xcdb5ced38cd3f2e0ab4e0401f4d49b296020a590e01e1fa1855bc1f023af174f.
+//
+// Solidity: event TransactionAdded(string indexed userId, uint256 indexed day, uint256 indexed month, uint256 year, string assetId, uint256 totalDuration, uint256 totalRewardsConsumer, uint256 totalRewardsContentOwner)
+func (_Records *RecordsFilterer) ParseTransactionAdded(log types.Log) (*RecordsTransactionAdded, error) {
+	event := new(RecordsTransactionAdded)
+	if err := _Records.contract.UnpackLog(event, "TransactionAdded", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// RecordsUnpausedIterator is returned from FilterUnpaused and is used to iterate over the raw logs and unpacked data for Unpaused events raised by the Records contract.
+type RecordsUnpausedIterator struct {
+	Event *RecordsUnpaused // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *RecordsUnpausedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(RecordsUnpaused)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(RecordsUnpaused)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *RecordsUnpausedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *RecordsUnpausedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// RecordsUnpaused represents a Unpaused event raised by the Records contract.
+type RecordsUnpaused struct {
+	Account common.Address
+	Raw     types.Log // Blockchain specific contextual infos
+}
+
+// FilterUnpaused is a free log retrieval operation binding the contract event 0x5db9ee0a495bf2e6ff9c91a7834c1ba4fdd244a5e8aa4e537bd38aeae4b073aa.
+//
+// Solidity: event Unpaused(address account)
+func (_Records *RecordsFilterer) FilterUnpaused(opts *bind.FilterOpts) (*RecordsUnpausedIterator, error) {
+
+	logs, sub, err := _Records.contract.FilterLogs(opts, "Unpaused")
+	if err != nil {
+		return nil, err
+	}
+	return &RecordsUnpausedIterator{contract: _Records.contract, event: "Unpaused", logs: logs, sub: sub}, nil
+}
+
+// WatchUnpaused is a free log subscription operation binding the contract event 0x5db9ee0a495bf2e6ff9c91a7834c1ba4fdd244a5e8aa4e537bd38aeae4b073aa.
+//
+// Solidity: event Unpaused(address account)
+func (_Records *RecordsFilterer) WatchUnpaused(opts *bind.WatchOpts, sink chan<- *RecordsUnpaused) (event.Subscription, error) {
+
+	logs, sub, err := _Records.contract.WatchLogs(opts, "Unpaused")
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(RecordsUnpaused)
+				if err := _Records.contract.UnpackLog(event, "Unpaused", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseUnpaused is a log parse operation binding the contract event 0x5db9ee0a495bf2e6ff9c91a7834c1ba4fdd244a5e8aa4e537bd38aeae4b073aa.
+//
+// Solidity: event Unpaused(address account)
+func (_Records *RecordsFilterer) ParseUnpaused(log types.Log) (*RecordsUnpaused, error) {
+	event := new(RecordsUnpaused)
+	if err := _Records.contract.UnpackLog(event, "Unpaused", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
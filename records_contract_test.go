@@ -0,0 +1,494 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// evmAssembler builds EVM bytecode with labelled jump targets. There is no Solidity compiler in the build
+// environment, so the test contract below is written directly in assembly.
+type evmAssembler struct {
+	code   []byte
+	labels map[string]int
+	refs   map[int]string
+}
+
+func newEVMAssembler() *evmAssembler {
+	return &evmAssembler{labels: make(map[string]int), refs: make(map[int]string)}
+}
+
+func (a *evmAssembler) op(ops ...vm.OpCode) {
+	for _, op := range ops {
+		a.code = append(a.code, byte(op))
+	}
+}
+
+// push emits the shortest PUSH for value.
+func (a *evmAssembler) push(value uint64) {
+	a.pushBytes(new(big.Int).SetUint64(value).Bytes())
+}
+
+func (a *evmAssembler) pushBytes(value []byte) {
+	if len(value) == 0 {
+		value = []byte{0}
+	}
+	a.code = append(a.code, byte(vm.PUSH1)+byte(len(value)-1))
+	a.code = append(a.code, value...)
+}
+
+// pushLabel emits a PUSH2 of a label's offset, resolved when the code is assembled.
+func (a *evmAssembler) pushLabel(name string) {
+	a.code = append(a.code, byte(vm.PUSH2))
+	a.refs[len(a.code)] = name
+	a.code = append(a.code, 0, 0)
+}
+
+func (a *evmAssembler) label(name string) {
+	a.labels[name] = len(a.code)
+	a.op(vm.JUMPDEST)
+}
+
+func (a *evmAssembler) jump(name string) {
+	a.pushLabel(name)
+	a.op(vm.JUMP)
+}
+
+func (a *evmAssembler) jumpIf(name string) {
+	a.pushLabel(name)
+	a.op(vm.JUMPI)
+}
+
+// load pushes the memory word at addr.
+func (a *evmAssembler) load(addr uint64) {
+	a.push(addr)
+	a.op(vm.MLOAD)
+}
+
+// store pops the top of the stack into the memory word at addr.
+func (a *evmAssembler) store(addr uint64) {
+	a.push(addr)
+	a.op(vm.MSTORE)
+}
+
+// returnWord returns the top of the stack as a single ABI word.
+func (a *evmAssembler) returnWord() {
+	a.store(0)
+	a.push(32)
+	a.push(0)
+	a.op(vm.RETURN)
+}
+
+func (a *evmAssembler) assemble() []byte {
+	code := append([]byte(nil), a.code...)
+	for at, name := range a.refs {
+		target, ok := a.labels[name]
+		if !ok {
+			panic(fmt.Sprintf("undefined label %q", name))
+		}
+		code[at], code[at+1] = byte(target>>8), byte(target)
+	}
+	return code
+}
+
+// Memory layout of the test contract. The five words at 0x00 are hashed into the record key; the strings being
+// hashed, the event data and the return data are all built from scratchArea.
+const (
+	memUserHash  = 0x00
+	memDay       = 0x20
+	memMonth     = 0x40
+	memYear      = 0x60
+	memAssetHash = 0x80
+
+	varArray      = 0x100
+	varCount      = 0x120
+	varIndex      = 0x140
+	varElement    = 0x160
+	varUser       = 0x180
+	varAsset      = 0x1a0
+	varUserLen    = 0x1c0
+	varAssetLen   = 0x1e0
+	varKey        = 0x200
+	varStored     = 0x220
+	varUserPad    = 0x240
+	varAssetPad   = 0x260
+	varTupleSize  = 0x280
+	varTupleStart = 0x2a0
+
+	scratchArea = 0x400
+)
+
+// recordsContractCode returns the creation code of a minimal stand-in for the records contract. It implements
+// batchInsertRecords, getTransactionsByDay, the TransactionAdded event and the pause and role views used by the
+// preflight checks, with the same ABI as the production contract; hasRole always returns true and pause and
+// unpause have no access control. Records are keyed by keccak256(keccak256(userId), day, month, year,
+// keccak256(assetId)) and stored as (totalDuration, totalRewardsConsumer, totalRewardsContentOwner) triples
+// after a counter.
+func recordsContractCode() []byte {
+	parsed, err := RecordsMetaData.GetAbi()
+	if err != nil {
+		panic(err)
+	}
+	selector := func(name string) []byte { return parsed.Methods[name].ID }
+	eventID := parsed.Events["TransactionAdded"].ID.Bytes()
+
+	a := newEVMAssembler()
+
+	a.push(0)
+	a.op(vm.CALLDATALOAD)
+	a.push(224)
+	a.op(vm.SHR)
+	for _, name := range []string{"batchInsertRecords", "getTransactionsByDay", "paused", "pause", "unpause",
+		"ADMIN_ROLE", "DEFAULT_ADMIN_ROLE", "hasRole"} {
+		a.op(vm.DUP1)
+		a.pushBytes(selector(name))
+		a.op(vm.EQ)
+		a.jumpIf(name)
+	}
+	a.push(0)
+	a.push(0)
+	a.op(vm.REVERT)
+
+	a.label("paused")
+	a.push(0)
+	a.op(vm.SLOAD)
+	a.returnWord()
+
+	a.label("pause")
+	a.push(1)
+	a.push(0)
+	a.op(vm.SSTORE, vm.STOP)
+
+	a.label("unpause")
+	a.push(0)
+	a.push(0)
+	a.op(vm.SSTORE, vm.STOP)
+
+	a.label("ADMIN_ROLE")
+	a.pushBytes(crypto.Keccak256([]byte("ADMIN_ROLE")))
+	a.returnWord()
+
+	a.label("DEFAULT_ADMIN_ROLE")
+	a.push(0)
+	a.returnWord()
+
+	a.label("hasRole")
+	a.push(1)
+	a.returnWord()
+
+	// hashString stores keccak256 of the calldata string at the offset held in ptrVar into out.
+	hashString := func(ptrVar, lenVar, out uint64) {
+		a.load(lenVar)
+		a.load(ptrVar)
+		a.push(32)
+		a.op(vm.ADD)
+		a.push(scratchArea)
+		a.op(vm.CALLDATACOPY)
+		a.load(lenVar)
+		a.push(scratchArea)
+		a.op(vm.KECCAK256)
+		a.store(out)
+	}
+	// padLength rounds the length in lenVar up to a whole number of words.
+	padLength := func(lenVar, out uint64) {
+		a.load(lenVar)
+		a.push(31)
+		a.op(vm.ADD)
+		a.push(5)
+		a.op(vm.SHR)
+		a.push(5)
+		a.op(vm.SHL)
+		a.store(out)
+	}
+	recordKey := func() {
+		a.push(0xa0)
+		a.push(0)
+		a.op(vm.KECCAK256)
+		a.store(varKey)
+	}
+	// elementWord pushes the calldata word at offset within the tuple being inserted.
+	elementWord := func(offset uint64) {
+		a.load(varElement)
+		a.push(offset)
+		a.op(vm.ADD, vm.CALLDATALOAD)
+	}
+	// storedSlot pushes key + 1 + 3*countVar + field.
+	storedSlot := func(countVar, field uint64) {
+		a.load(countVar)
+		a.push(3)
+		a.op(vm.MUL)
+		a.load(varKey)
+		a.op(vm.ADD)
+		a.push(1 + field)
+		a.op(vm.ADD)
+	}
+
+	// batchInsertRecords((string,uint256,uint256,uint256,uint256,uint256,uint256,string)[])
+	a.label("batchInsertRecords")
+	a.push(0)
+	a.op(vm.SLOAD, vm.ISZERO)
+	a.jumpIf("insertAllowed")
+	a.push(0)
+	a.push(0)
+	a.op(vm.REVERT)
+	a.label("insertAllowed")
+	a.push(4)
+	a.op(vm.CALLDATALOAD)
+	a.push(4)
+	a.op(vm.ADD)
+	a.store(varArray)
+	a.load(varArray)
+	a.op(vm.CALLDATALOAD)
+	a.store(varCount)
+	a.push(0)
+	a.store(varIndex)
+
+	a.label("insertLoop")
+	a.load(varCount)
+	a.load(varIndex)
+	a.op(vm.LT, vm.ISZERO)
+	a.jumpIf("insertDone")
+
+	a.load(varIndex)
+	a.push(5)
+	a.op(vm.SHL)
+	a.load(varArray)
+	a.op(vm.ADD)
+	a.push(32)
+	a.op(vm.ADD, vm.CALLDATALOAD)
+	a.load(varArray)
+	a.op(vm.ADD)
+	a.push(32)
+	a.op(vm.ADD)
+	a.store(varElement)
+
+	elementWord(0)
+	a.load(varElement)
+	a.op(vm.ADD)
+	a.store(varUser)
+	a.load(varUser)
+	a.op(vm.CALLDATALOAD)
+	a.store(varUserLen)
+	elementWord(224)
+	a.load(varElement)
+	a.op(vm.ADD)
+	a.store(varAsset)
+	a.load(varAsset)
+	a.op(vm.CALLDATALOAD)
+	a.store(varAssetLen)
+
+	hashString(varUser, varUserLen, memUserHash)
+	hashString(varAsset, varAssetLen, memAssetHash)
+	elementWord(32)
+	a.store(memDay)
+	elementWord(64)
+	a.store(memMonth)
+	elementWord(96)
+	a.store(memYear)
+	recordKey()
+
+	a.load(varKey)
+	a.op(vm.SLOAD)
+	a.store(varStored)
+	for field, offset := range []uint64{128, 160, 192} {
+		elementWord(offset)
+		storedSlot(varStored, uint64(field))
+		a.op(vm.SSTORE)
+	}
+	a.load(varStored)
+	a.push(1)
+	a.op(vm.ADD)
+	a.load(varKey)
+	a.op(vm.SSTORE)
+
+	// TransactionAdded(userId indexed, day indexed, month indexed, year, assetId, totalDuration, rewards...)
+	a.load(memYear)
+	a.store(scratchArea)
+	a.push(0xa0)
+	a.store(scratchArea + 0x20)
+	for i, offset := range []uint64{128, 160, 192} {
+		elementWord(offset)
+		a.store(scratchArea + 0x40 + uint64(i)*0x20)
+	}
+	a.load(varAssetLen)
+	a.store(scratchArea + 0xa0)
+	padLength(varAssetLen, varAssetPad)
+	a.load(varAssetPad)
+	a.load(varAsset)
+	a.push(32)
+	a.op(vm.ADD)
+	a.push(scratchArea + 0xc0)
+	a.op(vm.CALLDATACOPY)
+	a.load(memMonth)
+	a.load(memDay)
+	a.load(memUserHash)
+	a.pushBytes(eventID)
+	a.load(varAssetPad)
+	a.push(0xc0)
+	a.op(vm.ADD)
+	a.push(scratchArea)
+	a.op(vm.LOG4)
+
+	a.load(varIndex)
+	a.push(1)
+	a.op(vm.ADD)
+	a.store(varIndex)
+	a.jump("insertLoop")
+	a.label("insertDone")
+	a.op(vm.STOP)
+
+	// getTransactionsByDay(string userId, uint256 day, uint256 month, uint256 year, string assetId)
+	a.label("getTransactionsByDay")
+	a.push(4)
+	a.op(vm.CALLDATALOAD)
+	a.push(4)
+	a.op(vm.ADD)
+	a.store(varUser)
+	a.load(varUser)
+	a.op(vm.CALLDATALOAD)
+	a.store(varUserLen)
+	a.push(132)
+	a.op(vm.CALLDATALOAD)
+	a.push(4)
+	a.op(vm.ADD)
+	a.store(varAsset)
+	a.load(varAsset)
+	a.op(vm.CALLDATALOAD)
+	a.store(varAssetLen)
+
+	hashString(varUser, varUserLen, memUserHash)
+	hashString(varAsset, varAssetLen, memAssetHash)
+	for i, offset := range []uint64{36, 68, 100} {
+		a.push(offset)
+		a.op(vm.CALLDATALOAD)
+		a.store(memDay + uint64(i)*0x20)
+	}
+	recordKey()
+	a.load(varKey)
+	a.op(vm.SLOAD)
+	a.store(varCount)
+
+	padLength(varUserLen, varUserPad)
+	padLength(varAssetLen, varAssetPad)
+	a.load(varUserPad)
+	a.load(varAssetPad)
+	a.op(vm.ADD)
+	a.push(0x140)
+	a.op(vm.ADD)
+	a.store(varTupleSize)
+
+	a.push(0x20)
+	a.store(scratchArea)
+	a.load(varCount)
+	a.store(scratchArea + 0x20)
+	a.push(0)
+	a.store(varIndex)
+
+	// tupleOffset pushes 32*count + index*tupleSize, the offset of the current tuple after the array length.
+	tupleOffset := func() {
+		a.load(varTupleSize)
+		a.load(varIndex)
+		a.op(vm.MUL)
+		a.load(varCount)
+		a.push(5)
+		a.op(vm.SHL)
+		a.op(vm.ADD)
+	}
+	// tupleWord stores the top of the stack at offset within the tuple being encoded.
+	tupleWord := func(offset uint64) {
+		a.load(varTupleStart)
+		a.push(offset)
+		a.op(vm.ADD, vm.MSTORE)
+	}
+
+	a.label("getLoop")
+	a.load(varCount)
+	a.load(varIndex)
+	a.op(vm.LT, vm.ISZERO)
+	a.jumpIf("getDone")
+
+	tupleOffset()
+	a.load(varIndex)
+	a.push(5)
+	a.op(vm.SHL)
+	a.push(scratchArea + 0x40)
+	a.op(vm.ADD, vm.MSTORE)
+	tupleOffset()
+	a.push(scratchArea + 0x40)
+	a.op(vm.ADD)
+	a.store(varTupleStart)
+
+	a.push(0x100)
+	tupleWord(0)
+	for i := uint64(0); i < 3; i++ {
+		a.load(memDay + i*0x20)
+		tupleWord(32 + i*32)
+	}
+	for field, offset := range []uint64{128, 160, 192} {
+		storedSlot(varIndex, uint64(field))
+		a.op(vm.SLOAD)
+		tupleWord(offset)
+	}
+	a.load(varUserPad)
+	a.push(0x120)
+	a.op(vm.ADD)
+	tupleWord(224)
+	a.load(varUserLen)
+	tupleWord(256)
+	a.load(varUserPad)
+	a.load(varUser)
+	a.push(32)
+	a.op(vm.ADD)
+	a.load(varTupleStart)
+	a.push(288)
+	a.op(vm.ADD, vm.CALLDATACOPY)
+	a.load(varAssetLen)
+	a.load(varUserPad)
+	a.load(varTupleStart)
+	a.op(vm.ADD)
+	a.push(288)
+	a.op(vm.ADD, vm.MSTORE)
+	a.load(varAssetPad)
+	a.load(varAsset)
+	a.push(32)
+	a.op(vm.ADD)
+	a.load(varUserPad)
+	a.load(varTupleStart)
+	a.op(vm.ADD)
+	a.push(320)
+	a.op(vm.ADD, vm.CALLDATACOPY)
+
+	a.load(varIndex)
+	a.push(1)
+	a.op(vm.ADD)
+	a.store(varIndex)
+	a.jump("getLoop")
+
+	a.label("getDone")
+	a.load(varTupleSize)
+	a.load(varCount)
+	a.op(vm.MUL)
+	a.load(varCount)
+	a.push(5)
+	a.op(vm.SHL)
+	a.op(vm.ADD)
+	a.push(64)
+	a.op(vm.ADD)
+	a.push(scratchArea)
+	a.op(vm.RETURN)
+
+	runtime := a.assemble()
+
+	// The creation code copies the runtime code into memory and returns it.
+	creation := newEVMAssembler()
+	creation.pushBytes([]byte{byte(len(runtime) >> 8), byte(len(runtime))})
+	creation.op(vm.DUP1)
+	creation.push(12)
+	creation.push(0)
+	creation.op(vm.CODECOPY)
+	creation.push(0)
+	creation.op(vm.RETURN)
+	return append(creation.assemble(), runtime...)
+}
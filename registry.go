@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Deployment is one deployment of the records contract. A registry file lists them as JSON, for example:
+//
+//	[
+//	  {"name": "v1", "address": "0x...", "chainId": 137, "activeUntil": "2024-11-01"},
+//	  {"name": "v2", "address": "0x...", "abiFile": "abi/v2.json", "chainId": 137, "activeFrom": "2024-11-01"}
+//	]
+//
+// activeFrom is inclusive and activeUntil exclusive; either may be omitted for an open range. abiFile is resolved
+// relative to the registry file and defaults to the ABI bundled in abi.go. A chainId of 0 matches any chain.
+type Deployment struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	ABIFile     string `json:"abiFile"`
+	ChainID     int64  `json:"chainId"`
+	ActiveFrom  string `json:"activeFrom"`
+	ActiveUntil string `json:"activeUntil"`
+
+	address     common.Address
+	abi         abi.ABI
+	activeFrom  time.Time
+	activeUntil time.Time
+}
+
+// ContractRegistry holds every known deployment of the records contract, so the writer can pick the one active
+// for the day it anchors and readers can still reach the contracts that hold older days.
+type ContractRegistry struct {
+	deployments []*Deployment
+}
+
+// LoadContractRegistry reads the deployments listed in CONTRACT_REGISTRY_FILE. When the variable is not set the
+// registry contains a single, always active deployment at CONTRACT_ADDRESS using the bundled ABI.
+func LoadContractRegistry() (*ContractRegistry, error) {
+	if path := config.Chain.ContractRegistryFile; path != "" {
+		return loadContractRegistryFile(path)
+	}
+	return newSingleDeploymentRegistry(config.Chain.ContractAddress)
+}
+
+// newSingleDeploymentRegistry returns a registry with one always active deployment using the bundled ABI.
+func newSingleDeploymentRegistry(address string) (*ContractRegistry, error) {
+	deployment := &Deployment{Name: "default", Address: address}
+	if err := deployment.init(""); err != nil {
+		return nil, err
+	}
+	return &ContractRegistry{deployments: []*Deployment{deployment}}, nil
+}
+
+// loadContractRegistryFile reads a JSON list of deployments.
+func loadContractRegistryFile(path string) (*ContractRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading contract registry %s: %v", path, err)
+		return nil, err
+	}
+
+	var deployments []*Deployment
+	if err := sonic.Unmarshal(data, &deployments); err != nil {
+		log.Printf("Error parsing contract registry %s: %v", path, err)
+		return nil, err
+	}
+	if len(deployments) == 0 {
+		return nil, fmt.Errorf("contract registry %s lists no deployments", path)
+	}
+
+	for _, deployment := range deployments {
+		if err := deployment.init(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+
+	registry := &ContractRegistry{deployments: deployments}
+	if err := registry.checkOverlaps(); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// init validates the deployment and resolves its address, ABI and active range.
+func (d *Deployment) init(baseDir string) error {
+	if !common.IsHexAddress(d.Address) {
+		return fmt.Errorf("deployment %q: invalid contract address %q", d.Name, d.Address)
+	}
+	d.address = common.HexToAddress(d.Address)
+	if d.address == (common.Address{}) {
+		return fmt.Errorf("deployment %q: contract address is the zero address", d.Name)
+	}
+
+	abiJSON := []byte(ABI)
+	if d.ABIFile != "" {
+		abiPath := d.ABIFile
+		if !filepath.IsAbs(abiPath) {
+			abiPath = filepath.Join(baseDir, abiPath)
+		}
+		var err error
+		abiJSON, err = os.ReadFile(abiPath)
+		if err != nil {
+			return fmt.Errorf("deployment %q: %w", d.Name, err)
+		}
+	}
+
+	parsedABI, err := abi.JSON(bytes.NewReader(abiJSON))
+	if err != nil {
+		return fmt.Errorf("deployment %q: invalid ABI: %w", d.Name, err)
+	}
+	if err := checkABICompatible(parsedABI); err != nil {
+		return fmt.Errorf("deployment %q: %w", d.Name, err)
+	}
+	d.abi = parsedABI
+
+	if d.ActiveFrom != "" {
+		if d.activeFrom, err = time.Parse("2006-01-02", d.ActiveFrom); err != nil {
+			return fmt.Errorf("deployment %q: invalid activeFrom: %w", d.Name, err)
+		}
+	}
+	if d.ActiveUntil != "" {
+		if d.activeUntil, err = time.Parse("2006-01-02", d.ActiveUntil); err != nil {
+			return fmt.Errorf("deployment %q: invalid activeUntil: %w", d.Name, err)
+		}
+		if !d.activeFrom.IsZero() && !d.activeUntil.After(d.activeFrom) {
+			return fmt.Errorf("deployment %q: activeUntil must be after activeFrom", d.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkABICompatible makes sure a deployment ABI exposes the records methods and event with the same signatures
+// as the bundled ABI, since the typed bindings pack and unpack them.
+func checkABICompatible(parsedABI abi.ABI) error {
+	bundled, err := RecordsMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range []string{"batchInsertRecords", "getTransactionsByDay"} {
+		method, ok := parsedABI.Methods[name]
+		if !ok {
+			return fmt.Errorf("ABI has no %s method", name)
+		}
+		if !bytes.Equal(method.ID, bundled.Methods[name].ID) {
+			return fmt.Errorf("ABI method %s does not match %s", method.Sig, bundled.Methods[name].Sig)
+		}
+	}
+
+	event, ok := parsedABI.Events["TransactionAdded"]
+	if !ok {
+		return fmt.Errorf("ABI has no TransactionAdded event")
+	}
+	if event.ID != bundled.Events["TransactionAdded"].ID {
+		return fmt.Errorf("ABI event %s does not match %s", event.Sig, bundled.Events["TransactionAdded"].Sig)
+	}
+
+	return nil
+}
+
+// checkOverlaps rejects registries where two deployments on the same chain are active on the same day.
+func (r *ContractRegistry) checkOverlaps() error {
+	for i, a := range r.deployments {
+		for _, b := range r.deployments[i+1:] {
+			if a.ChainID != 0 && b.ChainID != 0 && a.ChainID != b.ChainID {
+				continue
+			}
+			aEndsBeforeB := !a.activeUntil.IsZero() && !b.activeFrom.IsZero() && !a.activeUntil.After(b.activeFrom)
+			bEndsBeforeA := !b.activeUntil.IsZero() && !a.activeFrom.IsZero() && !b.activeUntil.After(a.activeFrom)
+			if !aEndsBeforeB && !bEndsBeforeA {
+				return fmt.Errorf("deployments %q and %q have overlapping active ranges", a.Name, b.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Deployments returns every deployment on the given chain, oldest first as listed in the registry.
+func (r *ContractRegistry) Deployments(chainID *big.Int) []*Deployment {
+	var deployments []*Deployment
+	for _, deployment := range r.deployments {
+		if deployment.matchesChain(chainID) {
+			deployments = append(deployments, deployment)
+		}
+	}
+	return deployments
+}
+
+// ActiveFor returns the deployment that records for the given day are written to on the given chain.
+func (r *ContractRegistry) ActiveFor(chainID *big.Int, day time.Time) (*Deployment, error) {
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	for _, deployment := range r.Deployments(chainID) {
+		if !deployment.activeFrom.IsZero() && date.Before(deployment.activeFrom) {
+			continue
+		}
+		if !deployment.activeUntil.IsZero() && !date.Before(deployment.activeUntil) {
+			continue
+		}
+		return deployment, nil
+	}
+	return nil, fmt.Errorf("no contract deployment active on %s for chain %s", date.Format("2006-01-02"), chainID)
+}
+
+// BindActive resolves the deployment active for the day on the client's chain and binds it.
+func (r *ContractRegistry) BindActive(ctx context.Context, client chainClient, day time.Time) (*Deployment, *Records, error) {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		log.Printf("Error fetching chain ID: %v", err)
+		return nil, nil, err
+	}
+
+	deployment, err := r.ActiveFor(chainID, day)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return deployment, deployment.Bind(client), nil
+}
+
+func (d *Deployment) matchesChain(chainID *big.Int) bool {
+	return d.ChainID == 0 || chainID == nil || chainID.Cmp(big.NewInt(d.ChainID)) == 0
+}
+
+// ContractAddress returns the parsed address of the deployment.
+func (d *Deployment) ContractAddress() common.Address {
+	return d.address
+}
+
+// Bind returns typed bindings for the deployment, packing calls with the deployment's own ABI.
+func (d *Deployment) Bind(backend bind.ContractBackend) *Records {
+	contract := bind.NewBoundContract(d.address, d.abi, backend, backend, backend)
+	return &Records{
+		RecordsCaller:     RecordsCaller{contract: contract},
+		RecordsTransactor: RecordsTransactor{contract: contract},
+		RecordsFilterer:   RecordsFilterer{contract: contract},
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/rpc"
+	"google.golang.org/api/googleapi"
+)
+
+// errorClass says how a failed external call should be handled.
+type errorClass int
+
+const (
+	// classFatal errors are returned immediately: reverts, bad input, cancellation.
+	classFatal errorClass = iota
+	// classTransient errors are retried after a backoff: rate limits, 5xx responses, dropped connections.
+	classTransient
+	// classNonce errors mean the transaction's nonce is stale and it must be signed again with a fresh one.
+	classNonce
+	// classFee errors mean the node refused the transaction's price and it must be signed again with higher fees.
+	classFee
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case classTransient:
+		return "transient"
+	case classNonce:
+		return "nonce"
+	case classFee:
+		return "fee"
+	default:
+		return "fatal"
+	}
+}
+
+// transientBigQueryReasons are the error reasons BigQuery documents as safe to retry.
+var transientBigQueryReasons = []string{"rateLimitExceeded", "backendError", "internalError", "jobRateLimitExceeded"}
+
+// classifyError sorts an RPC or BigQuery error into an errorClass. Node errors only carry a message, so they are
+// matched on the wording used by geth and the common hosted providers.
+func classifyError(err error) errorClass {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return classFatal
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && isTransientStatus(httpErr.StatusCode) {
+		return classTransient
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if isTransientStatus(apiErr.Code) {
+			return classTransient
+		}
+		for _, item := range apiErr.Errors {
+			for _, reason := range transientBigQueryReasons {
+				if item.Reason == reason {
+					return classTransient
+				}
+			}
+		}
+		return classFatal
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return classTransient
+	}
+
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(message, "nonce too low"), strings.Contains(message, "nonce too high"),
+		strings.Contains(message, "invalid nonce"):
+		return classNonce
+	case strings.Contains(message, "underpriced"), strings.Contains(message, "less than block base fee"),
+		strings.Contains(message, "fee cap less than"), strings.Contains(message, "max fee per gas less than"),
+		strings.Contains(message, "gas price too low"):
+		return classFee
+	case strings.Contains(message, "rate limit"), strings.Contains(message, "too many requests"),
+		strings.Contains(message, "connection reset"), strings.Contains(message, "connection refused"),
+		strings.Contains(message, "timeout"), strings.Contains(message, "temporarily unavailable"),
+		strings.Contains(message, "header not found"):
+		return classTransient
+	}
+	return classFatal
+}
+
+func isTransientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// isAlreadyKnown reports whether the node refused a transaction because it already has it, which means an
+// earlier attempt reached it.
+func isAlreadyKnown(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "already known") || strings.Contains(message, "known transaction")
+}
+
+// retryPolicy bounds the retries of failing external calls.
+type retryPolicy struct {
+	// Attempts is the total number of tries, including the first one (RETRY_ATTEMPTS, default 5).
+	Attempts int
+	// BaseDelay is the backoff before the second try, doubled for every further one (RETRY_BASE_DELAY, default 1s).
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff (RETRY_MAX_DELAY, default 30s).
+	MaxDelay time.Duration
+	// FeeBumpPercent raises the gas price or fee cap of a transaction the node found underpriced
+	// (FEE_BUMP_PERCENT, default 15; nodes require at least 10 to replace a pending transaction).
+	FeeBumpPercent int64
+}
+
+// retryPolicy returns the retry settings, with the defaults for those left unset.
+func (s *Settings) retryPolicy() retryPolicy {
+	policy := retryPolicy{Attempts: 5, BaseDelay: time.Second, MaxDelay: 30 * time.Second, FeeBumpPercent: 15}
+	if s.Retry.Attempts > 0 {
+		policy.Attempts = s.Retry.Attempts
+	}
+	if s.Retry.BaseDelay > 0 {
+		policy.BaseDelay = s.Retry.BaseDelay
+	}
+	if s.Retry.MaxDelay > 0 {
+		policy.MaxDelay = s.Retry.MaxDelay
+	}
+	if s.Retry.FeeBumpPercent > 0 {
+		policy.FeeBumpPercent = s.Retry.FeeBumpPercent
+	}
+	return policy
+}
+
+// backoff returns the delay before the given retry (1 for the first), an exponential backoff with full jitter.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << min(retry-1, 30)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// sleep waits for the backoff of the given retry, returning early with ctx's error when it is done.
+func (p retryPolicy) sleep(ctx context.Context, retry int) error {
+	select {
+	case <-time.After(p.backoff(retry)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// do calls fn until it succeeds, fails with a non-transient error or runs out of attempts. When ctx is done
+// during a backoff, the error wraps ctx's error, so a shutdown is not reported as a failure of fn.
+func (p retryPolicy) do(ctx context.Context, what string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if classifyError(err) != classTransient || attempt >= p.Attempts {
+			return err
+		}
+		log.Printf("Transient error %s (attempt %d of %d), retrying: %v", what, attempt, p.Attempts, err)
+		if sleepErr := p.sleep(ctx, attempt); sleepErr != nil {
+			return fmt.Errorf("%s interrupted before attempt %d: %w (last error: %v)", what, attempt+1, sleepErr, err)
+		}
+	}
+}
+
+// bumpFees raises the price of auth by the policy's percentage, refusing to go past the fee policy's cap.
+func (p retryPolicy) bumpFees(auth *bind.TransactOpts, fees FeePolicy) error {
+	bump := func(value *big.Int) *big.Int {
+		bumped := new(big.Int).Mul(value, big.NewInt(100+p.FeeBumpPercent))
+		return bumped.Div(bumped, big.NewInt(100))
+	}
+
+	price := auth.GasPrice
+	if auth.GasFeeCap != nil {
+		auth.GasTipCap = bump(auth.GasTipCap)
+		auth.GasFeeCap = bump(auth.GasFeeCap)
+		price = auth.GasFeeCap
+	} else if auth.GasPrice != nil {
+		auth.GasPrice = bump(auth.GasPrice)
+		price = auth.GasPrice
+	}
+
+	if maxGasPrice := fees.maxGasPrice(); maxGasPrice != nil && price != nil && price.Cmp(maxGasPrice) > 0 {
+		return fmt.Errorf("bumped gas price %s wei exceeds the configured maximum of %s wei", price, maxGasPrice)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// runOnce processes a single day immediately instead of waiting for the schedule. It is used to re-run or skip
+// specific chunks, e.g. "run -day 2024-10-20 -chunks 3,5-7" or "run -skip-chunks job-42:4", or to anchor rows
+// from a local file with "run -source csv:rows.csv". "run -sink stdout" prints the batches without a chain.
+func runOnce(ctx context.Context, args []string, settings *Settings) error {
+	opts, err := settings.defaultRunOptions()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	day := flags.String("day", opts.Day.Format("2006-01-02"), "createdAtDay to process (YYYY-MM-DD)")
+	flags.IntVar(&opts.LookbackDays, "lookback", opts.LookbackDays, "also process rows still pending from this many earlier days")
+	only := flags.String("chunks", "", "only send these chunks, e.g. 3,5-7,job-42:10")
+	skip := flags.String("skip-chunks", "", "never send these chunks, in addition to SKIP_CHUNKS")
+	flags.StringVar(&opts.Source, "source", opts.Source, "read rows from bigquery, csv:PATH or jsonl:PATH")
+	flags.StringVar(&opts.Sinks, "sink", opts.Sinks, "write batches to chain, chain:NAME, merkle, merkle:NAME, file:PATH (JSONL) or stdout; join with + or ,")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if opts.Day, err = time.Parse("2006-01-02", *day); err != nil {
+		return fmt.Errorf("invalid -day %q: %w", *day, err)
+	}
+	if opts.LookbackDays < 0 {
+		return fmt.Errorf("invalid -lookback %d", opts.LookbackDays)
+	}
+
+	if opts.OnlyChunks, err = ParseChunkSelector(*only); err != nil {
+		return fmt.Errorf("invalid -chunks: %w", err)
+	}
+
+	extraSkip, err := ParseChunkSelector(*skip)
+	if err != nil {
+		return fmt.Errorf("invalid -skip-chunks: %w", err)
+	}
+	opts.SkipChunks = append(opts.SkipChunks, extraSkip...)
+
+	if err := settings.checkJob(opts.Sinks); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return processJobs(ctx, settings.SecretName(), opts)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// Secrets Manager staging labels: the version in use, and the one it replaced at the last rotation.
+const (
+	secretCurrent  = "AWSCURRENT"
+	secretPrevious = "AWSPREVIOUS"
+)
+
+// secretBundle is one version of a secret, parsed into its keys.
+type secretBundle struct {
+	VersionID string
+	values    map[string]string
+	fetchedAt time.Time
+}
+
+// secretsProvider fetches each secret once and serves all its keys from memory for SECRETS_CACHE_TTL (a Go
+// duration, default 15m; 0 disables the cache), so a run reads Secrets Manager once instead of once per key.
+type secretsProvider struct {
+	mu      sync.Mutex
+	bundles map[string]*secretBundle
+	// fetch returns the raw value and version ID of a stage of a secret; the tests replace it.
+	fetch func(secretName, stage string) (string, string, error)
+}
+
+// secrets is the provider used by the whole job.
+var secrets = &secretsProvider{fetch: fetchSecretVersion}
+
+// secretsCacheTTL is how long a fetched secret is served from memory, SECRETS_CACHE_TTL or 15m.
+func (s *Settings) secretsCacheTTL() time.Duration {
+	if s.AWS.SecretsCacheTTL != nil {
+		return *s.AWS.SecretsCacheTTL
+	}
+	return 15 * time.Minute
+}
+
+// Bundle returns a stage of a secret, from the cache while it is fresh. Concurrent callers wait for a single
+// fetch.
+func (p *secretsProvider) Bundle(secretName, stage string) (*secretBundle, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := secretName + "@" + stage
+	if bundle, ok := p.bundles[key]; ok && time.Since(bundle.fetchedAt) < config.secretsCacheTTL() {
+		return bundle, nil
+	}
+
+	raw, versionID, err := p.fetch(secretName, stage)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := sonic.Unmarshal([]byte(raw), &data); err != nil {
+		log.Println("Fatal Error: Unable to unmarshal secret data from AWS Secrets Manager")
+		return nil, err
+	}
+	bundle := &secretBundle{VersionID: versionID, values: make(map[string]string, len(data)), fetchedAt: time.Now()}
+	for name, value := range data {
+		if value, ok := value.(string); ok {
+			bundle.values[name] = value
+		}
+	}
+
+	if previous, ok := p.bundles[key]; ok && previous.VersionID != versionID {
+		log.Printf("Secret %s was rotated, %s is now version %s", secretName, stage, versionID)
+	}
+	if p.bundles == nil {
+		p.bundles = make(map[string]*secretBundle)
+	}
+	p.bundles[key] = bundle
+	return bundle, nil
+}
+
+// Get returns a key of the current version of a secret. A key missing from a cached version is looked up once
+// more in a fresh one, in case the secret was rotated to add it.
+func (p *secretsProvider) Get(secretName, secretKey string) (string, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		bundle, err := p.Bundle(secretName, secretCurrent)
+		if err != nil {
+			return "", err
+		}
+		if value, ok := bundle.values[secretKey]; ok {
+			return value, nil
+		}
+		p.Invalidate(secretName)
+	}
+	log.Printf("Fatal Error: Secret key '%s' not found in AWS Secrets Manager response", secretKey)
+	return "", fmt.Errorf("secret key '%s' not found", secretKey)
+}
+
+// Invalidate drops the cached versions of a secret, e.g. after its credentials were refused.
+func (p *secretsProvider) Invalidate(secretName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.bundles, secretName+"@"+secretCurrent)
+	delete(p.bundles, secretName+"@"+secretPrevious)
+}
+
+// isAuthError reports whether err means the credentials read from a secret were refused, as happens once they
+// are rotated or revoked.
+func isAuthError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusUnauthorized
+	}
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr)
+}
+
+// secretFallback returns the value of envName, or when it is empty the key of the same name in lower case
+// (DEPLOYER_PRIVATE_KEY → deployer_private_key) of the SECRET_NAME secret, if one is configured.
+func secretFallback(envName string) (string, error) {
+	if value := os.Getenv(envName); value != "" {
+		return value, nil
+	}
+	secretName := config.AWS.SecretName
+	if secretName == "" {
+		return "", nil
+	}
+	value, err := secrets.Get(secretName, strings.ToLower(envName))
+	if err != nil {
+		return "", fmt.Errorf("%s is not set and could not be read from secret %s: %w", envName, secretName, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings is the configuration of the job, read from the YAML file named by CONFIG_FILE (config.yaml when it
+// exists) and overridden by the environment variable of each field:
+//
+//	environment: production            # ENVIRONMENT
+//	schedule: "10 00 * * *"            # SCHEDULE
+//	shutdownTimeout: 2m                # SHUTDOWN_TIMEOUT
+//	run:
+//	  source: bigquery                 # RECORD_SOURCE
+//	  sinks: chain                     # SINKS
+//	  batchSize: 50                    # BATCH_SIZE
+//	  lookbackDays: 3                  # LOOKBACK_DAYS
+//	bigquery:
+//	  sourceTable: project.dataset.table  # SOURCE_TABLE
+//	  auditTable: replay.audit         # AUDIT_TABLE
+//	chain:
+//	  rpcUrl: https://polygon-rpc.example/KEY  # RPC_URL
+//	  chainId: 137                     # CHAIN_ID
+//	  contractAddress: "0x..."         # CONTRACT_ADDRESS
+//	aws:
+//	  region: us-east-1                # AWS_REGION
+//	  fallbackRegions: [us-west-2]     # SECRETS_MANAGER_FALLBACK_REGIONS, comma separated
+//	  endpoint: http://localhost:4566  # SECRETS_MANAGER_ENDPOINT
+//	  profile: replay                  # AWS_PROFILE
+//	  roleArn: arn:aws:iam::123456789012:role/replay-secrets  # SECRETS_ROLE_ARN
+//	  secretName: production/imaginereplay  # SECRET_NAME, ENVIRONMENT/imaginereplay by default
+//	  secretsCacheTTL: 15m             # SECRETS_CACHE_TTL
+//
+// See bindings for every field. The signer key is never read from the file: it stays in DEPLOYER_PRIVATE_KEY, or
+// the variable named by a chain target. main keeps the loaded settings in config, where the rest of the job reads
+// them.
+type Settings struct {
+	Environment     string        `yaml:"environment"`
+	Schedule        string        `yaml:"schedule"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	Run struct {
+		Source        string        `yaml:"source"`
+		Sinks         string        `yaml:"sinks"`
+		BatchSize     int           `yaml:"batchSize"`
+		LookbackDays  int           `yaml:"lookbackDays"`
+		SkipChunks    string        `yaml:"skipChunks"`
+		Lock          string        `yaml:"lock"`
+		LockTTL       time.Duration `yaml:"lockTTL"`
+		PendingTxFile string        `yaml:"pendingTxFile"`
+	} `yaml:"run"`
+
+	BigQuery struct {
+		SourceTable     string `yaml:"sourceTable"`
+		StorageRead     *bool  `yaml:"storageRead"`
+		QuarantineTable string `yaml:"quarantineTable"`
+		AuditTable      string `yaml:"auditTable"`
+	} `yaml:"bigquery"`
+
+	Chain struct {
+		RPCURL               string        `yaml:"rpcUrl"`
+		ChainID              int64         `yaml:"chainId"`
+		ContractAddress      string        `yaml:"contractAddress"`
+		ContractRegistryFile string        `yaml:"contractRegistryFile"`
+		TargetsFile          string        `yaml:"targetsFile"`
+		LowBalanceThreshold  float64       `yaml:"lowBalanceThreshold"`
+		PreflightMaxWait     time.Duration `yaml:"preflightMaxWait"`
+		MerkleTreeDir        string        `yaml:"merkleTreeDir"`
+		MerkleAnchorAddress  string        `yaml:"merkleAnchorAddress"`
+		MerkleAnchorer       string        `yaml:"merkleAnchorer"`
+	} `yaml:"chain"`
+
+	RPCHealth struct {
+		MaxHeadLag   *uint64       `yaml:"maxHeadLag"`
+		MaxHeadAge   time.Duration `yaml:"maxHeadAge"`
+		ProbeTimeout time.Duration `yaml:"probeTimeout"`
+	} `yaml:"rpcHealth"`
+
+	Retry struct {
+		Attempts       int           `yaml:"attempts"`
+		BaseDelay      time.Duration `yaml:"baseDelay"`
+		MaxDelay       time.Duration `yaml:"maxDelay"`
+		FeeBumpPercent int64         `yaml:"feeBumpPercent"`
+	} `yaml:"retry"`
+
+	Validation struct {
+		RequireAssetID *bool   `yaml:"requireAssetId"`
+		MaxReward      float64 `yaml:"maxReward"`
+		MaxDuration    int64   `yaml:"maxDuration"`
+	} `yaml:"validation"`
+
+	Costs struct {
+		GasTokenPrice     string `yaml:"gasTokenPrice"`
+		GasTokenPriceFile string `yaml:"gasTokenPriceFile"`
+		FiatCurrency      string `yaml:"fiatCurrency"`
+	} `yaml:"costs"`
+
+	Alerts struct {
+		WebhookURL string `yaml:"webhookUrl"`
+	} `yaml:"alerts"`
+
+	AWS struct {
+		Region          string         `yaml:"region"`
+		FallbackRegions []string       `yaml:"fallbackRegions"`
+		Endpoint        string         `yaml:"endpoint"`
+		Profile         string         `yaml:"profile"`
+		RoleARN         string         `yaml:"roleArn"`
+		SecretName      string         `yaml:"secretName"`
+		SecretsCacheTTL *time.Duration `yaml:"secretsCacheTTL"`
+	} `yaml:"aws"`
+}
+
+// defaultSchedule runs the job at 00:10 every day.
+const defaultSchedule = "10 00 * * *"
+
+// defaultSourceTable is the BigQuery table holding the chunked daily rewards, unless SOURCE_TABLE names another.
+const defaultSourceTable = "replay-353318.replayAnalytics.table_blockchain_chunked_data_of_the_day_and_asset"
+
+// config is the configuration the job runs with: the defaults until main stores what LoadSettings returned. The
+// tests replace it with settings loaded from the environment they set up.
+var config = defaultSettings()
+
+// defaultSettings returns the settings used where neither the file nor the environment says otherwise.
+func defaultSettings() *Settings {
+	settings := &Settings{Schedule: defaultSchedule, ShutdownTimeout: 2 * time.Minute}
+	settings.Run.BatchSize = defaultBatchSize
+	settings.BigQuery.SourceTable = defaultSourceTable
+	settings.AWS.Region = defaultAWSRegion
+	return settings
+}
+
+// setting binds a field of the settings to its environment variable.
+type setting struct {
+	env   string
+	field any
+}
+
+// bindings lists every field with its environment variable. Fields left at their zero value keep the default
+// of the code that reads the variable.
+func (s *Settings) bindings() []setting {
+	return []setting{
+		{"ENVIRONMENT", &s.Environment},
+		{"SCHEDULE", &s.Schedule},
+		{"SHUTDOWN_TIMEOUT", &s.ShutdownTimeout},
+		{"RECORD_SOURCE", &s.Run.Source},
+		{"SINKS", &s.Run.Sinks},
+		{"BATCH_SIZE", &s.Run.BatchSize},
+		{"LOOKBACK_DAYS", &s.Run.LookbackDays},
+		{"SKIP_CHUNKS", &s.Run.SkipChunks},
+		{"RUN_LOCK", &s.Run.Lock},
+		{"RUN_LOCK_TTL", &s.Run.LockTTL},
+		{"PENDING_TX_FILE", &s.Run.PendingTxFile},
+		{"SOURCE_TABLE", &s.BigQuery.SourceTable},
+		{"BIGQUERY_STORAGE_READ", &s.BigQuery.StorageRead},
+		{"QUARANTINE_TABLE", &s.BigQuery.QuarantineTable},
+		{"AUDIT_TABLE", &s.BigQuery.AuditTable},
+		{"RPC_URL", &s.Chain.RPCURL},
+		{"CHAIN_ID", &s.Chain.ChainID},
+		{"CONTRACT_ADDRESS", &s.Chain.ContractAddress},
+		{"CONTRACT_REGISTRY_FILE", &s.Chain.ContractRegistryFile},
+		{"CHAIN_TARGETS_FILE", &s.Chain.TargetsFile},
+		{"LOW_BALANCE_THRESHOLD", &s.Chain.LowBalanceThreshold},
+		{"PREFLIGHT_MAX_WAIT", &s.Chain.PreflightMaxWait},
+		{"MERKLE_TREE_DIR", &s.Chain.MerkleTreeDir},
+		{"MERKLE_ANCHOR_ADDRESS", &s.Chain.MerkleAnchorAddress},
+		{"MERKLE_ANCHORER", &s.Chain.MerkleAnchorer},
+		{"RPC_MAX_HEAD_LAG", &s.RPCHealth.MaxHeadLag},
+		{"RPC_MAX_HEAD_AGE", &s.RPCHealth.MaxHeadAge},
+		{"RPC_PROBE_TIMEOUT", &s.RPCHealth.ProbeTimeout},
+		{"RETRY_ATTEMPTS", &s.Retry.Attempts},
+		{"RETRY_BASE_DELAY", &s.Retry.BaseDelay},
+		{"RETRY_MAX_DELAY", &s.Retry.MaxDelay},
+		{"FEE_BUMP_PERCENT", &s.Retry.FeeBumpPercent},
+		{"VALIDATION_REQUIRE_ASSET_ID", &s.Validation.RequireAssetID},
+		{"VALIDATION_MAX_REWARD", &s.Validation.MaxReward},
+		{"VALIDATION_MAX_DURATION", &s.Validation.MaxDuration},
+		{"GAS_TOKEN_PRICE", &s.Costs.GasTokenPrice},
+		{"GAS_TOKEN_PRICE_FILE", &s.Costs.GasTokenPriceFile},
+		{"FIAT_CURRENCY", &s.Costs.FiatCurrency},
+		{"ALERT_WEBHOOK_URL", &s.Alerts.WebhookURL},
+		{"AWS_REGION", &s.AWS.Region},
+		{"SECRETS_MANAGER_FALLBACK_REGIONS", &s.AWS.FallbackRegions},
+		{"SECRETS_MANAGER_ENDPOINT", &s.AWS.Endpoint},
+		{"AWS_PROFILE", &s.AWS.Profile},
+		{"SECRETS_ROLE_ARN", &s.AWS.RoleARN},
+		{"SECRET_NAME", &s.AWS.SecretName},
+		{"SECRETS_CACHE_TTL", &s.AWS.SecretsCacheTTL},
+	}
+}
+
+// LoadSettings reads the configuration file, applies the environment overrides and validates the result. Every
+// invalid setting is reported, not only the first.
+func LoadSettings() (*Settings, error) {
+	settings := defaultSettings()
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		if _, err := os.Stat("config.yaml"); err == nil {
+			path = "config.yaml"
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(settings); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	var errs []error
+	for _, binding := range settings.bindings() {
+		if value := os.Getenv(binding.env); value != "" {
+			if err := parseSetting(binding.field, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s %q: %w", binding.env, value, err))
+			}
+		}
+	}
+	errs = append(errs, settings.validate()...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	// Filled in, so the signer key and RPC URL can be read from the secret when their variables are empty.
+	if settings.AWS.SecretName == "" && settings.Environment != "" {
+		settings.AWS.SecretName = settings.SecretName()
+	}
+	return settings, nil
+}
+
+// parseSetting stores an environment value in a settings field.
+func parseSetting(field any, value string) error {
+	var err error
+	switch field := field.(type) {
+	case *string:
+		*field = value
+	case *int:
+		*field, err = strconv.Atoi(value)
+	case *int64:
+		*field, err = strconv.ParseInt(value, 10, 64)
+	case *float64:
+		*field, err = strconv.ParseFloat(value, 64)
+	case *time.Duration:
+		*field, err = time.ParseDuration(value)
+	case *[]string:
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	case **time.Duration:
+		var parsed time.Duration
+		parsed, err = time.ParseDuration(value)
+		*field = &parsed
+	case **bool:
+		var parsed bool
+		parsed, err = strconv.ParseBool(value)
+		*field = &parsed
+	case **uint64:
+		var parsed uint64
+		parsed, err = strconv.ParseUint(value, 10, 64)
+		*field = &parsed
+	default:
+		panic(fmt.Sprintf("unsupported setting type %T", field))
+	}
+	return err
+}
+
+var (
+	bigQueryTablePattern = regexp.MustCompile(`^([a-z][a-z0-9-]{4,28}[a-z0-9]\.)?[A-Za-z0-9_]+\.[A-Za-z0-9_$-]+$`)
+	awsRegionPattern     = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]*)?-[a-z]+-[0-9]+$`)
+	iamRoleARNPattern    = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:role/[A-Za-z0-9+=,.@_/-]+$`)
+)
+
+// validate checks the format of every setting, naming the offending environment variable.
+func (s *Settings) validate() []error {
+	var errs []error
+	fail := func(env, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", env, fmt.Sprintf(format, args...)))
+	}
+
+	if _, err := cron.ParseStandard(s.Schedule); err != nil {
+		fail("SCHEDULE", "invalid cron expression %q: %v", s.Schedule, err)
+	}
+	if s.Run.BatchSize <= 0 {
+		fail("BATCH_SIZE", "must be positive, got %d", s.Run.BatchSize)
+	}
+	if s.Run.LookbackDays < 0 {
+		fail("LOOKBACK_DAYS", "must not be negative, got %d", s.Run.LookbackDays)
+	}
+	if _, err := ParseChunkSelector(s.Run.SkipChunks); err != nil {
+		fail("SKIP_CHUNKS", "%v", err)
+	}
+	for _, duration := range []struct {
+		env   string
+		value time.Duration
+	}{
+		{"SHUTDOWN_TIMEOUT", s.ShutdownTimeout}, {"RUN_LOCK_TTL", s.Run.LockTTL}, {"PREFLIGHT_MAX_WAIT", s.Chain.PreflightMaxWait},
+		{"RPC_MAX_HEAD_AGE", s.RPCHealth.MaxHeadAge}, {"RPC_PROBE_TIMEOUT", s.RPCHealth.ProbeTimeout},
+		{"RETRY_BASE_DELAY", s.Retry.BaseDelay}, {"RETRY_MAX_DELAY", s.Retry.MaxDelay},
+	} {
+		if duration.value < 0 {
+			fail(duration.env, "must not be negative, got %s", duration.value)
+		}
+	}
+	if s.AWS.SecretsCacheTTL != nil && *s.AWS.SecretsCacheTTL < 0 {
+		fail("SECRETS_CACHE_TTL", "must not be negative, got %s", *s.AWS.SecretsCacheTTL)
+	}
+	if s.Retry.Attempts < 0 || s.Retry.FeeBumpPercent < 0 {
+		fail("RETRY_ATTEMPTS / FEE_BUMP_PERCENT", "must not be negative")
+	}
+	if s.Validation.MaxReward < 0 || s.Validation.MaxDuration < 0 || s.Chain.LowBalanceThreshold < 0 {
+		fail("VALIDATION_MAX_REWARD / VALIDATION_MAX_DURATION / LOW_BALANCE_THRESHOLD", "must not be negative")
+	}
+
+	if !bigQueryTablePattern.MatchString(s.BigQuery.SourceTable) || strings.Count(s.BigQuery.SourceTable, ".") != 2 {
+		fail("SOURCE_TABLE", "expected project.dataset.table, got %q", s.BigQuery.SourceTable)
+	}
+	for _, table := range []struct{ env, value string }{
+		{"QUARANTINE_TABLE", s.BigQuery.QuarantineTable}, {"AUDIT_TABLE", s.BigQuery.AuditTable},
+	} {
+		if table.value != "" && !bigQueryTablePattern.MatchString(table.value) {
+			fail(table.env, "expected dataset.table or project.dataset.table, got %q", table.value)
+		}
+	}
+	if kind, arg, _ := strings.Cut(s.Run.Lock, ":"); kind == "bigquery" && !bigQueryTablePattern.MatchString(arg) {
+		fail("RUN_LOCK", "expected bigquery:dataset.table, got %q", s.Run.Lock)
+	}
+
+	if s.Chain.RPCURL != "" {
+		for _, endpoint := range parseRPCURLs(s.Chain.RPCURL) {
+			if err := checkURL(endpoint.URL, "http", "https", "ws", "wss"); err != nil {
+				fail("RPC_URL", "%s: %v", redactURL(endpoint.URL), err)
+			}
+		}
+	}
+	if s.Chain.ChainID < 0 {
+		fail("CHAIN_ID", "must not be negative, got %d", s.Chain.ChainID)
+	}
+	for _, address := range []struct{ env, value string }{
+		{"CONTRACT_ADDRESS", s.Chain.ContractAddress}, {"MERKLE_ANCHOR_ADDRESS", s.Chain.MerkleAnchorAddress},
+		{"MERKLE_ANCHORER", s.Chain.MerkleAnchorer},
+	} {
+		if address.value == "" {
+			continue
+		}
+		if !common.IsHexAddress(address.value) {
+			fail(address.env, "invalid address %q", address.value)
+		} else if common.HexToAddress(address.value) == (common.Address{}) {
+			fail(address.env, "the zero address cannot be used")
+		}
+	}
+	for _, path := range []struct{ env, value string }{
+		{"CONTRACT_REGISTRY_FILE", s.Chain.ContractRegistryFile}, {"CHAIN_TARGETS_FILE", s.Chain.TargetsFile},
+		{"GAS_TOKEN_PRICE_FILE", s.Costs.GasTokenPriceFile},
+	} {
+		if path.value == "" {
+			continue
+		}
+		if _, err := os.Stat(path.value); err != nil {
+			fail(path.env, "%v", err)
+		}
+	}
+	if s.Alerts.WebhookURL != "" {
+		if err := checkURL(s.Alerts.WebhookURL, "https", "http"); err != nil {
+			fail("ALERT_WEBHOOK_URL", "%v", err)
+		}
+	}
+	if !awsRegionPattern.MatchString(s.AWS.Region) {
+		fail("AWS_REGION", "invalid region %q", s.AWS.Region)
+	}
+	for _, region := range s.AWS.FallbackRegions {
+		if !awsRegionPattern.MatchString(region) {
+			fail("SECRETS_MANAGER_FALLBACK_REGIONS", "invalid region %q", region)
+		}
+	}
+	if s.AWS.Endpoint != "" {
+		if err := checkURL(s.AWS.Endpoint, "http", "https"); err != nil {
+			fail("SECRETS_MANAGER_ENDPOINT", "%v", err)
+		}
+	}
+	if s.AWS.RoleARN != "" && !iamRoleARNPattern.MatchString(s.AWS.RoleARN) {
+		fail("SECRETS_ROLE_ARN", "invalid IAM role ARN %q", s.AWS.RoleARN)
+	}
+
+	return errs
+}
+
+// SecretName is the Secrets Manager secret holding the job's credentials: SECRET_NAME, or
+// ENVIRONMENT/imaginereplay.
+func (s *Settings) SecretName() string {
+	if s.AWS.SecretName != "" {
+		return s.AWS.SecretName
+	}
+	return s.Environment + "/imaginereplay"
+}
+
+// checkURL makes sure rawURL is absolute, with one of the schemes and a host.
+func checkURL(rawURL string, schemes ...string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	for _, scheme := range schemes {
+		if parsed.Scheme == scheme {
+			if parsed.Host == "" {
+				return fmt.Errorf("missing host")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("scheme must be one of %s", strings.Join(schemes, ", "))
+}
+
+// checkJob fails fast on what a job writing to the given sinks needs beyond well-formed settings: the
+// environment and, when the sinks write on chain, a readable chain targets file and gas token prices. Signer keys,
+// secrets and RPC endpoints are left to the run that uses them.
+func (s *Settings) checkJob(sinks string) error {
+	var errs []error
+	if s.Environment == "" {
+		errs = append(errs, fmt.Errorf("ENVIRONMENT: must be set"))
+	}
+	if !sinksUseChain(sinks) {
+		return errors.Join(errs...)
+	}
+	if s.Chain.TargetsFile != "" {
+		if _, err := LoadReadOnlyChainTargets(); err != nil {
+			errs = append(errs, fmt.Errorf("chain targets: %w", err))
+		}
+	}
+	if _, err := loadFiatPrices(s.Costs.GasTokenPrice, s.Costs.GasTokenPriceFile, s.Costs.FiatCurrency); err != nil {
+		errs = append(errs, fmt.Errorf("gas token prices: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BatchSink is a destination for the batches of a run. Every sink gets its own queue, so a slow or failing
+// sink does not hold back the others.
+type BatchSink interface {
+	// Name identifies the sink in logs, status reports and alerts.
+	Name() string
+	// Prepare runs before the first batch; an error skips the sink for the rest of the run.
+	Prepare(ctx context.Context, plan runPlan, first Batch) error
+	// Write stores one batch. Sinks that anchor on chain return the confirmed transaction, the others return nil.
+	Write(ctx context.Context, batch Batch) (*anchoredBatch, error)
+	// Close runs once the run is over, whether or not any batch was written.
+	Close() error
+}
+
+// sinkStatus tracks the outcome of one run on one sink.
+type sinkStatus struct {
+	Sink      string
+	Skipped   error
+	Confirmed int
+	Failed    int
+	Results   []batchResult
+}
+
+// batchResult links a chunk to the transaction that anchored it, or to the error that stopped it. TxHash is
+// zero for sinks that do not write on chain.
+type batchResult struct {
+	Chunk  string
+	Rows   int
+	TxHash common.Hash
+	// LogIndexes holds the log index of the TransactionAdded event of every row, in row order, once the
+	// receipt was verified.
+	LogIndexes []uint
+	// Day is the createdAtDay of the chunk and Fee what its transaction cost in wei, failed ones included.
+	Day string
+	Fee *big.Int
+	Err error
+}
+
+// OpenBatchSinks builds the sinks described by spec, a comma separated list where each entry is one of:
+//
+//	chain        every configured chain target
+//	chain:NAME   the chain target called NAME
+//	merkle       anchor one Merkle root per day on every chain target instead of the records, see merkleSink
+//	merkle:NAME  the same on the chain target called NAME
+//	file:PATH    append the rows as JSONL to PATH, readable back with the jsonl:PATH record source
+//	stdout       print the rows as JSONL
+//
+// Entries joined with "+" form a single sink that writes to each part in turn and stops at the first failure,
+// e.g. "file:archive.jsonl+chain" only anchors what was archived first. An empty spec means "chain".
+//
+// Archives are JSONL only. Parquet is out of scope: the job would need a Parquet writer and its codecs as new
+// dependencies, so "parquet:PATH" is refused, and a JSONL archive can be converted or loaded into BigQuery
+// instead.
+func OpenBatchSinks(spec string) ([]BatchSink, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = "chain"
+	}
+
+	var targets []*ChainTarget
+	loadTargets := func() ([]*ChainTarget, error) {
+		if targets != nil {
+			return targets, nil
+		}
+		var err error
+		if targets, err = LoadChainTargets(); err != nil {
+			log.Println("Failed to load chain targets: ", err)
+		}
+		return targets, err
+	}
+
+	var sinks []BatchSink
+	for _, entry := range strings.Split(spec, ",") {
+		var parts []BatchSink
+		for _, part := range strings.Split(strings.TrimSpace(entry), "+") {
+			opened, err := openSink(strings.TrimSpace(part), loadTargets)
+			if err != nil {
+				closeSinks(sinks)
+				closeSinks(parts)
+				return nil, err
+			}
+			parts = append(parts, opened...)
+		}
+
+		if len(parts) == 1 {
+			sinks = append(sinks, parts[0])
+		} else {
+			sinks = append(sinks, sequenceSink(parts))
+		}
+	}
+
+	return sinks, nil
+}
+
+// sinksUseChain reports whether a spec of OpenBatchSinks writes to a chain target, through chain or merkle sinks.
+func sinksUseChain(spec string) bool {
+	if strings.TrimSpace(spec) == "" {
+		return true
+	}
+	for _, part := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '+' }) {
+		switch kind, _, _ := strings.Cut(strings.TrimSpace(part), ":"); kind {
+		case "chain", "merkle":
+			return true
+		}
+	}
+	return false
+}
+
+// openSink opens the sinks for a single entry; "chain" expands to one sink per target.
+func openSink(spec string, loadTargets func() ([]*ChainTarget, error)) ([]BatchSink, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "chain":
+		targets, err := loadTargets()
+		if err != nil {
+			return nil, err
+		}
+		if arg != "" {
+			target, err := FindChainTarget(targets, arg)
+			if err != nil {
+				return nil, err
+			}
+			return []BatchSink{&chainSink{target: target}}, nil
+		}
+		sinks := make([]BatchSink, len(targets))
+		for i, target := range targets {
+			sinks[i] = &chainSink{target: target}
+		}
+		return sinks, nil
+	case "merkle":
+		targets, err := loadTargets()
+		if err != nil {
+			return nil, err
+		}
+		if arg != "" {
+			target, err := FindChainTarget(targets, arg)
+			if err != nil {
+				return nil, err
+			}
+			return []BatchSink{&merkleSink{target: target}}, nil
+		}
+		sinks := make([]BatchSink, len(targets))
+		for i, target := range targets {
+			sinks[i] = &merkleSink{target: target}
+		}
+		return sinks, nil
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("sink %q: missing file path", spec)
+		}
+		file, err := os.OpenFile(arg, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Printf("Error opening archive file %s: %v", arg, err)
+			return nil, err
+		}
+		return []BatchSink{&jsonlSink{name: spec, out: file, file: file}}, nil
+	case "stdout":
+		return []BatchSink{&jsonlSink{name: "stdout", out: os.Stdout}}, nil
+	case "parquet":
+		return nil, fmt.Errorf("sink %q: Parquet archives are not supported, archive as JSONL with file:PATH", spec)
+	default:
+		return nil, fmt.Errorf("unknown sink %q, expected chain, chain:NAME, merkle, merkle:NAME, file:PATH or stdout", spec)
+	}
+}
+
+// pendingResolver is implemented by sinks that can settle transactions left pending by an interrupted run.
+type pendingResolver interface {
+	ResolvePending(ctx context.Context, firstDay time.Time)
+}
+
+// resolvePending lets every sink that supports it settle what an interrupted run left behind, for a run that
+// starts reading at firstDay.
+func resolvePending(ctx context.Context, sinks []BatchSink, firstDay time.Time) {
+	for _, sink := range sinks {
+		if resolver, ok := sink.(pendingResolver); ok {
+			resolver.ResolvePending(ctx, firstDay)
+		}
+	}
+}
+
+// finisher is implemented by sinks that write their batches only once the last one was received.
+type finisher interface {
+	// Holds reports whether Write only takes batches in, leaving Finish to write them.
+	Holds() bool
+	// Finish writes the batches held back, recording the rows it anchors in audit, and reports the outcome of
+	// each batch to handled.
+	Finish(ctx context.Context, status *sinkStatus, audit *auditTrail, handled func(Batch, error))
+}
+
+// holdsBatches reports whether the sink writes its batches only in Finish.
+func holdsBatches(sink BatchSink) bool {
+	f, ok := sink.(finisher)
+	return ok && f.Holds()
+}
+
+// finishSinks lets every sink that supports it write what it held back, unless it was skipped.
+func finishSinks(ctx context.Context, sinks []BatchSink, statuses []*sinkStatus, audit *auditTrail, marks *rowMarks) {
+	for i, sink := range sinks {
+		if f, ok := sink.(finisher); ok && statuses[i].Skipped == nil {
+			f.Finish(ctx, statuses[i], audit, marks.handler(ctx, i))
+		}
+	}
+}
+
+// closeSinks closes every sink, logging failures.
+func closeSinks(sinks []BatchSink) {
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("[%s] Failed to close sink: %v", sink.Name(), err)
+		}
+	}
+}
+
+// chainSink anchors batches on one chain target through batchInsertRecords.
+type chainSink struct {
+	target *ChainTarget
+	// unusable is set when preflight failed, so Close does not repeat the balance alert.
+	unusable bool
+}
+
+func (s *chainSink) Name() string {
+	return s.target.Name
+}
+
+// Prepare checks that the contract accepts writes from the signer and that the signer can pay for the run.
+func (s *chainSink) Prepare(ctx context.Context, plan runPlan, first Batch) error {
+	if err := checkContractReady(ctx, s.target, first.Rows[0].CreatedAtDay); err != nil {
+		s.unusable = true
+		return err
+	}
+	if err := checkDeployerBalance(ctx, s.target, plan, first); err != nil {
+		s.unusable = true
+		return err
+	}
+	return nil
+}
+
+func (s *chainSink) Write(ctx context.Context, batch Batch) (*anchoredBatch, error) {
+	return addToBlockchain(ctx, s.target, batch)
+}
+
+// ResolvePending settles the transactions an interrupted run left pending on the target.
+func (s *chainSink) ResolvePending(ctx context.Context, firstDay time.Time) {
+	resolvePendingTxs(ctx, s.target, firstDay)
+}
+
+// Close warns when the run left the signer's balance low.
+func (s *chainSink) Close() error {
+	if !s.unusable {
+		warnIfLowBalance(s.target)
+	}
+	return nil
+}
+
+// jsonlSink writes every row as one JSON line in the record source format, so an archive can be replayed with
+// "run -source jsonl:PATH".
+type jsonlSink struct {
+	name string
+	out  io.Writer
+	// file is set when the sink owns the file, which is then synced after each batch and closed with the sink.
+	file *os.File
+}
+
+func (s *jsonlSink) Name() string {
+	return s.name
+}
+
+func (s *jsonlSink) Prepare(context.Context, runPlan, Batch) error {
+	return nil
+}
+
+func (s *jsonlSink) Write(_ context.Context, batch Batch) (*anchoredBatch, error) {
+	w := bufio.NewWriter(s.out)
+	for _, row := range batch.Rows {
+		line, err := sonic.Marshal(newFileRecord(row))
+		if err != nil {
+			return nil, err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if s.file != nil {
+		if err := s.file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (s *jsonlSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// sequenceSink writes each batch to its parts in order, stopping at the first part that fails.
+type sequenceSink []BatchSink
+
+func (s sequenceSink) Name() string {
+	names := make([]string, len(s))
+	for i, sink := range s {
+		names[i] = sink.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (s sequenceSink) Prepare(ctx context.Context, plan runPlan, first Batch) error {
+	for _, sink := range s {
+		if err := sink.Prepare(ctx, plan, first); err != nil {
+			return fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Write returns the last transaction produced by a part, so a sequence ending on a chain reports it.
+func (s sequenceSink) Write(ctx context.Context, batch Batch) (*anchoredBatch, error) {
+	var anchored *anchoredBatch
+	for _, sink := range s {
+		partAnchored, err := sink.Write(ctx, batch)
+		if partAnchored != nil {
+			anchored = partAnchored
+		}
+		if err != nil {
+			return anchored, fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+	return anchored, nil
+}
+
+// Holds reports whether any part holds back its batches.
+func (s sequenceSink) Holds() bool {
+	for _, sink := range s {
+		if holdsBatches(sink) {
+			return true
+		}
+	}
+	return false
+}
+
+// Finish lets the parts that hold back their batches write them.
+func (s sequenceSink) Finish(ctx context.Context, status *sinkStatus, audit *auditTrail, handled func(Batch, error)) {
+	for _, sink := range s {
+		if f, ok := sink.(finisher); ok {
+			f.Finish(ctx, status, audit, handled)
+		}
+	}
+}
+
+func (s sequenceSink) ResolvePending(ctx context.Context, firstDay time.Time) {
+	resolvePending(ctx, s, firstDay)
+}
+
+func (s sequenceSink) Close() error {
+	var firstErr error
+	for _, sink := range s {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// record adds the outcome of one batch to the status.
+func (s *sinkStatus) record(batch Batch, anchored *anchoredBatch, err error) {
+	result := batchResult{Chunk: batch.Label(), Rows: len(batch.Rows), Day: batch.Rows[0].CreatedAtDay.Format("2006-01-02"), Err: err}
+	if anchored != nil {
+		result.TxHash = anchored.TxHash
+		result.Fee = receiptFee(anchored.Receipt)
+		if err == nil {
+			result.LogIndexes = transactionAddedLogIndexes(anchored.Receipt)
+		}
+	}
+	s.Results = append(s.Results, result)
+
+	if err != nil {
+		s.Failed++
+	} else {
+		s.Confirmed++
+	}
+}
+
+// summary renders the status as a single log line mapping every chunk to its transaction.
+func (s *sinkStatus) summary() string {
+	if s.Skipped != nil {
+		return fmt.Sprintf("[%s] skipped: %v", s.Sink, s.Skipped)
+	}
+	chunks := make([]string, len(s.Results))
+	for i, result := range s.Results {
+		switch {
+		case result.Err != nil:
+			chunks[i] = fmt.Sprintf("%s failed (%v)", result.Chunk, result.Err)
+		case result.TxHash == (common.Hash{}):
+			chunks[i] = fmt.Sprintf("%s written", result.Chunk)
+		default:
+			chunks[i] = fmt.Sprintf("%s -> %s", result.Chunk, result.TxHash.Hex())
+		}
+	}
+	return fmt.Sprintf("[%s] %d chunks confirmed, %d failed: %s",
+		s.Sink, s.Confirmed, s.Failed, strings.Join(chunks, ", "))
+}
+
+// costSummary renders what the run spent on the sink in gas, per day and in total, converted to fiat when the
+// prices cover it. It is empty for sinks that sent no transaction.
+func (s *sinkStatus) costSummary(prices fiatPrices) string {
+	total := new(big.Int)
+	byDay := map[string]*big.Int{}
+	var days []string
+	transactions := 0
+	for _, result := range s.Results {
+		if result.Fee == nil {
+			continue
+		}
+		transactions++
+		total.Add(total, result.Fee)
+		if byDay[result.Day] == nil {
+			byDay[result.Day] = new(big.Int)
+			days = append(days, result.Day)
+		}
+		byDay[result.Day].Add(byDay[result.Day], result.Fee)
+	}
+	if transactions == 0 {
+		return ""
+	}
+
+	fiat := new(big.Float)
+	perDay := make([]string, len(days))
+	for i, day := range days {
+		perDay[i] = fmt.Sprintf("%s: %s", day, FromWei(byDay[day]))
+		if price, ok := prices.price(s.Sink, day); ok && fiat != nil {
+			fiat.Add(fiat, toFiat(byDay[day], price))
+		} else {
+			fiat = nil
+		}
+	}
+	summary := fmt.Sprintf("[%s] Gas cost: %s over %d transactions (%s)", s.Sink, FromWei(total), transactions, strings.Join(perDay, ", "))
+	if fiat != nil {
+		summary += fmt.Sprintf(", %s %s", fiat.Text('f', 4), prices.Currency)
+	}
+	return summary
+}
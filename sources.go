@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/bytedance/sonic"
+	"google.golang.org/api/iterator"
+)
+
+// RecordSource yields the rows of a run in createdAtDay, JOB_ID, CHUNK_ID order, whatever they are read from.
+type RecordSource interface {
+	// Plan counts the rows, chunks and batches the source will yield.
+	Plan(ctx context.Context) (runPlan, error)
+	// Stream sends every row to out, blocking while the pipeline is busy.
+	Stream(ctx context.Context, out chan<- JobDataRow) error
+	// Close releases the resources held by the source.
+	Close() error
+}
+
+// Statuses set on the rows of the source table once a run is done with them; the bigquery source only reads rows
+// without a status.
+const (
+	statusQuarantined = "quarantined"
+	statusAnchored    = "anchored"
+)
+
+// rowMarker is implemented by sources that can record what became of their rows, so later runs skip them.
+type rowMarker interface {
+	// MarkRows sets the status of the given rows, leaving rows that already have one untouched.
+	MarkRows(ctx context.Context, status string, rows []sourceRowKey) error
+}
+
+// sourceRowKey identifies a row of the source table: its chunk of a day, userId and assetId.
+type sourceRowKey struct {
+	Day     civil.Date          `bigquery:"day"`
+	JobID   string              `bigquery:"jobId"`
+	ChunkID float64             `bigquery:"chunkId"`
+	UserID  string              `bigquery:"userId"`
+	AssetID bigquery.NullString `bigquery:"assetId"`
+}
+
+// newSourceRowKey returns the key of the source row a row was read from.
+func newSourceRowKey(row JobDataRow) sourceRowKey {
+	return sourceRowKey{Day: civil.DateOf(row.CreatedAtDay), JobID: row.JobID, ChunkID: row.ChunkID, UserID: row.UserID, AssetID: row.AssetID}
+}
+
+// openRecordSource opens the source of a run; the integration tests replace it.
+var openRecordSource = OpenRecordSource
+
+// OpenRecordSource opens the source described by spec: "bigquery" (the default when spec is empty) reads the
+// pending rows from SOURCE_TABLE whose createdAtDay falls between from and to, while "csv:<path>" and
+// "jsonl:<path>" read every row of a local file. Rows come ordered by day, JOB_ID and CHUNK_ID.
+func OpenRecordSource(spec, secretName string, from, to time.Time) (RecordSource, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "bigquery":
+		return newBigQuerySource(secretName, from, to)
+	case "csv":
+		return loadFileSource(path, readCSVRecords)
+	case "jsonl":
+		return loadFileSource(path, readJSONLRecords)
+	default:
+		return nil, fmt.Errorf("unknown record source %q, expected bigquery, csv:<path> or jsonl:<path>", spec)
+	}
+}
+
+// bigQuerySource reads the rows of a range of days that have no status yet.
+type bigQuerySource struct {
+	where string
+	// secretName and version identify the credentials of the client, so they can be replaced when refused.
+	secretName string
+	version    string
+
+	// mu guards client, which reconnect replaces while writers sharing it may be fetching it.
+	mu     sync.Mutex
+	client *bigquery.Client
+	// retired holds the clients replaced by reconnect. Their iterators, and the writers that fetched them
+	// through Client, may still be using them, so they are only closed with the source.
+	retired []*bigquery.Client
+}
+
+func newBigQuerySource(secretName string, from, to time.Time) (*bigQuerySource, error) {
+	where := fmt.Sprintf(`
+			DATE(createdAtDay) BETWEEN '%s' AND '%s' AND
+		    status IS NULL`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+
+	s := &bigQuerySource{where: where, secretName: secretName}
+	if err := s.connect(secretCurrent); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect opens the client with the credentials of a stage of the secret, replacing the current one.
+func (s *bigQuerySource) connect(stage string) error {
+	client, version, err := newBigQueryClient(s.secretName, stage)
+	if err != nil {
+		log.Println("Failed to create BigQuery client: ", err)
+		return err
+	}
+
+	if storageRead := config.BigQuery.StorageRead; storageRead != nil && *storageRead {
+		if err := client.EnableStorageReadClient(context.Background()); err != nil {
+			log.Println("Failed to enable the BigQuery Storage Read API: ", err)
+			client.Close()
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		s.retired = append(s.retired, s.client)
+	}
+	s.client, s.version = client, version
+	return nil
+}
+
+// Client returns the client holding the credentials that currently work. Writers sharing the source's client
+// fetch it for every write, so they follow its reconnections.
+func (s *bigQuerySource) Client() *bigquery.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// reconnect replaces credentials that BigQuery refused: with the current version of the secret when it was
+// rotated since they were read, otherwise with the previous version, which remains valid while a rotation that
+// has not reached BigQuery yet settles.
+func (s *bigQuerySource) reconnect() error {
+	refused := s.version
+	secrets.Invalidate(s.secretName)
+	if err := s.connect(secretCurrent); err != nil {
+		return err
+	}
+	if s.version != refused {
+		log.Printf("BigQuery refused the credentials of version %s, using the rotated version %s", refused, s.version)
+		return nil
+	}
+	log.Printf("BigQuery refused the current credentials (version %s), trying the previous version", refused)
+	return s.connect(secretPrevious)
+}
+
+// Plan counts the rows, chunks and batches of each day matching the filter without reading the rows themselves.
+func (s *bigQuerySource) Plan(ctx context.Context) (runPlan, error) {
+	queryStr := fmt.Sprintf(`
+		SELECT
+			day,
+			COUNT(*) AS chunks,
+			SUM(rowCount) AS rowCount,
+			SUM(CAST(CEIL(rowCount / %d) AS INT64)) AS batches
+		FROM (
+			SELECT
+				FORMAT_DATE('%%F', DATE(createdAtDay)) AS day,
+				JOB_ID,
+				CHUNK_ID,
+				COUNT(*) AS rowCount
+			FROM
+				%s
+			WHERE%s
+			GROUP BY
+				day,
+				JOB_ID,
+				CHUNK_ID
+		)
+		GROUP BY
+			day
+		ORDER BY
+			day
+	`, config.Run.BatchSize, config.BigQuery.SourceTable, s.where)
+
+	var plan runPlan
+	rows, err := s.read(ctx, queryStr)
+	if err != nil {
+		return plan, err
+	}
+	for {
+		var day dayPlan
+		err := rows.Next(&day)
+		if errors.Is(err, iterator.Done) {
+			return plan, nil
+		}
+		if err != nil {
+			return plan, err
+		}
+		plan.add(day)
+	}
+}
+
+// read runs a query, retrying transient failures and, once, refused credentials. Rows are only retried up to the first one: a failure while
+// iterating fails the read, since the rows already handed on cannot be taken back.
+func (s *bigQuerySource) read(ctx context.Context, queryStr string) (*bigquery.RowIterator, error) {
+	var rows *bigquery.RowIterator
+	query := func() (err error) {
+		rows, err = s.Client().Query(queryStr).Read(ctx)
+		return err
+	}
+	err := config.retryPolicy().do(ctx, "querying "+config.BigQuery.SourceTable, query)
+	if isAuthError(err) {
+		if reconnectErr := s.reconnect(); reconnectErr != nil {
+			return nil, errors.Join(err, reconnectErr)
+		}
+		err = config.retryPolicy().do(ctx, "querying "+config.BigQuery.SourceTable, query)
+	}
+	return rows, err
+}
+
+// exec runs a DML statement and waits for it, retrying transient failures. Statements only touch rows without a
+// status, so running one twice is harmless.
+func (s *bigQuerySource) exec(ctx context.Context, description, queryStr string, params []bigquery.QueryParameter) error {
+	return config.retryPolicy().do(ctx, description, func() error {
+		query := s.Client().Query(queryStr)
+		query.Parameters = params
+		job, err := query.Run(ctx)
+		if err != nil {
+			return err
+		}
+		status, err := job.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		return status.Err()
+	})
+}
+
+// MarkRows sets the status of the given rows in SOURCE_TABLE.
+func (s *bigQuerySource) MarkRows(ctx context.Context, status string, rows []sourceRowKey) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	queryStr := fmt.Sprintf(`
+		UPDATE
+			%s AS t
+		SET
+			status = @status
+		WHERE
+			t.status IS NULL AND
+			EXISTS (
+				SELECT 1 FROM UNNEST(@rows) AS r
+				WHERE r.day = DATE(t.createdAtDay) AND r.jobId = t.JOB_ID AND r.chunkId = t.CHUNK_ID AND
+					r.userId = t.userId AND r.assetId IS NOT DISTINCT FROM t.assetId
+			)
+	`, config.BigQuery.SourceTable)
+
+	err := s.exec(ctx, "marking rows "+status, queryStr, []bigquery.QueryParameter{
+		{Name: "status", Value: status},
+		{Name: "rows", Value: rows},
+	})
+	if err != nil {
+		log.Printf("Failed to mark %d rows %s: %v", len(rows), status, err)
+		return err
+	}
+	log.Printf("%d rows marked %s in %s", len(rows), status, config.BigQuery.SourceTable)
+	return nil
+}
+
+// Stream reads the rows matching the filter in day, JOB_ID, CHUNK_ID order, so memory stays bounded regardless
+// of the size of the days.
+func (s *bigQuerySource) Stream(ctx context.Context, out chan<- JobDataRow) error {
+	queryStr := fmt.Sprintf(`
+		SELECT
+			CHUNK_ID,
+			JOB_ID,
+			assetId,
+			createdAtDay,
+			totalDuration,
+			totalRewardsConsumer,
+			totalRewardsContentOwner,
+			userId,
+			status
+		FROM
+			%s
+		WHERE%s
+		ORDER BY
+			DATE(createdAtDay),
+			JOB_ID,
+			CHUNK_ID
+	`, config.BigQuery.SourceTable, s.where)
+
+	rows, err := s.read(ctx, queryStr)
+	if err != nil {
+		log.Println("Failed to execute query: ", err)
+		return err
+	}
+
+	for {
+		var row JobDataRow
+		err := rows.Next(&row)
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case out <- row:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *bigQuerySource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, client := range append(s.retired, s.client) {
+		errs = append(errs, client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// fileSource serves rows loaded from a local file. Files are meant for tests, one-off corrections and partner
+// deliveries, so they are read whole and sorted by createdAtDay, JOB_ID and CHUNK_ID; every row in the file is
+// anchored, whatever its createdAtDay.
+type fileSource struct {
+	rows []JobDataRow
+}
+
+// fileRecord is the on-disk shape of a row, using the same column names as the BigQuery table.
+type fileRecord struct {
+	JobID                    string  `json:"JOB_ID"`
+	ChunkID                  float64 `json:"CHUNK_ID"`
+	UserID                   string  `json:"userId"`
+	AssetID                  *string `json:"assetId"`
+	TotalDuration            int64   `json:"totalDuration"`
+	TotalRewardsConsumer     float64 `json:"totalRewardsConsumer"`
+	TotalRewardsContentOwner float64 `json:"totalRewardsContentOwner"`
+	CreatedAtDay             string  `json:"createdAtDay"`
+	Status                   *string `json:"status"`
+}
+
+func loadFileSource(path string, read func(io.Reader) ([]fileRecord, error)) (*fileSource, error) {
+	if path == "" {
+		return nil, fmt.Errorf("record source file path is empty")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening record file %s: %v", path, err)
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	rows := make([]JobDataRow, len(records))
+	for i, record := range records {
+		if rows[i], err = record.toRow(); err != nil {
+			return nil, fmt.Errorf("%s: record %d: %w", path, i+1, err)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].CreatedAtDay.Equal(rows[j].CreatedAtDay) {
+			return rows[i].CreatedAtDay.Before(rows[j].CreatedAtDay)
+		}
+		if rows[i].JobID != rows[j].JobID {
+			return rows[i].JobID < rows[j].JobID
+		}
+		return rows[i].ChunkID < rows[j].ChunkID
+	})
+
+	log.Printf("Loaded %d rows from %s", len(rows), path)
+	return &fileSource{rows: rows}, nil
+}
+
+// newFileRecord converts a row to its on-disk shape, the inverse of toRow.
+func newFileRecord(row JobDataRow) fileRecord {
+	record := fileRecord{
+		JobID:                    row.JobID,
+		ChunkID:                  row.ChunkID,
+		UserID:                   row.UserID,
+		TotalDuration:            row.TotalDuration,
+		TotalRewardsConsumer:     row.TotalRewardsConsumer,
+		TotalRewardsContentOwner: row.TotalRewardsContentOwner,
+	}
+	if row.AssetID.Valid {
+		record.AssetID = &row.AssetID.StringVal
+	}
+	if row.Status.Valid {
+		record.Status = &row.Status.StringVal
+	}
+	if !row.CreatedAtDay.IsZero() {
+		record.CreatedAtDay = row.CreatedAtDay.Format("2006-01-02")
+	}
+	return record
+}
+
+func (r fileRecord) toRow() (JobDataRow, error) {
+	row := JobDataRow{
+		JobID:                    r.JobID,
+		ChunkID:                  r.ChunkID,
+		UserID:                   r.UserID,
+		TotalDuration:            r.TotalDuration,
+		TotalRewardsConsumer:     r.TotalRewardsConsumer,
+		TotalRewardsContentOwner: r.TotalRewardsContentOwner,
+	}
+	if r.AssetID != nil {
+		row.AssetID = bigquery.NullString{StringVal: *r.AssetID, Valid: true}
+	}
+	if r.Status != nil {
+		row.Status = bigquery.NullString{StringVal: *r.Status, Valid: true}
+	}
+
+	if r.CreatedAtDay != "" {
+		day, err := time.Parse("2006-01-02", r.CreatedAtDay)
+		if err != nil {
+			if day, err = time.Parse(time.RFC3339, r.CreatedAtDay); err != nil {
+				return row, fmt.Errorf("invalid createdAtDay %q", r.CreatedAtDay)
+			}
+		}
+		row.CreatedAtDay = day
+	}
+
+	return row, nil
+}
+
+// Plan counts the rows and chunks of each day in the file.
+func (s *fileSource) Plan(context.Context) (runPlan, error) {
+	batchSize := config.Run.BatchSize
+	var plan runPlan
+	var day dayPlan
+	for i := 0; i < len(s.rows); {
+		j := i
+		for j < len(s.rows) && sameChunk(s.rows[i], s.rows[j]) {
+			j++
+		}
+
+		if dayOf := s.rows[i].CreatedAtDay.Format("2006-01-02"); dayOf != day.Day {
+			if day.Rows > 0 {
+				plan.add(day)
+			}
+			day = dayPlan{Day: dayOf}
+		}
+		day.Rows += int64(j - i)
+		day.Chunks++
+		day.Batches += int64((j - i + batchSize - 1) / batchSize)
+		i = j
+	}
+	if day.Rows > 0 {
+		plan.add(day)
+	}
+	return plan, nil
+}
+
+func (s *fileSource) Stream(ctx context.Context, out chan<- JobDataRow) error {
+	for _, row := range s.rows {
+		select {
+		case out <- row:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *fileSource) Close() error {
+	return nil
+}
+
+// readJSONLRecords parses one JSON object per line, skipping blank lines.
+func readJSONLRecords(r io.Reader) ([]fileRecord, error) {
+	var records []fileRecord
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record fileRecord
+		if err := sonic.UnmarshalString(text, &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// readCSVRecords parses a CSV file whose header names the columns. Empty assetId and status cells are read as
+// NULL, matching the BigQuery export format.
+func readCSVRecords(r io.Reader) ([]fileRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"JOB_ID", "CHUNK_ID", "userId", "totalDuration",
+		"totalRewardsConsumer", "totalRewardsContentOwner", "createdAtDay"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %s", required)
+		}
+	}
+
+	var records []fileRecord
+	for line := 2; ; line++ {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		nullable := func(name string) *string {
+			if value := cell(name); value != "" {
+				return &value
+			}
+			return nil
+		}
+
+		record := fileRecord{
+			JobID:        cell("JOB_ID"),
+			UserID:       cell("userId"),
+			AssetID:      nullable("assetId"),
+			CreatedAtDay: cell("createdAtDay"),
+			Status:       nullable("status"),
+		}
+		if record.ChunkID, err = strconv.ParseFloat(cell("CHUNK_ID"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid CHUNK_ID: %w", line, err)
+		}
+		if record.TotalDuration, err = strconv.ParseInt(cell("totalDuration"), 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid totalDuration: %w", line, err)
+		}
+		if record.TotalRewardsConsumer, err = strconv.ParseFloat(cell("totalRewardsConsumer"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid totalRewardsConsumer: %w", line, err)
+		}
+		if record.TotalRewardsContentOwner, err = strconv.ParseFloat(cell("totalRewardsContentOwner"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid totalRewardsContentOwner: %w", line, err)
+		}
+
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSVRecordsMapsColumnsByHeader(t *testing.T) {
+	csv := strings.Join([]string{
+		"createdAtDay, userId,extra,totalRewardsContentOwner,totalRewardsConsumer,totalDuration,CHUNK_ID,JOB_ID,assetId",
+		"2024-10-20,user-a,x,0.5,1.25,10,3,job-1,asset-1",
+		"2024-10-20T00:00:00Z, user-b ,y,0,2,20,4,job-1,",
+	}, "\n")
+
+	records, err := readCSVRecords(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("readCSVRecords: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+
+	first := records[0]
+	if first.JobID != "job-1" || first.ChunkID != 3 || first.UserID != "user-a" || first.TotalDuration != 10 ||
+		first.TotalRewardsConsumer != 1.25 || first.TotalRewardsContentOwner != 0.5 || first.CreatedAtDay != "2024-10-20" {
+		t.Errorf("first record = %+v", first)
+	}
+	if first.AssetID == nil || *first.AssetID != "asset-1" {
+		t.Errorf("first assetId = %v, want asset-1", first.AssetID)
+	}
+	if records[1].UserID != "user-b" {
+		t.Errorf("second userId = %q, want it trimmed", records[1].UserID)
+	}
+	if records[1].AssetID != nil || records[1].Status != nil {
+		t.Errorf("empty assetId and missing status must be NULL, got %v and %v", records[1].AssetID, records[1].Status)
+	}
+}
+
+func TestReadCSVRecordsRejectsMalformedInput(t *testing.T) {
+	header := "JOB_ID,CHUNK_ID,userId,assetId,totalDuration,totalRewardsConsumer,totalRewardsContentOwner,createdAtDay"
+	tests := []struct {
+		name string
+		csv  string
+		err  string
+	}{
+		{"empty file", "", "reading header"},
+		{"missing column", "JOB_ID,CHUNK_ID,userId,totalDuration,totalRewardsConsumer,createdAtDay\n", "missing column totalRewardsContentOwner"},
+		{"invalid CHUNK_ID", header + "\njob-1,one,user-a,asset-1,10,1,1,2024-10-20\n", "line 2: invalid CHUNK_ID"},
+		{"invalid totalDuration", header + "\njob-1,1,user-a,asset-1,10,1,1,2024-10-20\njob-1,1,user-b,asset-1,1.5,1,1,2024-10-20\n", "line 3: invalid totalDuration"},
+		{"invalid reward", header + "\njob-1,1,user-a,asset-1,10,lots,1,2024-10-20\n", "line 2: invalid totalRewardsConsumer"},
+		{"wrong field count", header + "\njob-1,1,user-a\n", "wrong number of fields"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readCSVRecords(strings.NewReader(test.csv))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("readCSVRecords error = %v, want it to contain %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestReadJSONLRecords(t *testing.T) {
+	jsonl := "\n" +
+		`{"JOB_ID":"job-1","CHUNK_ID":1,"userId":"user-a","assetId":null,"totalDuration":5,"totalRewardsConsumer":1,"totalRewardsContentOwner":2,"createdAtDay":"2024-10-20","status":"done"}` +
+		"\n   \n" +
+		`{"JOB_ID":"job-1","CHUNK_ID":2,"userId":"user-b","assetId":"asset-1","totalDuration":6,"totalRewardsConsumer":0,"totalRewardsContentOwner":0,"createdAtDay":"2024-10-21"}` + "\n"
+
+	records, err := readJSONLRecords(strings.NewReader(jsonl))
+	if err != nil {
+		t.Fatalf("readJSONLRecords: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2: blank lines are skipped", len(records))
+	}
+	if records[0].AssetID != nil || records[0].Status == nil || *records[0].Status != "done" {
+		t.Errorf("first record assetId %v, status %v", records[0].AssetID, records[0].Status)
+	}
+	if records[1].AssetID == nil || *records[1].AssetID != "asset-1" || records[1].ChunkID != 2 {
+		t.Errorf("second record = %+v", records[1])
+	}
+
+	_, err = readJSONLRecords(strings.NewReader(`{"JOB_ID":"job-1"}` + "\n\n{not json}\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("malformed line error = %v, want it to name line 3", err)
+	}
+}
+
+func TestFileRecordParsesCreatedAtDay(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		err   bool
+	}{
+		{value: "2024-10-20", want: testDay},
+		{value: "2024-10-20T00:00:00Z", want: testDay},
+		{value: "", want: time.Time{}},
+		{value: "20/10/2024", err: true},
+	}
+	for _, test := range tests {
+		row, err := fileRecord{CreatedAtDay: test.value}.toRow()
+		if test.err {
+			if err == nil {
+				t.Errorf("toRow(%q) accepted an invalid day", test.value)
+			}
+			continue
+		}
+		if err != nil || !row.CreatedAtDay.Equal(test.want) {
+			t.Errorf("toRow(%q) = %v, %v, want %v", test.value, row.CreatedAtDay, err, test.want)
+		}
+	}
+}
+
+func TestLoadFileSourceSortsRowsAndStatementFiltersByKeyAndDay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.csv")
+	csv := strings.Join([]string{
+		"JOB_ID,CHUNK_ID,userId,assetId,totalDuration,totalRewardsConsumer,totalRewardsContentOwner,createdAtDay",
+		"job-2,1,user-a,asset-1,30,3,3,2024-10-20",
+		"job-1,2,user-a,asset-1,20,2,2,2024-10-20",
+		"job-1,1,user-a,asset-1,10,1,1,2024-10-21",
+		"job-1,1,user-b,asset-1,40,4,4,2024-10-20",
+		"job-1,1,user-a,asset-2,50,5,5,2024-10-20",
+	}, "\n")
+	if err := os.WriteFile(path, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadFileSource(path, readCSVRecords)
+	if err != nil {
+		t.Fatalf("loadFileSource: %v", err)
+	}
+	var order []string
+	for _, row := range source.rows {
+		order = append(order, strconv.FormatInt(row.TotalDuration, 10))
+	}
+	// Ordered by day, then JOB_ID, then CHUNK_ID, keeping the file order within a chunk.
+	if got, want := strings.Join(order, ","), "40,50,20,30,10"; got != want {
+		t.Errorf("rows in order %s, want %s", got, want)
+	}
+
+	rows, err := loadStatement("csv:"+path, "user-a", "asset-1", testDay)
+	if err != nil {
+		t.Fatalf("loadStatement: %v", err)
+	}
+	if len(rows) != 2 || rows[0].TotalDuration != 20 || rows[1].TotalDuration != 30 {
+		t.Errorf("statement rows %+v, want the two user-a asset-1 rows of 2024-10-20", rows)
+	}
+
+	if _, err := loadStatement("csv:"+path, "user-c", "asset-1", testDay); err == nil {
+		t.Error("loadStatement found rows for a user without any")
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ChainTarget is one network the daily records are anchored on. CHAIN_TARGETS_FILE lists them as JSON, for example:
+//
+//	[
+//	  {"name": "polygon", "rpcUrl": "https://...", "chainId": 137, "contractRegistry": "contracts-polygon.json",
+//	   "signerKeyEnv": "POLYGON_PRIVATE_KEY", "fees": {"mode": "eip1559", "maxGasPriceGwei": 300}},
+//	  {"name": "mainnet", "chainId": 1, "contractAddress": "0x...",
+//	   "rpcEndpoints": [{"url": "https://primary...", "priority": 0}, {"url": "https://backup...", "priority": 1}],
+//	   "signerKeyEnv": "MAINNET_PRIVATE_KEY", "lowBalanceThreshold": 0.5}
+//	]
+//
+// rpcUrl may list several comma separated URLs, prioritised in that order; they are added to rpcEndpoints.
+// The contract comes from contractRegistry (resolved relative to the targets file) or contractAddress, and falls
+// back to CONTRACT_REGISTRY_FILE / CONTRACT_ADDRESS. signerKeyEnv names the variable holding the signer key and
+// defaults to DEPLOYER_PRIVATE_KEY.
+type ChainTarget struct {
+	Name                string        `json:"name"`
+	RPCURL              string        `json:"rpcUrl"`
+	Endpoints           []RPCEndpoint `json:"rpcEndpoints"`
+	ChainID             int64         `json:"chainId"`
+	ContractRegistry    string        `json:"contractRegistry"`
+	ContractAddress     string        `json:"contractAddress"`
+	SignerKeyEnv        string        `json:"signerKeyEnv"`
+	Fees                FeePolicy     `json:"fees"`
+	LowBalanceThreshold float64       `json:"lowBalanceThreshold"`
+
+	registry   *ContractRegistry
+	privateKey *ecdsa.PrivateKey
+
+	// healthy holds the endpoints that passed the last probe, best first. Targets are loaded for each run, so
+	// the endpoints are probed once per run rather than on every Dial.
+	healthMu sync.Mutex
+	healthy  []RPCEndpoint
+}
+
+// FeePolicy controls how a target prices its transactions.
+type FeePolicy struct {
+	// Mode is "legacy" (gasPrice, the default) or "eip1559" (tip and fee cap).
+	Mode string `json:"mode"`
+	// Multiplier scales the node's suggested gas price or tip; 0 means 1.
+	Multiplier float64 `json:"multiplier"`
+	// MaxGasPriceGwei refuses to send when the gas price or fee cap would exceed it; 0 disables the cap.
+	MaxGasPriceGwei float64 `json:"maxGasPriceGwei"`
+}
+
+// LoadChainTargets reads CHAIN_TARGETS_FILE. When it is not set, a single "default" target is built from RPC_URL,
+// CHAIN_ID, DEPLOYER_PRIVATE_KEY, LOW_BALANCE_THRESHOLD and the contract registry variables. RPC_URL and the signer
+// keys may also come from the SECRET_NAME secret, see secretFallback.
+func LoadChainTargets() ([]*ChainTarget, error) {
+	return loadChainTargets(false)
+}
+
+// LoadReadOnlyChainTargets loads the targets for commands that only read from the chain through an endpoint of
+// their choosing: the targets need neither an RPC endpoint nor a signer key.
+func LoadReadOnlyChainTargets() ([]*ChainTarget, error) {
+	return loadChainTargets(true)
+}
+
+func loadChainTargets(readOnly bool) ([]*ChainTarget, error) {
+	path := config.Chain.TargetsFile
+	if path == "" {
+		rpcURL := config.Chain.RPCURL
+		if rpcURL == "" {
+			var err error
+			if rpcURL, err = secretFallback("RPC_URL"); err != nil {
+				return nil, err
+			}
+		}
+		target := &ChainTarget{Name: "default", RPCURL: rpcURL, ChainID: config.Chain.ChainID,
+			LowBalanceThreshold: config.Chain.LowBalanceThreshold}
+		if err := target.init("", readOnly); err != nil {
+			return nil, err
+		}
+		return []*ChainTarget{target}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading chain targets %s: %v", path, err)
+		return nil, err
+	}
+
+	var targets []*ChainTarget
+	if err := sonic.Unmarshal(data, &targets); err != nil {
+		log.Printf("Error parsing chain targets %s: %v", path, err)
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("chain targets file %s lists no targets", path)
+	}
+
+	names := make(map[string]bool)
+	for _, target := range targets {
+		if names[target.Name] {
+			return nil, fmt.Errorf("duplicate chain target name %q", target.Name)
+		}
+		names[target.Name] = true
+
+		if err := target.init(filepath.Dir(path), readOnly); err != nil {
+			return nil, err
+		}
+	}
+
+	return targets, nil
+}
+
+// FindChainTarget returns the target with the given name, or the first target when name is empty.
+func FindChainTarget(targets []*ChainTarget, name string) (*ChainTarget, error) {
+	if name == "" {
+		return targets[0], nil
+	}
+	for _, target := range targets {
+		if target.Name == name {
+			return target, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown chain target %q", name)
+}
+
+// init validates the target and loads its signer key and contract registry. A read-only target skips the signer
+// key and may have no RPC endpoint.
+func (t *ChainTarget) init(baseDir string, readOnly bool) error {
+	if t.Name == "" {
+		return fmt.Errorf("chain target without a name")
+	}
+	for _, endpoint := range parseRPCURLs(t.RPCURL) {
+		endpoint.Priority += len(t.Endpoints)
+		t.Endpoints = append(t.Endpoints, endpoint)
+	}
+	if len(t.Endpoints) == 0 && !readOnly {
+		return fmt.Errorf("chain target %q: missing rpcUrl or rpcEndpoints", t.Name)
+	}
+	for _, endpoint := range t.Endpoints {
+		if endpoint.URL == "" {
+			return fmt.Errorf("chain target %q: RPC endpoint without a url", t.Name)
+		}
+	}
+
+	switch t.Fees.Mode {
+	case "":
+		t.Fees.Mode = "legacy"
+	case "legacy", "eip1559":
+	default:
+		return fmt.Errorf("chain target %q: unknown fee mode %q", t.Name, t.Fees.Mode)
+	}
+	if t.Fees.Multiplier < 0 || t.Fees.MaxGasPriceGwei < 0 {
+		return fmt.Errorf("chain target %q: fee multiplier and cap must not be negative", t.Name)
+	}
+
+	if t.SignerKeyEnv == "" {
+		t.SignerKeyEnv = "DEPLOYER_PRIVATE_KEY"
+	}
+	var err error
+	if !readOnly {
+		if t.privateKey, err = loadPrivateKey(t.SignerKeyEnv); err != nil {
+			return fmt.Errorf("chain target %q: %w", t.Name, err)
+		}
+	}
+
+	switch {
+	case t.ContractRegistry != "":
+		path := t.ContractRegistry
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		t.registry, err = loadContractRegistryFile(path)
+	case t.ContractAddress != "":
+		t.registry, err = newSingleDeploymentRegistry(t.ContractAddress)
+	default:
+		t.registry, err = LoadContractRegistry()
+	}
+	if err != nil {
+		return fmt.Errorf("chain target %q: %w", t.Name, err)
+	}
+
+	return nil
+}
+
+// dialRPC opens an RPC connection; the integration tests replace it with an in-process chain.
+var dialRPC = func(ctx context.Context, url string) (chainClient, error) {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Dial connects to the target's healthy RPC endpoints, see dialEndpoints, retrying transient failures. The
+// endpoints are probed on the first call; later calls reuse that result and probe again only when none of the
+// healthy endpoints can be dialled.
+func (t *ChainTarget) Dial(ctx context.Context) (chainClient, error) {
+	t.healthMu.Lock()
+	defer t.healthMu.Unlock()
+
+	if client := t.dialHealthy(ctx); client != nil {
+		return client, nil
+	}
+	t.healthy = nil
+
+	var client chainClient
+	err := config.retryPolicy().do(ctx, "connecting to "+t.Name, func() (err error) {
+		client, err = t.dialEndpoints(ctx)
+		return err
+	})
+	if err != nil {
+		log.Printf("[%s] Error connecting to Ethereum client: %v", t.Name, err)
+		return nil, err
+	}
+	return client, nil
+}
+
+// SignerAddress returns the address of the account that signs the target's transactions.
+func (t *ChainTarget) SignerAddress() common.Address {
+	return crypto.PubkeyToAddress(t.privateKey.PublicKey)
+}
+
+// apply sets the gas price fields of auth according to the policy.
+func (p FeePolicy) apply(ctx context.Context, client chainClient, auth *bind.TransactOpts) error {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+
+	maxGasPrice := p.maxGasPrice()
+
+	if p.Mode == "eip1559" {
+		tip, err := client.SuggestGasTipCap(ctx)
+		if err != nil {
+			return err
+		}
+		head, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if head.BaseFee == nil {
+			return fmt.Errorf("fee mode eip1559 requested but the chain has no base fee")
+		}
+
+		tip = scaleWei(tip, multiplier)
+		feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+		if maxGasPrice != nil && feeCap.Cmp(maxGasPrice) > 0 {
+			return fmt.Errorf("fee cap %s wei exceeds the configured maximum of %s wei", feeCap, maxGasPrice)
+		}
+
+		auth.GasPrice = nil
+		auth.GasTipCap = tip
+		auth.GasFeeCap = feeCap
+		return nil
+	}
+
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return err
+	}
+	gasPrice = scaleWei(gasPrice, multiplier)
+	if maxGasPrice != nil && gasPrice.Cmp(maxGasPrice) > 0 {
+		return fmt.Errorf("gas price %s wei exceeds the configured maximum of %s wei", gasPrice, maxGasPrice)
+	}
+
+	auth.GasPrice = gasPrice
+	return nil
+}
+
+// maxGasPrice returns the configured cap in wei, or nil when there is none.
+func (p FeePolicy) maxGasPrice() *big.Int {
+	if p.MaxGasPriceGwei <= 0 {
+		return nil
+	}
+	return new(big.Int).Div(ToWei(p.MaxGasPriceGwei), big.NewInt(1e9))
+}
+
+// scaleWei multiplies a wei amount by a float factor, rounding down.
+func scaleWei(value *big.Int, factor float64) *big.Int {
+	if factor == 1 {
+		return value
+	}
+	scaled, _ := new(big.Float).Mul(new(big.Float).SetInt(value), big.NewFloat(factor)).Int(nil)
+	return scaled
+}
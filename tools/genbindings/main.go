@@ -0,0 +1,102 @@
+// Command genbindings generates the typed Go bindings for the records contract from the ABI constant in abi.go.
+//
+// It is run through go:generate from the repository root. With -check it regenerates the bindings in memory and
+// exits with a non-zero status when the committed file is missing or out of date, which makes it usable in CI.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+func main() {
+	abiFile := flag.String("abi", "abi.go", "Go file declaring the ABI constant")
+	constName := flag.String("const", "ABI", "name of the string constant holding the ABI JSON")
+	typeName := flag.String("type", "Records", "name of the generated contract type")
+	pkg := flag.String("pkg", "main", "package of the generated file")
+	out := flag.String("out", "records_binding.go", "output file")
+	check := flag.Bool("check", false, "fail if the output file is not up to date instead of writing it")
+	flag.Parse()
+
+	code, err := generate(*abiFile, *constName, *typeName, *pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *check {
+		if err := checkUpToDate(*out, *abiFile, code); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := os.WriteFile(*out, []byte(code), 0o644); err != nil {
+		log.Fatalf("Error writing %s: %v", *out, err)
+	}
+}
+
+// generate returns the bindings of the named ABI constant of abiFile.
+func generate(abiFile, constName, typeName, pkg string) (string, error) {
+	abiJSON, err := readABIConst(abiFile, constName)
+	if err != nil {
+		return "", fmt.Errorf("reading ABI from %s: %w", abiFile, err)
+	}
+
+	code, err := bind.Bind([]string{typeName}, []string{abiJSON}, []string{""}, nil, pkg, bind.LangGo, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("generating bindings: %w", err)
+	}
+	return code, nil
+}
+
+// checkUpToDate fails when the committed output file differs from freshly generated code.
+func checkUpToDate(out, abiFile, code string) error {
+	current, err := os.ReadFile(out)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", out, err)
+	}
+	if !bytes.Equal(current, []byte(code)) {
+		return fmt.Errorf("%s is out of date with %s, run go generate", out, abiFile)
+	}
+	return nil
+}
+
+// readABIConst parses a Go source file and returns the value of the named string constant.
+func readABIConst(path, name string) (string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return "", err
+	}
+
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for i, ident := range valueSpec.Names {
+				if ident.Name != name || i >= len(valueSpec.Values) {
+					continue
+				}
+				lit, ok := valueSpec.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return "", fmt.Errorf("constant %s is not a string literal", name)
+				}
+				return strconv.Unquote(lit.Value)
+			}
+		}
+	}
+
+	return "", errors.New("constant " + name + " not found")
+}
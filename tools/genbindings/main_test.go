@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+// TestCommittedBindingsAreUpToDate runs the -check mode against the bindings committed at the repository root,
+// so a change to abi.go without go generate fails the tests.
+func TestCommittedBindingsAreUpToDate(t *testing.T) {
+	code, err := generate("../../abi.go", "ABI", "Records", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkUpToDate("../../records_binding.go", "abi.go", code); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+// ValidationRules holds the configurable part of row validation. Rows are always rejected when userId is empty,
+// a reward is negative, NaN or infinite, totalDuration is negative, CHUNK_ID is not a non-negative integer or
+// createdAtDay is missing, since none of those can be packed into the contract tuple.
+type ValidationRules struct {
+	// RequireAssetID rejects rows with a null or empty assetId (VALIDATION_REQUIRE_ASSET_ID, default true).
+	RequireAssetID bool
+	// MaxReward rejects rows where either reward exceeds this many tokens (VALIDATION_MAX_REWARD, 0 disables).
+	MaxReward float64
+	// MaxDuration rejects rows with a larger totalDuration (VALIDATION_MAX_DURATION, 0 disables).
+	MaxDuration int64
+}
+
+// QuarantinedRow is a row that failed validation, as stored in the QUARANTINE_TABLE.
+type QuarantinedRow struct {
+	JobID                    string              `bigquery:"JOB_ID"`
+	ChunkID                  float64             `bigquery:"CHUNK_ID"`
+	UserID                   string              `bigquery:"userId"`
+	AssetID                  bigquery.NullString `bigquery:"assetId"`
+	TotalDuration            int64               `bigquery:"totalDuration"`
+	TotalRewardsConsumer     float64             `bigquery:"totalRewardsConsumer"`
+	TotalRewardsContentOwner float64             `bigquery:"totalRewardsContentOwner"`
+	CreatedAtDay             time.Time           `bigquery:"createdAtDay"`
+	Reason                   string              `bigquery:"reason"`
+	Environment              string              `bigquery:"environment"`
+	QuarantinedAt            time.Time           `bigquery:"quarantinedAt"`
+}
+
+// validationRules returns the validation settings, requiring an assetId unless told otherwise.
+func (s *Settings) validationRules() ValidationRules {
+	rules := ValidationRules{RequireAssetID: true, MaxReward: s.Validation.MaxReward, MaxDuration: s.Validation.MaxDuration}
+	if s.Validation.RequireAssetID != nil {
+		rules.RequireAssetID = *s.Validation.RequireAssetID
+	}
+	return rules
+}
+
+// Validate returns the reasons the row cannot be anchored, joined with "; ", or "" when the row is valid.
+func (r ValidationRules) Validate(row JobDataRow) string {
+	var reasons []string
+
+	if strings.TrimSpace(row.UserID) == "" {
+		reasons = append(reasons, "empty userId")
+	}
+	if r.RequireAssetID && (!row.AssetID.Valid || strings.TrimSpace(row.AssetID.StringVal) == "") {
+		reasons = append(reasons, "missing assetId")
+	}
+	if row.ChunkID < 0 || row.ChunkID != math.Trunc(row.ChunkID) || math.IsInf(row.ChunkID, 0) {
+		reasons = append(reasons, fmt.Sprintf("CHUNK_ID %v is not a non-negative integer", row.ChunkID))
+	}
+	if row.TotalDuration < 0 {
+		reasons = append(reasons, fmt.Sprintf("negative totalDuration %d", row.TotalDuration))
+	} else if r.MaxDuration > 0 && row.TotalDuration > r.MaxDuration {
+		reasons = append(reasons, fmt.Sprintf("totalDuration %d above maximum %d", row.TotalDuration, r.MaxDuration))
+	}
+	if reason := r.validateReward("totalRewardsConsumer", row.TotalRewardsConsumer); reason != "" {
+		reasons = append(reasons, reason)
+	}
+	if reason := r.validateReward("totalRewardsContentOwner", row.TotalRewardsContentOwner); reason != "" {
+		reasons = append(reasons, reason)
+	}
+	if row.CreatedAtDay.IsZero() {
+		reasons = append(reasons, "missing createdAtDay")
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+func (r ValidationRules) validateReward(name string, value float64) string {
+	switch {
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		return fmt.Sprintf("%s is %v", name, value)
+	case value < 0:
+		return fmt.Sprintf("negative %s %v", name, value)
+	case r.MaxReward > 0 && value > r.MaxReward:
+		return fmt.Sprintf("%s %v above maximum %v", name, value, r.MaxReward)
+	}
+	return ""
+}
+
+// newQuarantinedRow records why a row was rejected.
+func newQuarantinedRow(row JobDataRow, reason string) QuarantinedRow {
+	log.Printf("Quarantining row JOB_ID=%s CHUNK_ID=%v userId=%q: %s", row.JobID, row.ChunkID, row.UserID, reason)
+	return QuarantinedRow{
+		JobID:                    row.JobID,
+		ChunkID:                  row.ChunkID,
+		UserID:                   row.UserID,
+		AssetID:                  row.AssetID,
+		TotalDuration:            row.TotalDuration,
+		TotalRewardsConsumer:     row.TotalRewardsConsumer,
+		TotalRewardsContentOwner: row.TotalRewardsContentOwner,
+		CreatedAtDay:             row.CreatedAtDay,
+		Reason:                   reason,
+		Environment:              config.Environment,
+		QuarantinedAt:            time.Now(),
+	}
+}
+
+// key identifies the source row the quarantined row was read from.
+func (r QuarantinedRow) key() sourceRowKey {
+	return sourceRowKey{Day: civil.DateOf(r.CreatedAtDay), JobID: r.JobID, ChunkID: r.ChunkID, UserID: r.UserID, AssetID: r.AssetID}
+}
+
+// quarantineRows streams rejected rows into QUARANTINE_TABLE ("dataset.table" or "project.dataset.table").
+// Without a table the rows are only logged. The table is resolved against client for every attempt, so a retry
+// uses the credentials of a client that reconnected meanwhile.
+func quarantineRows(client func() *bigquery.Client, rows []QuarantinedRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tableRef := config.BigQuery.QuarantineTable
+	if tableRef == "" {
+		log.Printf("QUARANTINE_TABLE is not set, %d rejected rows were only logged", len(rows))
+		return nil
+	}
+
+	ctx := context.Background()
+	err := config.retryPolicy().do(ctx, "writing quarantined rows", func() error {
+		table, err := bigQueryTable(client(), tableRef)
+		if err != nil {
+			return err
+		}
+		return table.Inserter().Put(ctx, rows)
+	})
+	if err != nil {
+		log.Println("Failed to write quarantined rows: ", err)
+		return err
+	}
+
+	log.Printf("%d rows quarantined into %s", len(rows), tableRef)
+	return nil
+}
+
+// bigQueryTable resolves a "dataset.table" or "project.dataset.table" reference against the client's project.
+func bigQueryTable(client *bigquery.Client, ref string) (*bigquery.Table, error) {
+	parts := strings.Split(ref, ".")
+	switch len(parts) {
+	case 2:
+		return client.Dataset(parts[0]).Table(parts[1]), nil
+	case 3:
+		return client.DatasetInProject(parts[0], parts[1]).Table(parts[2]), nil
+	default:
+		return nil, fmt.Errorf("invalid BigQuery table reference %q", ref)
+	}
+}
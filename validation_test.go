@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+func TestValidationRules(t *testing.T) {
+	valid := func() JobDataRow {
+		return testRow("job-1", 3, "user-a", "asset-1", 10, 1.5, 0.5)
+	}
+	strict := ValidationRules{RequireAssetID: true, MaxReward: 100, MaxDuration: 1000}
+
+	tests := []struct {
+		name   string
+		rules  ValidationRules
+		modify func(row *JobDataRow)
+		want   string
+	}{
+		{"valid row", strict, func(*JobDataRow) {}, ""},
+		{"empty userId", strict, func(row *JobDataRow) { row.UserID = "  " }, "empty userId"},
+		{"null assetId", strict, func(row *JobDataRow) { row.AssetID = bigquery.NullString{} }, "missing assetId"},
+		{"blank assetId", strict, func(row *JobDataRow) { row.AssetID.StringVal = " " }, "missing assetId"},
+		{"null assetId allowed", ValidationRules{}, func(row *JobDataRow) { row.AssetID = bigquery.NullString{} }, ""},
+		{"negative CHUNK_ID", strict, func(row *JobDataRow) { row.ChunkID = -1 }, "CHUNK_ID -1 is not a non-negative integer"},
+		{"fractional CHUNK_ID", strict, func(row *JobDataRow) { row.ChunkID = 2.5 }, "CHUNK_ID 2.5 is not a non-negative integer"},
+		{"infinite CHUNK_ID", strict, func(row *JobDataRow) { row.ChunkID = math.Inf(1) }, "CHUNK_ID +Inf is not a non-negative integer"},
+		{"negative totalDuration", strict, func(row *JobDataRow) { row.TotalDuration = -5 }, "negative totalDuration -5"},
+		{"totalDuration above maximum", strict, func(row *JobDataRow) { row.TotalDuration = 1001 }, "totalDuration 1001 above maximum 1000"},
+		{"no maximum totalDuration", ValidationRules{}, func(row *JobDataRow) { row.TotalDuration = 1 << 40 }, ""},
+		{"NaN reward", strict, func(row *JobDataRow) { row.TotalRewardsConsumer = math.NaN() }, "totalRewardsConsumer is NaN"},
+		{"infinite reward", strict, func(row *JobDataRow) { row.TotalRewardsContentOwner = math.Inf(1) }, "totalRewardsContentOwner is +Inf"},
+		{"negative reward", strict, func(row *JobDataRow) { row.TotalRewardsConsumer = -0.1 }, "negative totalRewardsConsumer -0.1"},
+		{"reward above maximum", strict, func(row *JobDataRow) { row.TotalRewardsContentOwner = 100.5 }, "totalRewardsContentOwner 100.5 above maximum 100"},
+		{"no maximum reward", ValidationRules{}, func(row *JobDataRow) { row.TotalRewardsConsumer = 1e6 }, ""},
+		{"missing createdAtDay", strict, func(row *JobDataRow) { row.CreatedAtDay = time.Time{} }, "missing createdAtDay"},
+		{"every reason", strict, func(row *JobDataRow) {
+			row.UserID = ""
+			row.TotalDuration = -1
+			row.CreatedAtDay = time.Time{}
+		}, "empty userId; negative totalDuration -1; missing createdAtDay"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			row := valid()
+			test.modify(&row)
+			if got := test.rules.Validate(row); got != test.want {
+				t.Errorf("Validate = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuarantinedRowKeyIdentifiesTheSourceRow(t *testing.T) {
+	row := testRow("job-1", 3, "user-a", "asset-1", 10, 1, 1)
+	want := sourceRowKey{Day: civil.Date{Year: 2024, Month: time.October, Day: 20}, JobID: "job-1", ChunkID: 3,
+		UserID: "user-a", AssetID: row.AssetID}
+	if key := newQuarantinedRow(row, "test").key(); key != want {
+		t.Errorf("key = %+v, want %+v", key, want)
+	}
+}
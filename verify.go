@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/bytedance/sonic"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const verifyUsage = `usage: replay-bigquery-job verify -user USER_ID -asset ASSET_ID -day YYYY-MM-DD [options]
+
+Reads the records stored for the key from the contract and, when an expected record (-duration, -consumer and
+-owner) or a statement (-statement csv:PATH or jsonl:PATH) is given, checks that every expected record is on
+chain. Only reads from the chain: no signer key is needed. Exits with status 1 when the verification fails.
+
+options:`
+
+// verifiedRecord is a record stored on chain for the key, with the transaction that wrote it when the event log
+// could be searched.
+type verifiedRecord struct {
+	TotalDuration               string       `json:"totalDuration"`
+	TotalRewardsConsumer        string       `json:"totalRewardsConsumer"`
+	TotalRewardsConsumerWei     string       `json:"totalRewardsConsumerWei"`
+	TotalRewardsContentOwner    string       `json:"totalRewardsContentOwner"`
+	TotalRewardsContentOwnerWei string       `json:"totalRewardsContentOwnerWei"`
+	TxHash                      *common.Hash `json:"txHash,omitempty"`
+	BlockNumber                 uint64       `json:"blockNumber,omitempty"`
+	LogIndex                    uint         `json:"logIndex,omitempty"`
+	// Expected is set when the record matched an expected one.
+	Expected bool `json:"expected"`
+}
+
+// verification is the outcome of the verify command, printed as text or JSON.
+type verification struct {
+	UserID   string           `json:"userId"`
+	AssetID  string           `json:"assetId"`
+	Day      string           `json:"day"`
+	Contract common.Address   `json:"contract"`
+	Verified bool             `json:"verified"`
+	Records  []verifiedRecord `json:"records"`
+	// Missing lists the expected records no stored record matched.
+	Missing []verifiedRecord `json:"missing,omitempty"`
+	// LogError explains why the transactions of the records are unknown.
+	LogError string `json:"logError,omitempty"`
+}
+
+func newVerifiedRecord(tx ReplayLibraryTransaction) verifiedRecord {
+	return verifiedRecord{
+		TotalDuration:               tx.TotalDuration.String(),
+		TotalRewardsConsumer:        FromWei(tx.TotalRewardsConsumer),
+		TotalRewardsConsumerWei:     tx.TotalRewardsConsumer.String(),
+		TotalRewardsContentOwner:    FromWei(tx.TotalRewardsContentOwner),
+		TotalRewardsContentOwnerWei: tx.TotalRewardsContentOwner.String(),
+	}
+}
+
+func (r verifiedRecord) matches(other verifiedRecord) bool {
+	return r.TotalDuration == other.TotalDuration &&
+		r.TotalRewardsConsumerWei == other.TotalRewardsConsumerWei &&
+		r.TotalRewardsContentOwnerWei == other.TotalRewardsContentOwnerWei
+}
+
+// verifyRecords reads the records of a key from the contract, links them to the TransactionAdded events that
+// wrote them and matches them against the expected records, each stored record matching at most one.
+func verifyRecords(ctx context.Context, records *Records, contract common.Address, userID, assetID string, day time.Time,
+	expected []ReplayLibraryTransaction, fromBlock uint64) (*verification, error) {
+	dayNum, month, year := big.NewInt(int64(day.Day())), big.NewInt(int64(day.Month())), big.NewInt(int64(day.Year()))
+	result := &verification{UserID: userID, AssetID: assetID, Day: day.Format("2006-01-02"), Contract: contract}
+
+	var stored []ReplayLibraryTransaction
+	err := config.retryPolicy().do(ctx, "reading the records", func() (err error) {
+		stored, err = records.GetTransactionsByDay(&bind.CallOpts{Context: ctx}, userID, dayNum, month, year, assetID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getTransactionsByDay: %w", err)
+	}
+	for _, tx := range stored {
+		result.Records = append(result.Records, newVerifiedRecord(tx))
+	}
+
+	// Events are linked to the records they carry, each to at most one: fromBlock may leave out the events of the
+	// first records, so their positions say nothing.
+	events, err := records.FilterTransactionAdded(&bind.FilterOpts{Start: fromBlock, Context: ctx}, []string{userID},
+		[]*big.Int{dayNum}, []*big.Int{month})
+	if err != nil {
+		result.LogError = err.Error()
+	} else {
+		for events.Next() {
+			event := events.Event
+			if event.Year.Cmp(year) != 0 || event.AssetId != assetID {
+				continue
+			}
+			written := verifiedRecord{
+				TotalDuration:               event.TotalDuration.String(),
+				TotalRewardsConsumerWei:     event.TotalRewardsConsumer.String(),
+				TotalRewardsContentOwnerWei: event.TotalRewardsContentOwner.String(),
+			}
+			for i := range result.Records {
+				if record := &result.Records[i]; record.TxHash == nil && record.matches(written) {
+					hash := event.Raw.TxHash
+					record.TxHash = &hash
+					record.BlockNumber = event.Raw.BlockNumber
+					record.LogIndex = event.Raw.Index
+					break
+				}
+			}
+		}
+		if err := events.Error(); err != nil {
+			result.LogError = err.Error()
+		}
+		events.Close()
+	}
+
+	for _, tx := range expected {
+		want := newVerifiedRecord(tx)
+		found := false
+		for i := range result.Records {
+			if !result.Records[i].Expected && result.Records[i].matches(want) {
+				result.Records[i].Expected = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Missing = append(result.Missing, want)
+		}
+	}
+	result.Verified = len(result.Records) > 0 && len(result.Missing) == 0
+	return result, nil
+}
+
+// text renders the verification for a person reading it.
+func (v *verification) text() string {
+	var b strings.Builder
+	status := "VERIFIED"
+	if !v.Verified {
+		status = "NOT VERIFIED"
+	}
+	fmt.Fprintf(&b, "%s: userId %s, assetId %s, %s on contract %s\n", status, v.UserID, v.AssetID, v.Day, v.Contract.Hex())
+	fmt.Fprintf(&b, "%d records on chain\n", len(v.Records))
+	for _, record := range v.Records {
+		line := fmt.Sprintf("  duration %s, consumer %s, content owner %s", record.TotalDuration,
+			record.TotalRewardsConsumer, record.TotalRewardsContentOwner)
+		if record.TxHash != nil {
+			line += fmt.Sprintf(", tx %s in block %d (log %d)", record.TxHash.Hex(), record.BlockNumber, record.LogIndex)
+		}
+		if record.Expected {
+			line += ", matches the expected record"
+		}
+		fmt.Fprintln(&b, line)
+	}
+	for _, record := range v.Missing {
+		fmt.Fprintf(&b, "  MISSING: duration %s, consumer %s, content owner %s\n", record.TotalDuration,
+			record.TotalRewardsConsumer, record.TotalRewardsContentOwner)
+	}
+	if v.LogError != "" {
+		fmt.Fprintf(&b, "Transactions unknown, the event log could not be searched: %s\n", v.LogError)
+	}
+	return b.String()
+}
+
+// loadStatement returns the rows of an exported statement ("csv:PATH" or "jsonl:PATH") that belong to the key.
+func loadStatement(spec, userID, assetID string, day time.Time) ([]JobDataRow, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	var source *fileSource
+	var err error
+	switch kind {
+	case "csv":
+		source, err = loadFileSource(path, readCSVRecords)
+	case "jsonl":
+		source, err = loadFileSource(path, readJSONLRecords)
+	default:
+		return nil, fmt.Errorf("unknown statement %q, expected csv:<path> or jsonl:<path>", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []JobDataRow
+	for _, row := range source.rows {
+		if row.UserID == userID && row.AssetID.StringVal == assetID && row.CreatedAtDay.Format("2006-01-02") == day.Format("2006-01-02") {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("statement %s has no record of %s for asset %s on %s", path, userID, assetID, day.Format("2006-01-02"))
+	}
+	return rows, nil
+}
+
+// runVerify checks the records of one key at an RPC endpoint, using the contract registry of the chain target
+// unless -contract is given.
+func runVerify(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), verifyUsage)
+		flags.PrintDefaults()
+	}
+	userID := flags.String("user", "", "userId of the records")
+	assetID := flags.String("asset", "", "assetId of the records")
+	dayStr := flags.String("day", "", "day of the records (YYYY-MM-DD)")
+	targetName := flags.String("target", "", "chain target whose contract registry and RPC endpoint are used, defaults to the first")
+	rpcURL := flags.String("rpc", "", "RPC endpoint to read from, defaults to the preferred endpoint of the chain target")
+	contractAddress := flags.String("contract", "", "records contract, defaults to the deployment of the chain target active on the day")
+	duration := flags.Int64("duration", -1, "expected totalDuration")
+	consumer := flags.Float64("consumer", 0, "expected totalRewardsConsumer, in tokens")
+	owner := flags.Float64("owner", 0, "expected totalRewardsContentOwner, in tokens")
+	statement := flags.String("statement", "", "expected records, as csv:PATH or jsonl:PATH in the record source format")
+	fromBlock := flags.Uint64("from-block", 0, "first block searched for the transactions of the records")
+	format := flags.String("format", "text", "output format, text or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	day, err := time.Parse("2006-01-02", *dayStr)
+	if err != nil || *userID == "" || *assetID == "" {
+		flags.Usage()
+		return fmt.Errorf("-user, -asset and -day are required")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected text or json", *format)
+	}
+	var expected []JobDataRow
+	switch {
+	case *statement != "":
+		if expected, err = loadStatement(*statement, *userID, *assetID, day); err != nil {
+			return err
+		}
+	case *duration >= 0:
+		expected = []JobDataRow{{
+			UserID:                   *userID,
+			AssetID:                  bigquery.NullString{StringVal: *assetID, Valid: true},
+			TotalDuration:            *duration,
+			TotalRewardsConsumer:     *consumer,
+			TotalRewardsContentOwner: *owner,
+			CreatedAtDay:             day,
+		}}
+	}
+
+	var registry *ContractRegistry
+	if *contractAddress != "" {
+		if registry, err = newSingleDeploymentRegistry(*contractAddress); err != nil {
+			return err
+		}
+	}
+	// Only one endpoint is used, the first of several comma separated URLs or the target's preferred one: the result
+	// should not depend on failover.
+	var endpoint *RPCEndpoint
+	if endpoints := parseRPCURLs(*rpcURL); len(endpoints) > 0 {
+		endpoint = &endpoints[0]
+	}
+	if registry == nil || endpoint == nil {
+		targets, err := LoadReadOnlyChainTargets()
+		if err != nil {
+			return err
+		}
+		target, err := FindChainTarget(targets, *targetName)
+		if err != nil {
+			return err
+		}
+		if registry == nil {
+			registry = target.registry
+		}
+		if endpoint == nil {
+			if endpoint = target.preferredEndpoint(); endpoint == nil {
+				return fmt.Errorf("missing -rpc: chain target %q has no RPC endpoint", target.Name)
+			}
+		}
+	}
+
+	client, err := dialRPC(ctx, endpoint.URL)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", redactURL(endpoint.URL), err)
+	}
+	defer client.Close()
+
+	deployment, records, err := registry.BindActive(ctx, client, day)
+	if err != nil {
+		return err
+	}
+	result, err := verifyRecords(ctx, records, deployment.ContractAddress(), *userID, *assetID, day,
+		buildTransactions(expected), *fromBlock)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		data, err := sonic.ConfigStd.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Print(result.text())
+	}
+
+	if !result.Verified {
+		return fmt.Errorf("records of %s for asset %s on %s not verified", *userID, *assetID, result.Day)
+	}
+	return nil
+}